@@ -0,0 +1,70 @@
+// Package fep automates free energy perturbation (FEP) simulations using Tinker-OpenMM on a cluster of GPU nodes.
+//
+// A typical embedding reads a settings INI file with GetParams, reads the node INI it points to with GetNodeGroup,
+// prepares the lambda windows with DynamicSetup, runs dynamic_omm.x on them with NodeGroup.DynamicManager, runs
+// bar_omm.x between neighbouring windows with BARSetup and NodeGroup.BARManager, and finally collects free energies
+// with ReturnResults. Every function returns an error rather than exiting, so callers decide how to handle problems.
+//
+// Scripts are run through the Backend of the NodeGroup: ShellBackend runs them over ssh on the cluster, while
+// SimulatedBackend fakes nvidia-smi and Tinker locally for testing.
+package fep
+
+import (
+	"os"
+	"time"
+)
+
+const octalPermissions os.FileMode = 0777
+
+// gofep_results.go constants
+const resultFileName string = "bar2.log"
+
+// FinalResultFileName is the name of the file free energies are written to in the target directory
+const FinalResultFileName string = "results.txt"
+
+// gofep_nodes.go constants
+const nodeCheckScriptName string = "run_nvidia_smi.sh"
+
+// gofep_backend.go constants
+const simMaxFrames int = 50
+const simFrameDelay time.Duration = 10 * time.Millisecond
+const simVdwFreeEnergy float64 = -4.5
+const simEleFreeEnergy float64 = -7.5
+
+// gofep_plan.go constants
+const defaultNsPerDay float64 = 10
+
+// gofep_progress.go constants
+const defaultProgressInterval time.Duration = 60 * time.Second
+const progressLogTailBytes int64 = 64 * 1024
+const progressLogTailLines int = 400
+const logTailScriptName string = "tail_log.sh"
+
+// gofep_journal.go constants
+
+// JournalFileName is the name of the run journal kept in the target directory
+const JournalFileName string = "gofep_journal.jsonl"
+const runStateRecentEvents int = 200
+
+// gofep_scheduler.go constants
+const schedulerCheckInterval time.Duration = 30 * time.Second
+const schedulerUsageFileName string = "scheduler_usage.json"
+const defaultUsageHalfLife time.Duration = 7 * 24 * time.Hour
+const defaultPriorityAging time.Duration = time.Hour
+
+// gofep_server.go constants
+const serverRunsFolderName string = "runs"
+const serverRunFileName string = "run.json"
+const serverUploadMemory int64 = 32 << 20
+
+// gofep_notify.go constants
+const notifyTimeout time.Duration = 30 * time.Second
+
+// gofep_build.go constants
+const buildStateFileName string = "gofep_build.json"
+
+// gofep_window.go constants
+const windowManifestFileName string = "window.json"
+
+// gofep_bar_setup.go constants
+const pairManifestFileName string = "pair.json"
@@ -0,0 +1,127 @@
+package fep
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Auxiliary: contains utility functions with usage in multiple parts of the program
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func removeContents(dir string, keep ...string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if contains(keep, name) {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy file copies a file from one location to another
+// This functionality is not supported by a built in function in go
+func copyFile(destPath string, sourcePath string) error {
+	// Open source file
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", sourcePath, err)
+	}
+	defer sourceFile.Close()
+
+	// Create destination file
+	destFile, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", destPath, err)
+	}
+
+	// Set permissions of destination file
+	err = os.Chmod(destPath, octalPermissions)
+	if err != nil {
+		destFile.Close()
+		return fmt.Errorf("failed to change permissions of file %s: %w", destPath, err)
+	}
+
+	// Copy contents of source file to destination file
+	_, err = io.Copy(destFile, sourceFile)
+	if err != nil {
+		destFile.Close()
+		return fmt.Errorf("failed to copy contents of file %s to file %s: %w", sourcePath, destPath, err)
+	}
+
+	// Close destination file
+	err = destFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close file %s: %w", destPath, err)
+	}
+	return nil
+}
+
+// exists returns whether the given file or directory exists
+func pathExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	// file exists and no error
+	if err == nil {
+		return true, nil
+	}
+	// file does not exist and no error
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	// file exists and error
+	return true, err
+}
+
+// Check whether list contains s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether list contains n
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Write a file with goFEP's usual permissions
+func writeFile(path string, contents string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	// Set file permissions jic
+	err = os.Chmod(path, octalPermissions)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to change permissions of file %s: %w", path, err)
+	}
+	_, err = file.WriteString(contents)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write to file %s: %w", path, err)
+	}
+	return file.Close()
+}
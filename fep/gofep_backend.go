@@ -0,0 +1,441 @@
+package fep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jgourary/goFEP/xyz"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Backend: contains the interface through which goFEP runs the scripts it writes, along with a shell implementation
+// for the cluster and a simulated one that fakes Tinker and nvidia-smi for testing and training without GPUs
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Backend runs scripts written by goFEP and returns their combined output
+type Backend interface {
+	// CheckEnvironment checks that files needed by scripts on the cluster exist
+	CheckEnvironment(genPrm *GeneralParameters) error
+	// Run runs script with arguments
+	Run(scriptPath string, args ...string) ([]byte, error)
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Shell backend
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ShellBackend runs scripts with sh, which ssh into cluster nodes
+type ShellBackend struct{}
+
+// CheckEnvironment checks that the files sourced on nodes and the OpenMM homes exist
+func (ShellBackend) CheckEnvironment(genPrm *GeneralParameters) error {
+	var files = [...]string{genPrm.IntelSource, genPrm.Cuda8Home, genPrm.Cuda8Source, genPrm.Cuda10Home, genPrm.Cuda10Source}
+	for _, file := range files {
+		fileExists, err := pathExists(file)
+		if err != nil {
+			return errors.New("error while verifying existence of file \"" + file + "\": " + err.Error())
+		} else if fileExists == false {
+			return errors.New("file specified in INI \"" + file + "\" does not exist")
+		}
+	}
+	return nil
+}
+
+// Run runs script with sh
+func (ShellBackend) Run(scriptPath string, args ...string) ([]byte, error) {
+	return exec.Command("sh", append([]string{scriptPath}, args...)...).CombinedOutput()
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Simulated backend
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// SimulatedBackend reads the scripts goFEP writes and, instead of running them, fakes what nvidia-smi, dynamic_omm.x
+// and bar_omm.x would have produced: nvidia-smi tables, dynamic logs with arc and dyn files, bar files and BAR2 logs.
+// Free energies follow a simple linear model of the lambdas in each window's key file
+type SimulatedBackend struct {
+	// GPUs currently running a simulated job, keyed by node name then card number
+	mu   sync.Mutex
+	busy map[string]map[string]int
+}
+
+// NewSimulatedBackend creates a new simulated backend with all GPUs idle
+func NewSimulatedBackend() *SimulatedBackend {
+	return &SimulatedBackend{busy: map[string]map[string]int{}}
+}
+
+// CheckEnvironment does nothing, as nothing on the cluster is used in simulation
+func (sb *SimulatedBackend) CheckEnvironment(genPrm *GeneralParameters) error {
+	return nil
+}
+
+// Run identifies what script does from its contents and fakes it
+func (sb *SimulatedBackend) Run(scriptPath string, args ...string) ([]byte, error) {
+	data, err := ioutil.ReadFile(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+	script := string(data)
+
+	// node status check
+	if strings.Contains(script, "nvidia-smi") {
+		if len(args) < 1 {
+			return nil, errors.New("simulated nvidia-smi called without node name")
+		}
+		return []byte(sb.nvidiaSMI(args[0])), nil
+	}
+
+	// log tail over ssh: logs are on the local file system in simulation
+	if strings.Contains(script, " tail ") {
+		if len(args) < 2 {
+			return nil, errors.New("simulated tail called without node name and log path")
+		}
+		data, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(string(data), "\n")
+		if len(lines) > progressLogTailLines {
+			lines = lines[len(lines)-progressLogTailLines:]
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+
+	// Tinker calls: mark the GPU as busy while faking the command
+	nodeName, cardNumber := getSimulatedScriptNode(script)
+	sb.setBusy(nodeName, cardNumber, 1)
+	defer sb.setBusy(nodeName, cardNumber, -1)
+
+	for _, line := range strings.Split(script, "\n") {
+		tokens := strings.Fields(line)
+		if len(tokens) == 0 {
+			continue
+		}
+		switch filepath.Base(tokens[0]) {
+		case "dynamic_omm.x":
+			return simulateDynamic(tokens)
+		case "bar_omm.x":
+			if len(tokens) > 1 && tokens[1] == "1" {
+				return simulateBAR1(tokens)
+			}
+			return simulateBAR2(tokens)
+		}
+	}
+	return nil, errors.New("simulated backend does not know how to run script " + scriptPath)
+}
+
+// Mark a simulated GPU as running one more (delta = 1) or one fewer (delta = -1) job
+func (sb *SimulatedBackend) setBusy(nodeName string, cardNumber string, delta int) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.busy[nodeName] == nil {
+		sb.busy[nodeName] = map[string]int{}
+	}
+	sb.busy[nodeName][cardNumber] += delta
+}
+
+// Write an nvidia-smi table for node listing a Tinker process on each busy GPU, laid out as updateNodeStatus expects
+func (sb *SimulatedBackend) nvidiaSMI(nodeName string) string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	out := time.Now().Format("Mon Jan  2 15:04:05 2006") + "\n" +
+		"+-----------------------------------------------------------------------------+\n" +
+		"| NVIDIA-SMI 440.33.01    Driver Version: 440.33.01    CUDA Version: 10.2     |\n" +
+		"|-------------------------------+----------------------+----------------------+\n" +
+		"| GPU  Name        Persistence-M| Bus-Id        Disp.A | Volatile Uncorr. ECC |\n" +
+		"| Fan  Temp  Perf  Pwr:Usage/Cap|         Memory-Usage | GPU-Util  Compute M. |\n" +
+		"|===============================+======================+======================|\n" +
+		"|   0  Simulated GPU       Off  | 00000000:01:00.0 Off |                  N/A |\n" +
+		"| 27%   33C    P8    20W / 250W |      0MiB / 11019MiB |      0%      Default |\n" +
+		"+-------------------------------+----------------------+----------------------+\n" +
+		"                                                                               \n" +
+		"+-----------------------------------------------------------------------------+\n" +
+		"| Processes:                                                       GPU Memory |\n" +
+		"|  GPU       PID   Type   Process name                             Usage      |\n" +
+		"|=============================================================================|\n"
+	numProcesses := 0
+	for cardNumber, jobs := range sb.busy[nodeName] {
+		for i := 0; i < jobs; i++ {
+			out += fmt.Sprintf("|  %3s     %5d      C   %-40s %6s |\n", cardNumber, 10000+rand.Intn(50000), "dynamic_omm.x", "300MiB")
+			numProcesses++
+		}
+	}
+	if numProcesses == 0 {
+		out += "|  No running processes found                                                 |\n"
+	}
+	out += "+-----------------------------------------------------------------------------+\n"
+	return out
+}
+
+// Fake dynamic_omm.x: write log, append frames to arc file and write dyn file.
+// tokens: dynamic_omm.x xyz -k key steps stepInterval saveInterval ensemble [temp] [pressure] N > log
+func simulateDynamic(tokens []string) ([]byte, error) {
+	if len(tokens) < 11 {
+		return nil, errors.New("simulated dynamic_omm.x called with too few arguments: " + strings.Join(tokens, " "))
+	}
+	xyzPath := tokens[1]
+	logPath := tokens[len(tokens)-1]
+	steps, err := strconv.Atoi(tokens[4])
+	if err != nil {
+		return nil, errors.New("simulated dynamic_omm.x got invalid number of steps " + tokens[4])
+	}
+	stepInterval, err := strconv.ParseFloat(tokens[5], 64)
+	if err != nil {
+		return nil, errors.New("simulated dynamic_omm.x got invalid step interval " + tokens[5])
+	}
+	saveInterval, err := strconv.ParseFloat(tokens[6], 64)
+	if err != nil {
+		return nil, errors.New("simulated dynamic_omm.x got invalid save interval " + tokens[6])
+	}
+
+	// Read starting structure
+	start, err := xyz.ReadFile(xyzPath)
+	if err != nil {
+		return nil, err
+	}
+	baseName := strings.TrimSuffix(xyzPath, filepath.Ext(xyzPath))
+	arcPath := baseName + ".arc"
+	existingFrames, _ := xyz.CountFrames(arcPath)
+
+	// Cap the number of frames written so simulations stay fast, spacing them evenly over the simulated time
+	numFrames := int(float64(steps) * stepInterval / 1000 / saveInterval)
+	if numFrames > simMaxFrames {
+		numFrames = simMaxFrames
+	}
+	if numFrames < 1 {
+		numFrames = 1
+	}
+	stepsPerFrame := steps / numFrames
+
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+	arcFile, err := os.OpenFile(arcPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, octalPermissions)
+	if err != nil {
+		return nil, err
+	}
+	defer arcFile.Close()
+
+	_, err = logFile.WriteString("\n Molecular Dynamics Trajectory via r-RESPA MTS Algorithm (simulated by goFEP)\n\n" +
+		"    MD Step      E Total   E Potential   E Kinetic       Temp       Pres\n\n")
+	if err != nil {
+		return nil, err
+	}
+
+	var frame *xyz.Frame
+	for i := 1; i <= numFrames; i++ {
+		// Jiggle atoms and append frame to arc
+		frame = jiggleSimulatedAtoms(start)
+		_, err = frame.WriteTo(arcFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// Report step and frame in the same layout as Tinker
+		step := i * stepsPerFrame
+		picoseconds := float64(step) * stepInterval / 1000
+		potential := -10000 + rand.NormFloat64()*20
+		kinetic := 1350 + rand.NormFloat64()*10
+		_, err = logFile.WriteString(fmt.Sprintf(" %10d %12.4f %12.4f %12.4f %10.2f %10.2f\n", step, potential+kinetic, potential, kinetic,
+			298+rand.NormFloat64(), rand.NormFloat64()*50) +
+			fmt.Sprintf("\n Instantaneous Values for Frame Saved at %13.4f Picoseconds\n\n", picoseconds) +
+			fmt.Sprintf(" Current Time %25.4f Picosecond\n", picoseconds) +
+			fmt.Sprintf(" Current Potential %20.4f Kcal/mole\n", potential) +
+			fmt.Sprintf(" Current Kinetic %22.4f Kcal/mole\n", kinetic) +
+			fmt.Sprintf(" Frame Number %19d\n", existingFrames+i) +
+			fmt.Sprintf(" Coordinate File %21s\n\n", filepath.Base(arcPath)))
+		if err != nil {
+			return nil, err
+		}
+		time.Sleep(simFrameDelay)
+	}
+
+	// Write restart file holding the last frame
+	err = ioutil.WriteFile(baseName+".dyn", []byte(" Number of Atoms and Title :\n"+frame.String()), octalPermissions)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{}, nil
+}
+
+// Fake bar_omm.x part 1: write a bar file next to the first arc holding energy differences of both trajectories.
+// tokens: bar_omm.x 1 arc1 temp arc2 temp > log
+func simulateBAR1(tokens []string) ([]byte, error) {
+	if len(tokens) < 8 {
+		return nil, errors.New("simulated bar_omm.x 1 called with too few arguments: " + strings.Join(tokens, " "))
+	}
+	arc1Path := tokens[2]
+	temp := tokens[3]
+	arc2Path := tokens[4]
+	logPath := tokens[len(tokens)-1]
+
+	// Free energy between windows follows from their lambdas
+	deltaG := getSimulatedFreeEnergy(filepath.Dir(arc2Path)) - getSimulatedFreeEnergy(filepath.Dir(arc1Path))
+
+	// Write one section per trajectory, each line holding frame number and energy in both states
+	contents := ""
+	for _, arcPath := range []string{arc1Path, arc2Path} {
+		numFrames, _ := xyz.CountFrames(arcPath)
+		if numFrames == 0 {
+			return nil, errors.New("simulated bar_omm.x found no frames in " + arcPath)
+		}
+		contents += fmt.Sprintf("%8d %10s  %s\n", numFrames, temp, filepath.Base(arcPath))
+		for i := 1; i <= numFrames; i++ {
+			energy := -10000 + rand.NormFloat64()*20
+			contents += fmt.Sprintf("%8d %20.4f %20.4f\n", i, energy, energy+deltaG+rand.NormFloat64()*0.5)
+		}
+	}
+	barPath := strings.TrimSuffix(arc1Path, "arc") + "bar"
+	err := ioutil.WriteFile(barPath, []byte(contents), octalPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(logPath, []byte("\n Simulated BAR: wrote energies of "+filepath.Base(arc1Path)+" and "+filepath.Base(arc2Path)+" to "+barPath+"\n"), octalPermissions)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(simFrameDelay)
+	return []byte{}, nil
+}
+
+// Fake bar_omm.x part 2: average energy differences in the bar file and write FEP results as Tinker reports them.
+// tokens: bar_omm.x 2 bar start stop step start stop step > log
+func simulateBAR2(tokens []string) ([]byte, error) {
+	if len(tokens) < 11 {
+		return nil, errors.New("simulated bar_omm.x 2 called with too few arguments: " + strings.Join(tokens, " "))
+	}
+	barPath := tokens[2]
+	logPath := tokens[len(tokens)-1]
+
+	file, err := os.Open(barPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Read energy differences of each trajectory section
+	var sections [][]float64
+	remaining := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		if remaining == 0 {
+			remaining, err = strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, errors.New("invalid section header in bar file " + barPath)
+			}
+			sections = append(sections, []float64{})
+			continue
+		}
+		e1, err1 := strconv.ParseFloat(fields[1], 64)
+		e2, err2 := strconv.ParseFloat(fields[2], 64)
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("invalid energies in bar file " + barPath)
+		}
+		sections[len(sections)-1] = append(sections[len(sections)-1], e2-e1)
+		remaining--
+	}
+	if len(sections) != 2 {
+		return nil, errors.New("expected 2 trajectories in bar file " + barPath)
+	}
+
+	forward, forwardErr := meanAndStandardError(sections[0])
+	backward, backwardErr := meanAndStandardError(sections[1])
+	bar := (forward + backward) / 2
+	barErr := math.Sqrt(forwardErr*forwardErr+backwardErr*backwardErr) / 2
+
+	contents := "\n Simulated BAR Free Energy Estimates\n\n" +
+		fmt.Sprintf(" Free Energy via Forward FEP %16.4f +/- %10.4f Kcal/mol\n", forward, forwardErr) +
+		fmt.Sprintf(" Free Energy via Backward FEP %15.4f +/- %10.4f Kcal/mol\n", backward, backwardErr) +
+		fmt.Sprintf(" Free Energy via BAR Iteration %14.4f +/- %10.4f Kcal/mol\n", bar, barErr)
+	err = ioutil.WriteFile(logPath, []byte(contents), octalPermissions)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(simFrameDelay)
+	return []byte{}, nil
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Helper functions
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Get node name and card number from the ssh and CUDA_VISIBLE_DEVICES lines of a script
+func getSimulatedScriptNode(script string) (string, string) {
+	var nodeName, cardNumber string
+	for _, line := range strings.Split(script, "\n") {
+		tokens := strings.Fields(line)
+		if len(tokens) > 4 && tokens[0] == "ssh" {
+			nodeName = tokens[3]
+		} else if len(tokens) > 1 && tokens[0] == "export" && strings.HasPrefix(tokens[1], "CUDA_VISIBLE_DEVICES=") {
+			cardNumber = strings.TrimPrefix(tokens[1], "CUDA_VISIBLE_DEVICES=")
+		}
+	}
+	return nodeName, cardNumber
+}
+
+// Move every atom of a frame by a small random amount, returning the moved copy
+func jiggleSimulatedAtoms(frame *xyz.Frame) *xyz.Frame {
+	jiggled := frame.Copy()
+	for i := range jiggled.Atoms {
+		for j := range jiggled.Atoms[i].Coords {
+			jiggled.Atoms[i].Coords[j] += rand.NormFloat64() * 0.05
+		}
+	}
+	return jiggled
+}
+
+// Model free energy of a window from the lambdas in its key file: decoupling costs a fixed amount per unit of lambda
+func getSimulatedFreeEnergy(windowDir string) float64 {
+	vdw, ele := 1.0, 1.0
+	matches, _ := filepath.Glob(filepath.Join(windowDir, "*.key"))
+	if len(matches) > 0 {
+		vdwLambda, eleLambda, _, err := getKeyLambdas(matches[0])
+		if err == nil && vdwLambda != "" {
+			vdw, _ = strconv.ParseFloat(vdwLambda, 64)
+		}
+		if err == nil && eleLambda != "" {
+			ele, _ = strconv.ParseFloat(eleLambda, 64)
+		}
+	}
+	return simVdwFreeEnergy*vdw + simEleFreeEnergy*ele
+}
+
+// Get mean and standard error of the mean of values
+func meanAndStandardError(values []float64) (float64, float64) {
+	n := float64(len(values))
+	if n == 0 {
+		return math.NaN(), math.NaN()
+	}
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= n
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	if n > 1 {
+		variance /= n - 1
+	}
+	return mean, math.Sqrt(variance / n)
+}
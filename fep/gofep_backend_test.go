@@ -0,0 +1,154 @@
+package fep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Settings of a small run of water with four windows, two dynamic blocks and three nodes, for the simulated backend
+const simulatedSettings = `general {
+    targetDirectory DIR
+    xyz DIR/lig.xyz
+    key DIR/lig.key
+    prm DIR/water.prm
+    nodeINI DIR/nodes.ini
+    nodePreference fastest
+    intelSource DIR/intel.sh
+    cuda8Source DIR/cuda8.sh
+    cuda10Source DIR/cuda10.sh
+    cuda8Home DIR/omm8
+    cuda10Home DIR/omm10
+}
+
+setup {
+    vdwLambdas 1.0 1.0 0.5 0.0
+    eleLambdas 1.0 0.5 0.0 0.0
+}
+
+dynamic {
+    name equil
+    order 1
+    repetitions 1
+    ensemble 2
+    temp 298
+    stepInterval 2
+    saveInterval 1
+    simulationTime 0.01
+}
+
+dynamic {
+    name prod
+    order 2
+    repetitions 2
+    ensemble 2
+    temp 298
+    stepInterval 2
+    saveInterval 1
+    simulationTime 0.02
+}
+
+bar {
+    temp 298
+    frameInterval 1
+}
+`
+
+// Files of the run of simulatedSettings
+var simulatedInputs = map[string]string{
+	"lig.xyz": `     3  water
+     1  O      0.000000    0.000000    0.000000     1     2     3
+     2  H      0.957200    0.000000    0.000000     2     1
+     3  H     -0.239988    0.926627    0.000000     2     1
+`,
+	"lig.key": "parameters water.prm\nligand -1 3\n",
+	"water.prm": `atom          1    1    O     "AMOEBA Water O"               8    15.995    2
+atom          2    2    H     "AMOEBA Water H"               1     1.008    1
+`,
+	"nodes.ini": `# name,card,manufacturer,generation,model,memory,performance
+node1,0,NVIDIA,Turing,RTX2080,8,10
+node2,0,NVIDIA,Pascal,GTX1080,8,8
+node3,1,NVIDIA,Pascal,GTX1080,8,8
+`,
+}
+
+func TestSimulatedRun(t *testing.T) {
+	iniPath, remove := writeTestINI(t, simulatedSettings)
+	defer remove()
+	dir := filepath.Dir(iniPath)
+	for name, contents := range simulatedInputs {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings, err := GetParams(iniPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genPrm := &settings.General
+
+	// Run setup, dynamic, BAR and results as auto does
+	err = DynamicSetup(genPrm, &settings.Setup, &settings.Hooks, nil)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	err = BARSetup(genPrm, &settings.Setup, &settings.BAR, nil)
+	if err != nil {
+		t.Fatalf("BAR setup failed: %v", err)
+	}
+	// Folders in the dynamic directory that are not windows are left alone
+	err = os.Mkdir(filepath.Join(dir, "dynamic", "notes"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ng, err := GetNodeGroup(genPrm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ng.Backend = NewSimulatedBackend()
+	jobs, err := ng.PipelineManager(genPrm, &settings.Setup, settings.Dynamic, &settings.BAR, len(settings.Setup.Vdw))
+	if err != nil {
+		t.Fatalf("pipeline failed: %v", err)
+	}
+	if failed := CountFailed(jobs); failed > 0 {
+		t.Fatalf("%d of %d jobs failed", failed, len(jobs))
+	}
+	results, err := ReturnResults(genPrm, nil, nil)
+	if err != nil {
+		t.Fatalf("results failed: %v", err)
+	}
+
+	// Every pair along the lambda path has a result, and the totals add them up
+	pairs := [][2]string{{"vdw1.0ele1.0", "vdw1.0ele0.5"}, {"vdw1.0ele0.5", "vdw0.5ele0.0"}, {"vdw0.5ele0.0", "vdw0.0ele0.0"}}
+	if len(results.Pairs) != len(pairs) {
+		t.Fatalf("got %d pairs, want %d", len(results.Pairs), len(pairs))
+	}
+	forward := 0.0
+	for i, pair := range results.Pairs {
+		if pair.From != pairs[i][0] || pair.To != pairs[i][1] {
+			t.Errorf("got pair %s to %s, want %s to %s", pair.From, pair.To, pairs[i][0], pairs[i][1])
+		}
+		forward += pair.Forward.Energy
+	}
+	if diff := results.Forward.Energy - forward; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("got forward total %g, want the sum of the pairs %g", results.Forward.Energy, forward)
+	}
+
+	// results.txt lists the same
+	data, err := ioutil.ReadFile(filepath.Join(dir, "results.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	for _, pair := range pairs {
+		if strings.Count(text, pair[0]+" to "+pair[1]) != 2 {
+			t.Errorf("results.txt does not list pair %s to %s forward and backward:\n%s", pair[0], pair[1], text)
+		}
+	}
+	if !strings.HasPrefix(text, "Forward FEP Results") || strings.Count(text, "Total: ") != 2 {
+		t.Errorf("results.txt lacks forward and backward totals:\n%s", text)
+	}
+}
@@ -0,0 +1,558 @@
+package fep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// BAR: contains functions relevant to running Tinker's BAR 1 & BAR 2 programs
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// BARManager is the "API" to this file. It manages functions BAR1 & BAR2 and sees that they run in order on each pair:
+// BAR2 of a pair starts as soon as its BAR1 has finished, without waiting for other pairs. Pairs whose windows and BAR
+// parameters are unchanged since BAR last finished on them are skipped. The preBAR1 and preBAR2 hooks run before any
+// pair, and postBAR1 and postBAR2 after all of them. It returns a record of every job run; failed jobs also leave an
+// .err file in their directory
+func (ng *NodeGroup) BARManager(genPrm *GeneralParameters, barPrm *BARParameters, maxNodes int) ([]Job, error) {
+
+	// Find subdirectories to run BAR inside
+	fmt.Println("\nVerifying bar subdirectories...")
+	subDirs, err := getBARSubDirs(genPrm.TargetDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate subdirectories for bar: %w", err)
+	}
+
+	// Find out which pairs are up to date, and record steps as they finish
+	fmt.Println("\nChecking bar subdirectories against the build state...")
+	build, err := loadBuildState(genPrm.TargetDirectory)
+	if err != nil {
+		return nil, err
+	}
+	pairs, jobs, err := ng.queueBAR(subDirs, barPrm, build)
+	if err != nil {
+		return nil, err
+	}
+	ng.build = build
+	defer func() {
+		ng.build = nil
+	}()
+
+	// Run AutoBAR
+	fmt.Println("\nPreparing to run AutoBAR...")
+	t1 := time.Now()
+	ng.Events.emitStage(StageStarted, BAR1Stage, nil)
+	ng.Events.emitStage(StageStarted, BAR2Stage, nil)
+	hookEnv := pairsHookEnv(subDirs)
+	err = runHook(genPrm, "preBAR1", ng.hooks().PreBAR1, hookEnv...)
+	if err == nil {
+		err = runHook(genPrm, "preBAR2", ng.hooks().PreBAR2, hookEnv...)
+	}
+	if err == nil {
+		err = ng.autoBAR(pairs, genPrm, barPrm, maxNodes)
+	}
+	if err == nil {
+		err = runHook(genPrm, "postBAR1", ng.hooks().PostBAR1, hookEnv...)
+	}
+	ng.Events.emitStage(StageFinished, BAR1Stage, err)
+	if err == nil {
+		err = runHook(genPrm, "postBAR2", ng.hooks().PostBAR2, hookEnv...)
+	}
+	ng.Events.emitStage(StageFinished, BAR2Stage, err)
+	if err != nil {
+		return jobs, err
+	}
+	t2 := time.Now()
+	fmt.Println("\nAutoBAR finished in " + t2.Sub(t1).String())
+
+	return jobs, nil
+}
+
+// A pair of neighbouring windows to run BAR on. bar1 and bar2 point to the jobs of the pair that must run, and are nil
+// for those that are up to date
+type barPair struct {
+	subDir string
+	bar1   *Job
+	bar2   *Job
+}
+
+// Get the first job of pair
+func (p barPair) first() *Job {
+	if p.bar1 != nil {
+		return p.bar1
+	}
+	return p.bar2
+}
+
+// Find out which BAR steps of each pair in subDirs are out of date in build, and queue jobs for them. Returns the
+// pairs with a job to run, and the jobs they point into
+func (ng *NodeGroup) queueBAR(subDirs []string, barPrm *BARParameters, build *buildState) ([]barPair, []Job, error) {
+	bar1Dirs, bar2Dirs, err := build.checkBAR(subDirs, barPrm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Every pair whose BAR1 must run also runs BAR2
+	jobs := make([]Job, len(bar1Dirs)+len(bar2Dirs))
+	pairs := make([]barPair, len(bar2Dirs))
+	bar1Jobs := make(map[string]*Job)
+	for i, subDir := range bar1Dirs {
+		jobs[i] = Job{Kind: BAR1Job, Dir: subDir}
+		bar1Jobs[subDir] = &jobs[i]
+	}
+	for i, subDir := range bar2Dirs {
+		jobs[len(bar1Dirs)+i] = Job{Kind: BAR2Job, Dir: subDir}
+		pairs[i] = barPair{subDir: subDir, bar1: bar1Jobs[subDir], bar2: &jobs[len(bar1Dirs)+i]}
+	}
+	return pairs, jobs, nil
+}
+
+// AutoBAR, managed by BARManager, runs BAR on all pairs provided in parallel on different cluster nodes
+func (ng *NodeGroup) autoBAR(pairs []barPair, genPrm *GeneralParameters, barPrm *BARParameters, maxNodes int) error {
+	if len(pairs) == 0 {
+		fmt.Println("\nSkipping AutoBAR: all pairs are up to date")
+		return nil
+	}
+
+	// Get nodes to run BAR on, unless a scheduler grants them as jobs go
+	maxNodes, err := ng.findFreeNodes(genPrm, maxNodes)
+	if err != nil {
+		return err
+	}
+
+	// Create new wait group to determine when all goroutines have finished
+	wg := sync.WaitGroup{}
+
+	// iterate through all pairs
+	fmt.Println("\nBeginning AutoBAR run on " + strconv.Itoa(len(pairs)) + " pairs...\n")
+	for i := 0; i < len(pairs); i++ {
+		// Queue jobs of pair on the node to run BAR on, iterating through the list of free nodes
+		nodeIndex := ng.assignNode(pairs[i].first(), i, maxNodes)
+		ng.queuePair(pairs[i])
+		// Add one to wait group
+		wg.Add(1)
+		// Launch go routine (parallel processing) to run BAR1 then BAR2 of the pair on selected node
+		pair := pairs[i]
+		ng.launch(pair.first(), nodeIndex, &wg, func(n *Node, wg *sync.WaitGroup) {
+			ng.runBARPair(n, pair, genPrm, barPrm, wg)
+		})
+	}
+
+	// Wait here until all goroutines have finished
+	wg.Wait()
+
+	return nil
+}
+
+// Report the jobs of pair as queued on the node of its first job
+func (ng *NodeGroup) queuePair(pair barPair) {
+	if pair.bar1 != nil {
+		pair.bar2.Node = pair.bar1.Node
+		ng.Events.emitJob(JobQueued, pair.bar1)
+	}
+	ng.Events.emitJob(JobQueued, pair.bar2)
+}
+
+// Run BAR1 of pair then, if it succeeded, BAR2 straight after on node n, skipping steps that are up to date
+func (ng *NodeGroup) runBARPair(n *Node, pair barPair, genPrm *GeneralParameters, barPrm *BARParameters, wg *sync.WaitGroup) {
+
+	// subtract one from wg count when finished
+	defer wg.Done()
+
+	if pair.bar1 != nil {
+		jobWG := sync.WaitGroup{}
+		jobWG.Add(1)
+		ng.BAR1(n, pair.subDir, genPrm, barPrm, pair.bar1, &jobWG)
+		if pair.bar1.Err != nil {
+			ng.skipJob(pair.bar2, errors.New("not run as BAR1 of the pair failed"))
+			return
+		}
+	}
+	pair.bar2.Node = n.Name
+	jobWG := sync.WaitGroup{}
+	jobWG.Add(1)
+	ng.BAR2(n, pair.subDir, genPrm, barPrm, pair.bar2, &jobWG)
+}
+
+// Record job as failed with err without running it
+func (ng *NodeGroup) skipJob(job *Job, err error) {
+	job.Err = err
+	job.Finished = time.Now()
+	ng.Events.emitJobEnd(job)
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// BAR 1
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// BAR1, managed by AutoBAR, runs BAR1 in the subdirectory specified on node specified, recording the outcome in job
+func (ng *NodeGroup) BAR1(n *Node, subBarDir string, genPrm *GeneralParameters, barPrm *BARParameters, job *Job, wg *sync.WaitGroup) {
+
+	// subtract one from wg count when finished
+	defer wg.Done()
+
+	job.Started = time.Now()
+	ng.Events.emitJob(JobStarted, job)
+	defer func() {
+		job.Finished = time.Now()
+		ng.Events.emitJobEnd(job)
+	}()
+
+	// Get paths to ARC files to run BAR 1 on
+	arcFilePaths, err := getBAR1FilePaths(genPrm.TargetDirectory, subBarDir)
+	if err != nil {
+		job.Err = fmt.Errorf("failed to find file paths of ARC files to run BAR 1 with: %w", err)
+		fmt.Println(job.Err)
+		return
+	}
+	arc1Path := arcFilePaths[0]
+	arc2Path := arcFilePaths[1]
+
+	// By default, Tinker writes BAR1 output to a file in the same directory as the first ARC file with the same name
+	defOutputPath := strings.TrimSuffix(arc1Path, "arc") + "bar"
+	// We would like to move output from there (targetDirectory/dynamic/subDynDir)
+	// to the directory we are running bar in (targetDirectory/bar/subBarDir) for organizational purposes
+	intendedBaseFileName := strings.TrimSuffix(filepath.Base(arc1Path), "arc")
+	intendedOutputPath := filepath.Join(subBarDir, intendedBaseFileName+"bar")
+	// Pairs with the same first window (which extra pairs may have) would write there at the same time, so they take
+	// turns until the output is moved
+	unlock := lockBAR1Output(defOutputPath)
+	defer unlock()
+
+	// Write script to run BAR 1 and save to BAR subdirectory
+	job.Script, err = createTempBAR1Script(subBarDir, arc1Path, arc2Path, genPrm, barPrm, n)
+	if err != nil {
+		job.Err = err
+		fmt.Println("Error encountered in subdirectory " + subBarDir + ": " + err.Error())
+		return
+	}
+
+	// Run bar 1 script we just wrote
+	job.Output, err = ng.backend().Run(job.Script)
+	// Report results to user
+	if err != nil {
+		job.Err = err
+		fmt.Print("Error encountered on files in subdirectory " + filepath.Dir(arc1Path) + " and " + filepath.Dir(arc2Path) + " using node " + n.Name)
+		fmt.Println(err)
+
+		// Write output to file
+		outFilePath := filepath.Join(subBarDir, "bar1.err")
+		err = writeFile(outFilePath, string(job.Output))
+		if err != nil {
+			fmt.Println("failed to create error log: " + err.Error())
+		}
+		fmt.Println()
+
+	} else {
+		fmt.Println("BAR1 finished successfully on files in subdirectories " + filepath.Dir(arc1Path) + " and " + filepath.Dir(arc2Path) + " using node " + n.Name)
+	}
+
+	// move output file from default location to new one
+	err = copyFile(intendedOutputPath, defOutputPath)
+	if err != nil {
+		fmt.Println("Failed to copy BAR1 output from " + defOutputPath + " to " + intendedOutputPath)
+		if job.Err == nil {
+			job.Err = err
+		}
+		return
+	}
+	err = os.Remove(defOutputPath)
+	if err != nil {
+		fmt.Println("Failed to remove initial BAR1 output file from " + defOutputPath)
+	}
+	if job.Err == nil {
+		ng.build.done(barStepName(BAR1Job, subBarDir))
+	}
+}
+
+// Locks on the default output files of BAR1, by path
+var bar1Outputs = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+// Lock the default output file of BAR1 at path, returning a function that unlocks it
+func lockBAR1Output(path string) func() {
+	bar1Outputs.Lock()
+	lock, ok := bar1Outputs.locks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		bar1Outputs.locks[path] = lock
+	}
+	bar1Outputs.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// Write a bash script to perform BAR1 and save to directory specified
+func createTempBAR1Script(subBarDir string, arc1Path string, arc2Path string, genPrm *GeneralParameters, barPrm *BARParameters, n *Node) (string, error) {
+
+	// Write temp bash script in dir
+	filePath := filepath.Join(subBarDir, "bar1.sh")
+
+	// Write file contents
+	script, err := getBAR1Script(subBarDir, arc1Path, arc2Path, genPrm, barPrm, n)
+	if err != nil {
+		return "", err
+	}
+	err = writeFile(filePath, script)
+	if err != nil {
+		return "", err
+	}
+
+	return filePath, nil
+}
+
+// Get contents of bash script that runs BAR1 on node n
+func getBAR1Script(subBarDir string, arc1Path string, arc2Path string, genPrm *GeneralParameters, barPrm *BARParameters, n *Node) (string, error) {
+	// get log path
+	logPath := filepath.Join(subBarDir, "bar1.log")
+
+	// Start with header that logs into node and sources files
+	header, openMMHome, err := getNodeScriptHeader(genPrm, n)
+	if err != nil {
+		return "", err
+	}
+	// Write command to launch bar1 then end here document
+	return header + "\t" + filepath.Join(openMMHome, "bar_omm.x") + " 1 " + arc1Path + " " + barPrm.Temp + " " + arc2Path + " " + barPrm.Temp + " > " + logPath + " \n" + "END", nil
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Bar 2
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// BAR2, managed by AutoBAR, runs BAR2 on files in subdirectory provided on node provided, recording the outcome in job
+func (ng *NodeGroup) BAR2(n *Node, subBarDir string, genPrm *GeneralParameters, barPrm *BARParameters, job *Job, wg *sync.WaitGroup) {
+
+	// subtract one from wg count when finished
+	defer wg.Done()
+
+	job.Started = time.Now()
+	ng.Events.emitJob(JobStarted, job)
+	defer func() {
+		job.Finished = time.Now()
+		ng.Events.emitJobEnd(job)
+	}()
+
+	// Get path to .bar file inside subBarDir
+	barPath, err := getBAR2FilePath(subBarDir)
+	if err != nil {
+		job.Err = err
+		fmt.Println("Error encountered in subdirectory " + subBarDir + ": " + err.Error())
+		return
+	}
+
+	// Get number of frames from .bar file
+	frameCount, err := getNumFrames(barPath)
+	if err != nil {
+		job.Err = err
+		fmt.Println("Error encountered in subdirectory " + subBarDir + ": " + err.Error())
+		return
+	}
+
+	// Write script to run bar2 and save to subBarDir
+	job.Script, err = createTempBAR2Script(barPath, frameCount, genPrm, barPrm, n)
+	if err != nil {
+		job.Err = err
+		fmt.Println("Error encountered in subdirectory " + subBarDir + ": " + err.Error())
+		return
+	}
+
+	// Run that script
+	job.Output, err = ng.backend().Run(job.Script)
+	// Report results to user
+	if err != nil {
+		job.Err = err
+		fmt.Print("Error encountered on files in subdirectory " + subBarDir + " using node " + n.Name)
+		fmt.Println(err)
+
+		// Write output to file
+		outFilePath := filepath.Join(subBarDir, "bar2.err")
+		err = writeFile(outFilePath, string(job.Output))
+		if err != nil {
+			fmt.Println("failed to create error log: " + err.Error())
+		}
+		fmt.Println()
+
+	} else {
+		fmt.Println("BAR2 finished successfully on files in subdirectory " + subBarDir + " using node " + n.Name)
+		ng.build.done(barStepName(BAR2Job, subBarDir))
+
+		// Read free energy of the pair so it can be reported before all pairs are done. Unparsable (NaN) values are left
+		// out as they cannot be written to JSON
+		forward, backward, err := getStepResult(subBarDir)
+		if err == nil && !math.IsNaN(forward.Energy+forward.Error+backward.Energy+backward.Error) {
+			params := strings.Split(filepath.Base(subBarDir), "_")
+			job.Result = &PairResult{From: params[0], To: params[len(params)-1], Forward: forward, Backward: backward}
+		}
+	}
+}
+
+// Writes bash script to run BAR2 on node provided on BAR2 file provided
+func createTempBAR2Script(barPath string, frameCount string, genPrm *GeneralParameters, barPrm *BARParameters, n *Node) (string, error) {
+
+	scriptPath := filepath.Join(filepath.Dir(barPath), "bar2.sh")
+
+	// Write file contents
+	script, err := getBAR2Script(barPath, frameCount, genPrm, barPrm, n)
+	if err != nil {
+		return "", err
+	}
+	err = writeFile(scriptPath, script)
+	if err != nil {
+		return "", err
+	}
+
+	return scriptPath, nil
+}
+
+// Get contents of bash script that runs BAR2 on node n
+func getBAR2Script(barPath string, frameCount string, genPrm *GeneralParameters, barPrm *BARParameters, n *Node) (string, error) {
+	// get log path
+	logPath := filepath.Join(filepath.Dir(barPath), "bar2.log")
+
+	// Start with header that logs into node and sources files
+	header, openMMHome, err := getNodeScriptHeader(genPrm, n)
+	if err != nil {
+		return "", err
+	}
+	// Write command to launch bar2 then end here document
+	return header + "\t" + filepath.Join(openMMHome, "bar_omm.x") + " 2 " + barPath + " 1 " + frameCount + " " + barPrm.FrameInterval +
+		" 1 " + frameCount + " " + barPrm.FrameInterval + " > " + logPath + " \n" + "END", nil
+}
+
+// /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Helper functions
+// /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Retrieves number of frames from .bar files
+func getNumFrames(barPath string) (string, error) {
+	file, err := os.Open(barPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open bar file %s: %w", barPath, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+	tokens := strings.Fields(scanner.Text())
+	if len(tokens) == 0 {
+		return "", errors.New("failed to read number of frames from first line of bar file " + barPath)
+	}
+	return tokens[0], nil
+}
+
+// takes BAR subdirectory path, e.g. bar/vdw000ele000_vdw010ele000 and gets corresponding dynamic subdirectory paths,
+// e.g. dynamic/vdw000ele000 and dynamic/vdw010ele000. Then returns paths to ARC files in those directories
+func getBAR1FilePaths(directory string, subBarDir string) ([]string, error) {
+	dynDir := filepath.Join(directory, "dynamic")
+
+	// Get name of the bar directory
+	barDirName := filepath.Base(subBarDir)
+	// Get the names of the 2 dynamic directories corresponding to the bar directory
+	dynDirNames := strings.Split(barDirName, "_")
+	if len(dynDirNames) != 2 {
+		return nil, errors.New("bar directory " + subBarDir + " is not named after 2 dynamic directories")
+	}
+	dynDirs := [2]string{filepath.Join(dynDir, dynDirNames[0]), filepath.Join(dynDir, dynDirNames[1])}
+	// arcPaths will hold the paths to the 2 arc files
+	arcPaths := make([]string, len(dynDirs))
+
+	// for each of the 2 directories
+	for i := 0; i < len(dynDirs); i++ {
+
+		// get all files in dir
+		fileInfo, err := ioutil.ReadDir(dynDirs[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %s: %w", dynDirs[i], err)
+		}
+
+		// Initialize variables to track name and number of arc files in directory
+		var arcName string
+		numARC := 0
+
+		// Iterate through all files in directory
+		for j := 0; j < len(fileInfo); j++ {
+
+			// get file ext
+			fileExt := filepath.Ext(fileInfo[j].Name())
+			// if ext = arc, save name and iterate counter
+			if fileExt == ".arc" {
+				arcName = fileInfo[j].Name()
+				numARC++
+			}
+		}
+
+		// Check for deficiencies with directory
+		if numARC != 1 {
+			return nil, errors.New("missing or multiple ARC file(s) in directory " + dynDirs[i])
+		}
+		// Get arc paths by adding arc name to directory name
+		arcPaths[i] = filepath.Join(dynDirs[i], arcName)
+	}
+	// return arc paths
+	return arcPaths, nil
+}
+
+// get path to .bar file in directory
+func getBAR2FilePath(subDir string) (string, error) {
+	// read directory
+	fileInfo, err := ioutil.ReadDir(subDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory %s: %w", subDir, err)
+	}
+	// set var to track number of bar files
+	numBAR := 0
+	var barName string
+
+	// iterate through all files
+	for i := 0; i < len(fileInfo); i++ {
+		// get file ext
+		fileExt := filepath.Ext(fileInfo[i].Name())
+		// if ext = bar, save name and iterate counter
+		if fileExt == ".bar" {
+			barName = fileInfo[i].Name()
+			numBAR++
+		}
+	}
+
+	// Check for deficiencies with directory
+	if numBAR != 1 {
+		return "", errors.New("missing or multiple BAR file(s) in directory " + subDir)
+	}
+	// get path from name
+	barPath := filepath.Join(subDir, barName)
+	// return path
+	return barPath, nil
+}
+
+// Get subdirectories to run BAR inside
+func getBARSubDirs(directory string) ([]string, error) {
+	// get name of directory that hold bar subdirectories
+	barDir := filepath.Join(directory, "bar")
+	// read it
+	fileInfo, err := ioutil.ReadDir(barDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", barDir, err)
+	}
+	// save subdirectory paths to slice
+	var subDirs []string
+	for i := 0; i < len(fileInfo); i++ {
+		if fileInfo[i].IsDir() {
+			subDirs = append(subDirs, filepath.Join(barDir, fileInfo[i].Name()))
+		} else {
+			// flag error if any of the contents is a loose file
+			err = errors.New("loose files in bar directory")
+		}
+	}
+	// return slice of paths
+	return subDirs, err
+}
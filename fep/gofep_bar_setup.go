@@ -0,0 +1,283 @@
+package fep
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// PairManifest describes a BAR pair. BAR setup writes it to pair.json in the pair's folder
+type PairManifest struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Index is the position of the pair along the lambda path, from 0. Extra pairs of the bar block come after the
+	// pairs of the path and are not part of the total free energy
+	Index int  `json:"index"`
+	Extra bool `json:"extra,omitempty"`
+}
+
+// ReadPairManifest reads the manifest of the BAR pair in subDir
+func ReadPairManifest(subDir string) (*PairManifest, error) {
+	path := filepath.Join(subDir, pairManifestFileName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pair manifest %s: %w", path, err)
+	}
+	m := &PairManifest{}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pair manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// BARSetup sets up the folders that BAR related files will be save in, one for each pair of windows next to each other
+// along the lambda path of the setup block and one for each extra pair of the bar block. If setupPrm is nil, the path
+// is taken from the manifests of the windows in the dynamic directory. Stage events are sent to events, which may be nil
+func BARSetup(genPrm *GeneralParameters, setupPrm *SetupParameters, barPrm *BARParameters, events *Emitter) error {
+	events.emitStage(StageStarted, BARSetupStage, nil)
+	err := barSetup(genPrm, setupPrm, barPrm)
+	events.emitStage(StageFinished, BARSetupStage, err)
+	return err
+}
+
+// Set up BAR folders, called by BARSetup
+func barSetup(genPrm *GeneralParameters, setupPrm *SetupParameters, barPrm *BARParameters) error {
+	fmt.Println("\nBeginning BAR setup in directory: " + genPrm.TargetDirectory)
+	t1 := time.Now()
+
+	//dynDirectory := filepath.Join(genPrm.targetDirectory,"dynamic")
+
+	// Get number of folders in dyn directory without arc files
+	fmt.Println("\nChecking dynamic folders to verify output...")
+	// flag error that BAR should not be run yet
+	/*dynDirProb := isDynamicComplete(dynDirectory)
+	if dynDirProb != nil {
+		log.Fatal(dynDirProb)
+	}*/
+
+	// Get pairings of dynamic folders to run BAR between
+	fmt.Println("\nCalculating pairings between dynamic folders along the lambda path...")
+	barPairings, err := getBarPairings(genPrm.TargetDirectory, setupPrm, barPrm)
+	if err != nil {
+		return err
+	}
+	// Create folders with names based on these pairings in the BAR directory
+	fmt.Println("\nGenerating BAR folders accordingly...")
+	err = createBarFolders(genPrm.TargetDirectory, barPairings)
+	if err != nil {
+		return err
+	}
+
+	t2 := time.Now()
+	fmt.Println("\nBAR Setup finished in " + t2.Sub(t1).String())
+	return nil
+}
+
+/*func isDynamicComplete(dynDirectory string) error {
+	// Read in all files in dir
+	dynDirs, err := ioutil.ReadDir(dynDirectory)
+	if err != nil {
+		fmt.Println("failed to read directory: " + dynDirectory)
+		log.Fatal(err)
+	}
+
+	// Iterate through all items in directory
+	for i := 0; i < len(dynDirs); i++ {
+		thisDir := filepath.Join(dynDirectory, dynDirs[i])
+		// if item is a Dir (as it should be unless the end user tampered with the directory manually...)
+		if dynDirs[i].IsDir() {
+			// Check each dir to verify it has an arc file
+			contents, err := ioutil.ReadDir(dynDirs[i].Name())
+			if err != nil {
+				fmt.Println("failed to read directory: " + dynDirs[i].Name())
+				log.Fatal(err)
+			}
+			for j := 0; j < len(contents); j++ {
+				if filepath.Ext(contents[j].Name()) == "arc" {
+					err = errors.New("cannot run BAR - subdirectory \"" + dynDirs[i].Name() + "\" is missing an arc file")
+					return err
+				}
+			}
+		}
+
+	}
+	return nil
+}*/
+
+// Pair windows next to each other along the lambda path, then add the extra pairs of barPrm
+func getBarPairings(directory string, setupPrm *SetupParameters, barPrm *BARParameters) ([]PairManifest, error) {
+	path, err := getLambdaPath(directory, setupPrm)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) < 2 {
+		return nil, fmt.Errorf("at least 2 windows are needed to run BAR, found %d in %s", len(path), filepath.Join(directory, "dynamic"))
+	}
+	return pairWindows(path, barPrm)
+}
+
+// LambdaPathSetup gets the setup parameters of settings the lambda path is read from: those of its setup block if it sets
+// lambdas, or else nil, in which case the path is read from the window manifests
+func LambdaPathSetup(settings *Settings) *SetupParameters {
+	if len(settings.Setup.Vdw) > 0 {
+		return &settings.Setup
+	}
+	return nil
+}
+
+// Get the windows along the lambda path in order: those of setupPrm if it is not nil, or else those with a manifest in
+// the dynamic directory, by their index. Other folders in the dynamic directory are not windows and are left out, as
+// dynamic and BAR run along this path
+func getLambdaPath(directory string, setupPrm *SetupParameters) ([]string, error) {
+	dynDirectory := filepath.Join(directory, "dynamic")
+
+	// Read in all files in dir
+	fileInfo, err := ioutil.ReadDir(dynDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dynDirectory, err)
+	}
+
+	var path []string
+	if setupPrm != nil {
+		path, err = GetDynamicFolderNames(setupPrm)
+		if err != nil {
+			return nil, err
+		}
+		for _, window := range path {
+			if _, err := os.Stat(filepath.Join(dynDirectory, window)); err != nil {
+				return nil, errors.New("window " + window + " of the setup block has not been set up in " + dynDirectory + ": run setup first")
+			}
+		}
+	} else {
+		// Order windows by the index in their manifests
+		var manifests []*WindowManifest
+		for _, info := range fileInfo {
+			if !info.IsDir() {
+				continue
+			}
+			m, err := ReadWindowManifest(filepath.Join(dynDirectory, info.Name()))
+			if err == nil {
+				manifests = append(manifests, m)
+			}
+		}
+		sort.Slice(manifests, func(i, j int) bool {
+			return manifests[i].Index < manifests[j].Index
+		})
+		for i, m := range manifests {
+			if i > 0 && m.Index == manifests[i-1].Index {
+				return nil, errors.New("windows " + manifests[i-1].Name + " and " + m.Name + " both have index " + strconv.Itoa(m.Index) +
+					" along the lambda path in their manifests: run setup again")
+			}
+			path = append(path, m.Name)
+		}
+	}
+
+	// Report folders that are not windows, as they are not paired
+	for _, info := range fileInfo {
+		if info.IsDir() && !contains(path, info.Name()) {
+			fmt.Println("Ignoring folder " + info.Name() + " in dynamic directory: it is not a window of the lambda path")
+		}
+	}
+	return path, nil
+}
+
+// Pair each window of path with the next, then add the extra pairs of barPrm, whose windows are given by name or by
+// index along the path
+func pairWindows(path []string, barPrm *BARParameters) ([]PairManifest, error) {
+	var pairs []PairManifest
+	for i := 0; i < len(path)-1; i++ {
+		pairs = append(pairs, PairManifest{Name: path[i] + "_" + path[i+1], From: path[i], To: path[i+1], Index: i})
+	}
+
+	// Extra pairs go in the order of the path too
+	for _, extra := range barPrm.ExtraPairs {
+		i := findPathWindow(path, extra[0])
+		j := findPathWindow(path, extra[1])
+		if i < 0 || j < 0 {
+			return nil, errors.New("extra pair \"" + extra[0] + ":" + extra[1] + "\" in bar block of INI file names a window that is not " +
+				"on the lambda path. Windows are given by name or by index along the path from 0")
+		}
+		if i > j {
+			i, j = j, i
+		}
+		if j-i < 2 {
+			return nil, errors.New("extra pair \"" + extra[0] + ":" + extra[1] + "\" in bar block of INI file is not a pair of two " +
+				"windows that are apart along the lambda path")
+		}
+		name := path[i] + "_" + path[j]
+		for _, pair := range pairs {
+			if pair.Name == name {
+				return nil, errors.New("extra pair \"" + extra[0] + ":" + extra[1] + "\" in bar block of INI file is given twice")
+			}
+		}
+		pairs = append(pairs, PairManifest{Name: name, From: path[i], To: path[j], Index: len(pairs), Extra: true})
+	}
+	return pairs, nil
+}
+
+// Find window in path by name or by index, returning its index or -1 if it is not there
+func findPathWindow(path []string, window string) int {
+	if i, err := strconv.Atoi(window); err == nil {
+		if i >= 0 && i < len(path) {
+			return i
+		}
+		return -1
+	}
+	for i := range path {
+		if path[i] == window {
+			return i
+		}
+	}
+	return -1
+}
+
+// Creates folders in BAR directory based on pairings, each with the manifest of its pair. Folders of pairs that still
+// exist are kept so BAR is not run on them again unless they are out of date; folders of pairs that no longer exist
+// are removed
+func createBarFolders(directory string, barPairings []PairManifest) error {
+	barDirectory := filepath.Join(directory, "bar")
+
+	// get names of folders to keep
+	wanted := make(map[string]bool)
+	for i := 0; i < len(barPairings); i++ {
+		wanted[barPairings[i].Name] = true
+	}
+
+	// remove old folders (the bar directory does not exist the first time)
+	fileInfo, _ := ioutil.ReadDir(barDirectory)
+	for _, info := range fileInfo {
+		if !wanted[info.Name()] {
+			fmt.Println("Removing BAR folder " + info.Name() + " of a pair that no longer exists")
+			err := os.RemoveAll(filepath.Join(barDirectory, info.Name()))
+			if err != nil {
+				return fmt.Errorf("failed to remove old BAR folder %s: %w", info.Name(), err)
+			}
+		}
+	}
+
+	// add new folders
+	for i := 0; i < len(barPairings); i++ {
+		folderPath := filepath.Join(barDirectory, barPairings[i].Name)
+		err := os.MkdirAll(folderPath, octalPermissions)
+		if err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", folderPath, err)
+		}
+		data, err := json.MarshalIndent(barPairings[i], "", "  ")
+		if err != nil {
+			return err
+		}
+		err = writeFile(filepath.Join(folderPath, pairManifestFileName), string(data)+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,452 @@
+package fep
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Build: contains the build state that tracks what each dynamic, BAR1 and BAR2 step was run from, so that like make,
+// only steps whose inputs or parameters changed are run again
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A step is built from a stamp: a checksum of the files it reads and the parameters it is run with, chained through
+// the stamps of the steps it depends on:
+//
+//	dynamic/<window>/<block>_<repetition>	window xyz, key and prm files, block parameters, previous step of window
+//	dynamic/<window>			last step of window, once all steps of window finished
+//	seed/<window>				seed block of the window it is seeded from, which replaces its xyz file above
+//	bar1/<pair>				both windows, BAR temperature
+//	bar2/<pair>				bar1 of pair, BAR frame interval
+//
+// Setup and results are cheap and write the same files given the same inputs, so they always run
+
+// Build state of a target directory, saved after every step that finishes
+type buildState struct {
+	path string
+	// existed is false if no step was recorded in the directory before it was loaded, in which case its outputs
+	// predate tracking
+	existed bool
+	// readOnly build states are checked as usual to plan a run, but never saved and never remove output. Windows that
+	// would have their output removed are kept in resets
+	readOnly bool
+	resets   map[string]bool
+
+	mu    sync.Mutex
+	Steps map[string]string `json:"steps"`
+	// stamps steps will be recorded with once they finish
+	expected map[string]string
+	// stamps of the last step of each window checked, and the windows of those steps
+	finals    map[string]string
+	lastSteps map[string]string
+	// seeds of the windows checked that are seeded from another window
+	seeds map[string]seedStep
+}
+
+// Load the build state of targetDirectory, starting an empty one if there is none
+func loadBuildState(targetDirectory string) (*buildState, error) {
+	b := &buildState{path: filepath.Join(targetDirectory, buildStateFileName), Steps: make(map[string]string),
+		expected: make(map[string]string), finals: make(map[string]string), lastSteps: make(map[string]string),
+		seeds: make(map[string]seedStep), resets: make(map[string]bool)}
+	data, err := ioutil.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return b, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read build state %s: %w", b.path, err)
+	}
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse build state %s: %w", b.path, err)
+	}
+	if b.Steps == nil {
+		b.Steps = make(map[string]string)
+	}
+	b.existed = true
+	return b, nil
+}
+
+// Get stamp step was last built with, or "" if it never was
+func (b *buildState) get(step string) string {
+	if b == nil {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Steps[step]
+}
+
+// Set the stamp step is to be recorded with once it finishes
+func (b *buildState) expect(step string, stamp string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expected[step] = stamp
+}
+
+// Record step as built with the stamp it was expected to have, along with its window if it is the window's last step.
+// Steps run without an expected stamp, or without a build state, are not recorded
+func (b *buildState) done(step string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stamp, ok := b.expected[step]
+	if !ok {
+		return
+	}
+	b.Steps[step] = stamp
+	if window, ok := b.lastSteps[step]; ok {
+		b.Steps["dynamic/"+window] = stamp
+	}
+	err := b.save()
+	if err != nil {
+		fmt.Println("Failed to record step " + step + " in build state: " + err.Error())
+	}
+}
+
+// Record step as built with stamp
+func (b *buildState) set(step string, stamp string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Steps[step] = stamp
+	return b.save()
+}
+
+// Forget every step that match reports true for, so they are run again
+func (b *buildState) forget(match func(step string) bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for step := range b.Steps {
+		if match(step) {
+			delete(b.Steps, step)
+		}
+	}
+	return b.save()
+}
+
+// Write build state to its file, replacing the old one only once written in full, unless it is read-only. Caller must
+// hold b.mu
+func (b *buildState) save() error {
+	if b.readOnly {
+		return nil
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := b.path + ".tmp"
+	err = ioutil.WriteFile(tempPath, data, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to write build state %s: %w", tempPath, err)
+	}
+	err = os.Rename(tempPath, b.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace build state %s: %w", b.path, err)
+	}
+	return nil
+}
+
+// Combine parts into a stamp
+func stampOf(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get checksum of the file at path
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s to checksum: %w", path, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s to checksum: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Dynamic steps
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A dynamic step is one repetition of one block in one window
+type dynamicStep struct {
+	name    string
+	block   string
+	stamp   string
+	logPath string
+}
+
+// Get name of dynamic step
+func dynamicStepName(subDir string, block string, repetitionNum int) string {
+	return "dynamic/" + filepath.Base(subDir) + "/" + block + "_" + strconv.Itoa(repetitionNum)
+}
+
+// Get the steps of the window in subDir in the order they run, chaining each stamp from the window's files and the
+// step before it. If seed is not "", the window is seeded from another window and seed replaces its xyz file
+func getDynamicSteps(subDir string, dynPrm []DynamicParameters, seed string) ([]dynamicStep, error) {
+	xyzPath, keyPath, err := getDynamicFilePaths(subDir)
+	if err != nil {
+		return nil, err
+	}
+	xyzSum, err := fileChecksum(xyzPath)
+	if err != nil {
+		return nil, err
+	}
+	keySum, err := fileChecksum(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	prmSum, err := getKeyParametersChecksum(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stamp := stampOf("window", xyzSum, keySum, prmSum)
+	if seed != "" {
+		stamp = stampOf("window", "seed", seed, keySum, prmSum)
+	}
+	var steps []dynamicStep
+	for _, prm := range dynPrm {
+		for repNum := 0; repNum < prm.Repetitions; repNum++ {
+			stamp = stampOf("dynamic", stamp, prm.Name, strconv.Itoa(repNum), prm.NumSteps, prm.StepInterval,
+				prm.SaveInterval, prm.Ensemble, prm.Temp, prm.Pressure)
+			steps = append(steps, dynamicStep{name: dynamicStepName(subDir, prm.Name, repNum), block: prm.Name, stamp: stamp,
+				logPath: filepath.Join(subDir, prm.Name+"_"+strconv.Itoa(repNum)+".log")})
+		}
+	}
+	return steps, nil
+}
+
+// Get checksum of the parameters file the key file at keyPath uses, or "" if it names none
+func getKeyParametersChecksum(keyPath string) (string, error) {
+	key, err := readKeyFile(keyPath)
+	if err != nil {
+		return "", err
+	}
+	values, ok := key.get("parameters")
+	if !ok || len(values) == 0 {
+		return "", nil
+	}
+	prmPath := values[0]
+	if !filepath.IsAbs(prmPath) {
+		prmPath = filepath.Join(filepath.Dir(keyPath), prmPath)
+	}
+	return fileChecksum(prmPath)
+}
+
+// Check the finished steps of each of windows, in order along the lambda path, against the steps dynPrm would run now. A window with a step that was run
+// from other files or parameters, or that never finished, has its output removed so it runs again from the start,
+// along with the BAR pairs it is part of. Steps left from before the build state was kept are taken as finished.
+// Every step is expected with its stamp, so it is recorded when it finishes
+func (b *buildState) checkDynamic(dynDirectory string, windows []string, dynPrm []DynamicParameters) error {
+	// Windows are checked in order, so a window seeded from the one before it is checked after it
+	upToDate := 0
+	blockEnds := make(map[string]map[string]string)
+	for _, window := range windows {
+		subDir := filepath.Join(dynDirectory, window)
+		seed, err := b.checkSeed(subDir, blockEnds)
+		if err != nil {
+			return err
+		}
+		steps, err := getDynamicSteps(subDir, dynPrm, seed)
+		if err != nil {
+			return err
+		}
+		blockEnds[window] = make(map[string]string)
+		for _, step := range steps {
+			blockEnds[window][step.block] = step.stamp
+		}
+
+		// Find first step that ran but does not match
+		stale := ""
+		finished := 0
+		if len(steps) > 0 {
+			b.finals[window] = steps[len(steps)-1].stamp
+			b.lastSteps[steps[len(steps)-1].name] = window
+		}
+		for _, step := range steps {
+			b.expect(step.name, step.stamp)
+			_, err = os.Stat(step.logPath)
+			if err != nil {
+				continue
+			}
+			recorded := b.get(step.name)
+			if recorded == "" && !b.existed {
+				err = b.set(step.name, step.stamp)
+				if err != nil {
+					return err
+				}
+			} else if recorded != step.stamp && stale == "" {
+				stale = step.name
+			}
+			finished++
+		}
+
+		if stale != "" {
+			action := "running it again from the start"
+			if b.readOnly {
+				action = "it would run again from the start"
+			}
+			fmt.Println("Window " + window + " is out of date (" + stale + " was run from other files or parameters, " +
+				"or did not finish): " + action)
+			err = b.resetWindow(subDir)
+			if err != nil {
+				return err
+			}
+		} else if finished == len(steps) && len(steps) > 0 {
+			err = b.set("dynamic/"+window, b.finals[window])
+			if err != nil {
+				return err
+			}
+			upToDate++
+		}
+	}
+	fmt.Println(strconv.Itoa(upToDate) + " window(s) already up to date")
+	return nil
+}
+
+// Check whether every step of window has finished as checked by checkDynamic
+func (b *buildState) windowComplete(window string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	final, ok := b.finals[window]
+	return ok && b.Steps["dynamic/"+window] == final
+}
+
+// Get stamp window will have once complete, which its BAR pairs are built from. Windows not checked by checkDynamic
+// are taken as they were last recorded
+func (b *buildState) finalStamp(window string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if final, ok := b.finals[window]; ok {
+		return final
+	}
+	return b.Steps["dynamic/"+window]
+}
+
+// Remove the dynamic output of the window in subDir and forget its steps and those of BAR pairs it is part of
+func (b *buildState) resetWindow(subDir string) error {
+	window := filepath.Base(subDir)
+	if b.readOnly {
+		b.resets[window] = true
+	} else {
+		err := removeDynamicOutput(subDir)
+		if err != nil {
+			return err
+		}
+	}
+	return b.forget(func(step string) bool {
+		return isWindowStep(step, window) || isPairStep(step, window)
+	})
+}
+
+// Remove the arc, dyn, log, err and script files dynamic wrote in subDir
+func removeDynamicOutput(subDir string) error {
+	fileInfo, err := ioutil.ReadDir(subDir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %s: %w", subDir, err)
+	}
+	for _, info := range fileInfo {
+		ext := filepath.Ext(info.Name())
+		if ext == ".arc" || ext == ".dyn" || ext == ".log" || ext == ".err" || ext == ".sh" {
+			err = os.Remove(filepath.Join(subDir, info.Name()))
+			if err != nil {
+				return fmt.Errorf("failed to remove dynamic output of %s: %w", subDir, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Move the dynamic steps of window oldName to window newName, forgetting the BAR pairs of oldName as their folders are
+// named after it
+func (b *buildState) renameWindow(oldName string, newName string) error {
+	b.mu.Lock()
+	moved := make(map[string]string)
+	for step, stamp := range b.Steps {
+		if isWindowStep(step, oldName) {
+			moved["dynamic/"+newName+strings.TrimPrefix(step, "dynamic/"+oldName)] = stamp
+			delete(b.Steps, step)
+		}
+	}
+	for step, stamp := range moved {
+		b.Steps[step] = stamp
+	}
+	b.mu.Unlock()
+	return b.forget(func(step string) bool {
+		return isPairStep(step, oldName)
+	})
+}
+
+// Check whether step is a dynamic or seed step of window
+func isWindowStep(step string, window string) bool {
+	return step == "dynamic/"+window || strings.HasPrefix(step, "dynamic/"+window+"/") || step == "seed/"+window
+}
+
+// Check whether step is a BAR step of a pair window is part of
+func isPairStep(step string, window string) bool {
+	if strings.HasPrefix(step, "bar1/") || strings.HasPrefix(step, "bar2/") {
+		pair := strings.Split(step[len("bar1/"):], "_")
+		return pair[0] == window || pair[len(pair)-1] == window
+	}
+	return false
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// BAR steps
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Check the BAR1 and BAR2 steps of every pair, returning the pairs whose BAR1 and BAR2 must run. A pair whose BAR1 must
+// run has its old output removed. Every step is expected with its stamp, so it is recorded when it finishes
+func (b *buildState) checkBAR(subDirs []string, barPrm *BARParameters) ([]string, []string, error) {
+	var bar1Dirs []string
+	var bar2Dirs []string
+	for _, subDir := range subDirs {
+		pair := filepath.Base(subDir)
+		windows := strings.Split(pair, "_")
+		bar1Stamp := stampOf("bar1", b.finalStamp(windows[0]), b.finalStamp(windows[len(windows)-1]), barPrm.Temp)
+		bar2Stamp := stampOf("bar2", bar1Stamp, barPrm.FrameInterval)
+		b.expect("bar1/"+pair, bar1Stamp)
+		b.expect("bar2/"+pair, bar2Stamp)
+
+		_, err := getBAR2FilePath(subDir)
+		if err != nil || b.get("bar1/"+pair) != bar1Stamp {
+			if !b.readOnly {
+				err = removeContents(subDir, pairManifestFileName)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to remove old BAR output in %s: %w", subDir, err)
+				}
+			}
+			bar1Dirs = append(bar1Dirs, subDir)
+			bar2Dirs = append(bar2Dirs, subDir)
+			continue
+		}
+		_, err = os.Stat(filepath.Join(subDir, resultFileName))
+		if err != nil || b.get("bar2/"+pair) != bar2Stamp {
+			bar2Dirs = append(bar2Dirs, subDir)
+		}
+	}
+	fmt.Println(strconv.Itoa(len(subDirs)-len(bar2Dirs)) + " of " + strconv.Itoa(len(subDirs)) + " pair(s) already up to date")
+	return bar1Dirs, bar2Dirs, nil
+}
+
+// Get name of BAR step of kind in subDir
+func barStepName(kind JobKind, subDir string) string {
+	return string(kind) + "/" + filepath.Base(subDir)
+}
@@ -0,0 +1,157 @@
+package fep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Dynamic block of two repetitions, as the build state tests run it
+var testDynamicParams = []DynamicParameters{{Name: "prod", Order: 1, Repetitions: 2, Ensemble: "2", Temp: "298",
+	NumSteps: "5000", StepInterval: "2", SaveInterval: "1"}}
+
+// Windows along the lambda path of the build state tests
+var testWindows = []string{"vdw1.0ele1.0", "vdw1.0ele0.0"}
+
+// Write a window to dynDirectory with its xyz and key files and the logs of its first finished repetitions
+func writeTestWindow(t *testing.T, dynDirectory string, window string, finished int) {
+	subDir := filepath.Join(dynDirectory, window)
+	err := os.MkdirAll(subDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"lig.xyz": simulatedInputs["lig.xyz"], "lig.key": "ligand -1 3\n"}
+	for repNum := 0; repNum < finished; repNum++ {
+		files["prod_"+strconv.Itoa(repNum)+".log"] = "Dynamics finished\n"
+	}
+	for name, contents := range files {
+		err = ioutil.WriteFile(filepath.Join(subDir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckDynamicTakesUntrackedStepsAsFinished(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dynDirectory := filepath.Join(dir, "dynamic")
+	writeTestWindow(t, dynDirectory, "vdw1.0ele1.0", 2)
+	writeTestWindow(t, dynDirectory, "vdw1.0ele0.0", 2)
+
+	// Every repetition that ran before the build state was kept is recorded, and none is run again
+	b, err := loadBuildState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.checkDynamic(dynDirectory, testWindows, testDynamicParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, window := range []string{"vdw1.0ele1.0", "vdw1.0ele0.0"} {
+		if !b.windowComplete(window) {
+			t.Errorf("window %s is not complete", window)
+		}
+		if _, err := os.Stat(filepath.Join(dynDirectory, window, "prod_1.log")); err != nil {
+			t.Errorf("output of window %s was removed", window)
+		}
+	}
+
+	// Once recorded, a window whose key file changed runs again, and the other does not
+	err = ioutil.WriteFile(filepath.Join(dynDirectory, "vdw1.0ele0.0", "lig.key"), []byte("ligand -1 2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = loadBuildState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.checkDynamic(dynDirectory, testWindows, testDynamicParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dynDirectory, "vdw1.0ele0.0", "prod_0.log")); !os.IsNotExist(err) {
+		t.Errorf("output of changed window was kept")
+	}
+	if !b.windowComplete("vdw1.0ele1.0") {
+		t.Errorf("unchanged window is not complete")
+	}
+}
+
+func TestReadOnlyBuildStateChangesNothing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dynDirectory := filepath.Join(dir, "dynamic")
+	writeTestWindow(t, dynDirectory, "vdw1.0ele1.0", 2)
+	writeTestWindow(t, dynDirectory, "vdw1.0ele0.0", 2)
+	b, err := loadBuildState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.checkDynamic(dynDirectory, testWindows, testDynamicParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(filepath.Join(dir, buildStateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A changed window is found out of date, but keeps its output and its record
+	err = ioutil.WriteFile(filepath.Join(dynDirectory, "vdw1.0ele0.0", "lig.key"), []byte("ligand -1 2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = loadBuildState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.readOnly = true
+	err = b.checkDynamic(dynDirectory, testWindows, testDynamicParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.resets["vdw1.0ele0.0"] || b.resets["vdw1.0ele1.0"] {
+		t.Errorf("got windows to reset %v, want only the changed one", b.resets)
+	}
+	if _, err := os.Stat(filepath.Join(dynDirectory, "vdw1.0ele0.0", "prod_0.log")); err != nil {
+		t.Errorf("output of changed window was removed")
+	}
+
+	// BAR output of pairs to run again is kept too
+	subDir := filepath.Join(dir, "bar", "vdw1.0ele1.0_vdw1.0ele0.0")
+	err = os.MkdirAll(subDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(subDir, "lig.bar"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar1Dirs, bar2Dirs, err := b.checkBAR([]string{subDir}, &BARParameters{Temp: "298", FrameInterval: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bar1Dirs) != 1 || len(bar2Dirs) != 1 {
+		t.Errorf("got BAR1 to run in %q and BAR2 in %q, want both in the pair", bar1Dirs, bar2Dirs)
+	}
+	if _, err := os.Stat(filepath.Join(subDir, "lig.bar")); err != nil {
+		t.Errorf("BAR output of pair was removed")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, buildStateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(saved) {
+		t.Errorf("read-only build state was saved")
+	}
+}
@@ -0,0 +1,555 @@
+package fep
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DynamicManager manages overall process of running dynamic on multiple files with multiple parameter sets for multiple
+// iterations. The windows run are those along the lambda path of setupPrm, or of the window manifests if setupPrm is
+// nil; other folders in the dynamic directory are left alone. Windows whose finished repetitions were run from other files or parameters, or did not finish, are run
+// again from the start; up to date repetitions are skipped. Each window runs its parameter sets in order and each of
+// their repetitions in turn, independently of other windows. The preDynamic hook of a parameter set runs before the
+// first window starts it and postDynamic after the last window finishes it, and preRepetition and postRepetition run
+// around each repetition of each window. It returns a record of every job run; failed jobs also leave an .err file in
+// their directory
+func (ng *NodeGroup) DynamicManager(genPrm *GeneralParameters, setupPrm *SetupParameters, dynPrm []DynamicParameters, maxNodes int) ([]Job, error) {
+	ng.Events.emitStage(StageStarted, DynamicStage, nil)
+	jobs, err := ng.dynamicManager(genPrm, setupPrm, dynPrm, maxNodes)
+	ng.Events.emitStage(StageFinished, DynamicStage, err)
+	return jobs, err
+}
+
+// Check which windows are up to date, then run all dynamic blocks, called by DynamicManager
+func (ng *NodeGroup) dynamicManager(genPrm *GeneralParameters, setupPrm *SetupParameters, dynPrm []DynamicParameters, maxNodes int) ([]Job, error) {
+	windows, err := getLambdaPath(genPrm.TargetDirectory, setupPrm)
+	if err != nil {
+		return nil, err
+	}
+	build, err := loadBuildState(genPrm.TargetDirectory)
+	if err != nil {
+		return nil, err
+	}
+	err = ng.checkDynamic(genPrm, windows, dynPrm, build)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		ng.build = nil
+	}()
+	return ng.runDynamic(genPrm, windows, dynPrm, maxNodes)
+}
+
+// Find out which of windows are up to date, and have the node group record repetitions in build as they finish
+func (ng *NodeGroup) checkDynamic(genPrm *GeneralParameters, windows []string, dynPrm []DynamicParameters, build *buildState) error {
+	fmt.Println("\nChecking dynamic windows against the build state...")
+	err := build.checkDynamic(filepath.Join(genPrm.TargetDirectory, "dynamic"), windows, dynPrm)
+	if err != nil {
+		return err
+	}
+	ng.build = build
+	return nil
+}
+
+// Run all dynamic blocks in order on every one of windows that is not up to date. Each window goes through its blocks and
+// repetitions as its own chain of jobs, each job starting as soon as the one before it in the window has finished,
+// without waiting for other windows
+func (ng *NodeGroup) runDynamic(genPrm *GeneralParameters, windows []string, dynPrm []DynamicParameters, maxNodes int) ([]Job, error) {
+
+	start := time.Now()
+
+	// Get repetitions each window still has to run
+	dynDirectory := filepath.Join(genPrm.TargetDirectory, "dynamic")
+	chains, err := getDynamicChains(dynDirectory, windows, dynPrm)
+	if err != nil {
+		return nil, err
+	}
+	if len(chains) == 0 {
+		fmt.Println("\nSkipping AutoDynamic: every repetition is already complete for all subdirectories")
+		return nil, nil
+	}
+
+	// Get nodes to run dynamic on, unless a scheduler grants them as jobs go
+	maxNodes, err = ng.findFreeNodes(genPrm, maxNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Queue every job of every window, each window on one node
+	blocks := newBlockHooks(ng, genPrm, dynPrm)
+	for i := range chains {
+		chains[i].nodeIndex = -1
+		for j := range chains[i].jobs {
+			chains[i].nodeIndex = ng.assignNode(&chains[i].jobs[j], i, maxNodes)
+			ng.Events.emitJob(JobQueued, &chains[i].jobs[j])
+			if j == 0 || chains[i].blocks[j] != chains[i].blocks[j-1] {
+				blocks.left[chains[i].blocks[j]]++
+			}
+		}
+	}
+
+	// Create new wait group to determine when all chains have finished
+	wg := sync.WaitGroup{}
+	running := newRunningJobs()
+	fmt.Println("\nBeginning AutoDynamic run on " + strconv.Itoa(len(chains)) + " window(s)...\n")
+
+	// Get seeds windows wait for before they start
+	seeds := ng.getWindowSeeds(dynDirectory, dynPrm, chains)
+	for i := range chains {
+		wg.Add(1)
+		go ng.runChain(genPrm, dynPrm, &chains[i], blocks, seeds, running, &wg)
+	}
+
+	// Follow progress in the logs until all chains have finished
+	stopMonitor := make(chan struct{})
+	monitorDone := make(chan struct{})
+	go ng.monitorDynamic(genPrm, running, stopMonitor, monitorDone)
+
+	wg.Wait()
+	close(stopMonitor)
+	<-monitorDone
+
+	var jobs []Job
+	for _, chain := range chains {
+		jobs = append(jobs, chain.jobs...)
+	}
+	if blocks.err != nil {
+		return jobs, blocks.err
+	}
+
+	end := time.Now()
+	fmt.Println("\nAll AutoDynamic runs complete in " + end.Sub(start).String())
+	fmt.Println()
+
+	return jobs, nil
+}
+
+// Repetitions of one window still to run, in order
+type dynamicChain struct {
+	subDir string
+	// jobs to run, and the index in the dynamic parameters of the block each is a repetition of
+	jobs   []Job
+	blocks []int
+	// index of the node the window runs on, or -1 when a scheduler grants nodes
+	nodeIndex int
+}
+
+// Get the repetitions of each of windows in dynDirectory whose log does not exist yet, in the order of the blocks then of
+// the repetitions. Windows with nothing to run are left out
+func getDynamicChains(dynDirectory string, windows []string, dynPrm []DynamicParameters) ([]dynamicChain, error) {
+	var chains []dynamicChain
+	for _, window := range windows {
+		chain := dynamicChain{subDir: filepath.Join(dynDirectory, window)}
+		for i := range dynPrm {
+			// simulation time each job covers, in ns (steps are in fs)
+			numSteps, _ := strconv.ParseFloat(dynPrm[i].NumSteps, 64)
+			stepInterval, _ := strconv.ParseFloat(dynPrm[i].StepInterval, 64)
+			ns := numSteps * stepInterval / 1e6
+			for repNum := 0; repNum < dynPrm[i].Repetitions; repNum++ {
+				logPath := filepath.Join(chain.subDir, dynPrm[i].Name+"_"+strconv.Itoa(repNum)+".log")
+				_, err := os.Stat(logPath)
+				if err == nil {
+					continue
+				}
+				chain.jobs = append(chain.jobs, Job{Kind: DynamicJob, Dir: chain.subDir, Block: dynPrm[i].Name, Repetition: repNum, Ns: ns})
+				chain.blocks = append(chain.blocks, i)
+			}
+		}
+		if len(chain.jobs) > 0 {
+			chains = append(chains, chain)
+		}
+	}
+	return chains, nil
+}
+
+// Run the jobs of chain one after the other on its node or, when a scheduler grants nodes, on a node granted for each
+// job. Once a job fails, the jobs after it in the window are not run, as each continues from the one before it. A
+// window waits for its seed among seeds before it starts, and seeds the windows seeded from it as it finishes blocks
+func (ng *NodeGroup) runChain(genPrm *GeneralParameters, dynPrm []DynamicParameters, chain *dynamicChain, blocks *blockHooks, seeds []*windowSeed,
+	running *runningJobs, wg *sync.WaitGroup) {
+
+	// subtract one from wg count when finished
+	defer wg.Done()
+
+	var skipErr error
+	for _, seed := range seeds {
+		if seed.subDir == chain.subDir {
+			<-seed.ready
+			skipErr = seed.err
+		}
+	}
+	for i := range chain.jobs {
+		job := &chain.jobs[i]
+		prm := &dynPrm[chain.blocks[i]]
+		lastOfBlock := i == len(chain.jobs)-1 || chain.blocks[i+1] != chain.blocks[i]
+
+		if skipErr == nil {
+			skipErr = blocks.enter(chain.blocks[i])
+		}
+		if skipErr != nil {
+			ng.skipJob(job, skipErr)
+		} else {
+			// Count MD steps left in the window after this job, for progress estimates
+			stepsAfter := 0
+			for _, block := range chain.blocks[i+1:] {
+				numSteps, _ := strconv.Atoi(dynPrm[block].NumSteps)
+				stepsAfter += numSteps
+			}
+
+			jobWG := sync.WaitGroup{}
+			jobWG.Add(1)
+			ng.launch(job, chain.nodeIndex, &jobWG, func(n *Node, wg *sync.WaitGroup) {
+				running.start(job, n, prm, stepsAfter)
+				ng.dynamic(n, genPrm, prm, chain.subDir, job.Repetition, job, wg)
+			})
+			jobWG.Wait()
+			running.finish(chain.subDir)
+			if job.Err != nil {
+				skipErr = errors.New("not run as " + prm.Name + " #" + strconv.Itoa(job.Repetition+1) + " of the window failed")
+			}
+		}
+
+		if lastOfBlock {
+			ng.seedFrom(seeds, chain.subDir, prm, dynPrm, skipErr)
+			blocks.leave(chain.blocks[i])
+		}
+	}
+}
+
+// Runs the preDynamic hook of each block before the first window starts it and the postDynamic hook once the last
+// window has finished it, as windows go through the blocks on their own
+type blockHooks struct {
+	ng     *NodeGroup
+	genPrm *GeneralParameters
+	dynPrm []DynamicParameters
+
+	mu sync.Mutex
+	// started is set for blocks whose preDynamic hook has run, and left counts the windows yet to finish each block
+	started []bool
+	left    []int
+	// err is set once a hook fails, stopping every window
+	err error
+}
+
+// Create the hooks of the blocks in dynPrm, with no window counted yet
+func newBlockHooks(ng *NodeGroup, genPrm *GeneralParameters, dynPrm []DynamicParameters) *blockHooks {
+	return &blockHooks{ng: ng, genPrm: genPrm, dynPrm: dynPrm, started: make([]bool, len(dynPrm)), left: make([]int, len(dynPrm))}
+}
+
+// Run the preDynamic hook of block i if no window has started it yet. Returns an error if a hook failed
+func (h *blockHooks) enter(i int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil || h.started[i] {
+		return h.err
+	}
+	h.started[i] = true
+	fmt.Println("\nBeginning AutoDynamic with parameter set \"" + h.dynPrm[i].Name + "\" for " + strconv.Itoa(h.dynPrm[i].Repetitions) + " repetition(s)...")
+	h.err = runHook(h.genPrm, "preDynamic", h.ng.hooks().PreDynamic, h.env(i)...)
+	return h.err
+}
+
+// Count a window as finished with block i, running the postDynamic hook of the block once every window has finished it
+func (h *blockHooks) leave(i int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.left[i]--
+	if h.left[i] > 0 || !h.started[i] || h.err != nil {
+		return
+	}
+	fmt.Println("\nAutoDynamic with parameter set " + h.dynPrm[i].Name + " finished on every window")
+	h.err = runHook(h.genPrm, "postDynamic", h.ng.hooks().PostDynamic, h.env(i)...)
+}
+
+// Get environment variables describing block i for its hooks
+func (h *blockHooks) env(i int) []string {
+	return []string{"GOFEP_BLOCK=" + h.dynPrm[i].Name, "GOFEP_REPETITIONS=" + strconv.Itoa(h.dynPrm[i].Repetitions)}
+}
+
+// Run dynamic in subDir on node n, recording the outcome in job
+func (ng *NodeGroup) dynamic(n *Node, genPrm *GeneralParameters, dynPrm *DynamicParameters, subDir string, repetitionNum int, job *Job, wg *sync.WaitGroup) {
+
+	// subtract one from wg count when finished
+	defer wg.Done()
+
+	job.Started = time.Now()
+	ng.Events.emitJob(JobStarted, job)
+	defer func() {
+		job.Finished = time.Now()
+		ng.Events.emitJobEnd(job)
+	}()
+
+	// Get name of xyz and key in the directory and delete previous log/arc/dyn if unneeded
+	xyzPath, keyPath, err := getDynamicFilePaths(subDir)
+	if err != nil {
+		job.Err = err
+		fmt.Println("Error encountered in subdirectory " + subDir + ": " + err.Error())
+		return
+	}
+
+	// Run hook before this repetition of the window, skipping it if the hook fails
+	hookEnv := windowHookEnv(dynPrm, subDir, xyzPath, keyPath, repetitionNum, n)
+	err = runHook(genPrm, "preRepetition", ng.hooks().PreRepetition, hookEnv...)
+	if err != nil {
+		job.Err = err
+		fmt.Println("Error encountered in subdirectory " + subDir + ": " + err.Error())
+		return
+	}
+
+	// Create bash script to run dynamic
+	repetitionNumStr := strconv.Itoa(repetitionNum)
+	job.Script, err = createTempDynamicScript(subDir, xyzPath, keyPath, genPrm, dynPrm, n, repetitionNumStr)
+	if err != nil {
+		job.Err = err
+		fmt.Println("Error encountered in subdirectory " + subDir + ": " + err.Error())
+		return
+	}
+
+	// run newly created shell script
+	job.Output, err = ng.backend().Run(job.Script)
+	if err != nil {
+		job.Err = err
+		fmt.Print("Error encountered on file in subdirectory " + filepath.Dir(xyzPath) + " using node " + n.Name + ": ")
+		fmt.Println(err)
+
+		// Write output to file
+		outFilePath := filepath.Join(subDir, dynPrm.Name+repetitionNumStr+".err")
+		err = writeFile(outFilePath, string(job.Output))
+		if err != nil {
+			fmt.Println("failed to create error log: " + err.Error())
+		}
+		fmt.Println()
+
+	} else {
+		fmt.Println("Dynamic finished on file in subdirectory " + filepath.Dir(xyzPath) + " using node " + n.Name)
+
+		// Run hook after this repetition of the window, failing the job if the hook fails
+		err = runHook(genPrm, "postRepetition", ng.hooks().PostRepetition, hookEnv...)
+		if err != nil {
+			job.Err = err
+			fmt.Println("Error encountered in subdirectory " + subDir + ": " + err.Error())
+			return
+		}
+		ng.build.done(dynamicStepName(subDir, dynPrm.Name, repetitionNum))
+		if ng.onWindowDone != nil && ng.build.windowComplete(filepath.Base(subDir)) {
+			ng.onWindowDone(filepath.Base(subDir), n)
+		}
+	}
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Helper functions
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func createTempDynamicScript(subDir string, xyzPath string, keyPath string, genPrm *GeneralParameters, dynPrm *DynamicParameters, n *Node, repetitionNum string) (string, error) {
+	scriptName := dynPrm.Name + "_" + repetitionNum + ".sh"
+	// Write temp bash script in current dir to check node status
+	tempFilePath := filepath.Join(subDir, scriptName)
+
+	// get log path
+	logPath := filepath.Join(filepath.Dir(xyzPath), dynPrm.Name+"_"+repetitionNum+".log")
+
+	// Write file contents
+	script, err := getDynamicScript(xyzPath, keyPath, logPath, genPrm, dynPrm, n)
+	if err != nil {
+		return "", err
+	}
+	err = writeFile(tempFilePath, script)
+	if err != nil {
+		return "", err
+	}
+
+	return tempFilePath, nil
+}
+
+// Get contents of bash script that runs dynamic on node n
+func getDynamicScript(xyzPath string, keyPath string, logPath string, genPrm *GeneralParameters, dynPrm *DynamicParameters, n *Node) (string, error) {
+	// Start with header that logs into node and sources files
+	header, openMMHome, err := getNodeScriptHeader(genPrm, n)
+	if err != nil {
+		return "", err
+	}
+	// Write command to launch dynamic then end here document
+	return header + getDynamicLaunchCommand(openMMHome, xyzPath, keyPath, logPath, dynPrm) + "END", nil
+}
+
+// Get ensemble dependent command to launch tinker dynamic
+func getDynamicLaunchCommand(openMMHome string, xyzPath string, keyPath string, logPath string, dynPrm *DynamicParameters) string {
+	basecmd := "\t" + filepath.Join(openMMHome, "dynamic_omm.x") + " " + xyzPath + " -k " + keyPath + " " + dynPrm.NumSteps +
+		" " + dynPrm.StepInterval + " " + dynPrm.SaveInterval + " " + dynPrm.Ensemble
+	var cmd string
+	switch dynPrm.Ensemble {
+	case "1":
+		cmd = basecmd + " N > " + logPath + " \n"
+	case "2":
+		cmd = basecmd + " " + dynPrm.Temp + " N > " + logPath + " \n"
+	case "3":
+		cmd = basecmd + " " + dynPrm.Pressure + " N > " + logPath + " \n"
+	case "4":
+		cmd = basecmd + " " + dynPrm.Temp + " " + dynPrm.Pressure + " N > " + logPath + " \n"
+	}
+
+	return cmd
+}
+
+// Get xyz and key names from subdirectory and check that there aren't any issues with them
+// If arc, dyn files exist, set correct permissions
+func getDynamicFilePaths(subDir string) (string, string, error) {
+	fileInfo, err := ioutil.ReadDir(subDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read directory %s: %w", subDir, err)
+	}
+
+	// Initialize variables to track name and number of xyz and key files in directory
+	var xyzPath string
+	numXYZ := 0
+	var keyPath string
+	numKEY := 0
+	var arcPath string
+	var dynPath string
+
+	// Iterate through all files in directory
+	for i := 0; i < len(fileInfo); i++ {
+		// get file ext
+		fileExt := filepath.Ext(fileInfo[i].Name())
+		if fileExt == ".xyz" {
+			xyzPath = filepath.Join(subDir, fileInfo[i].Name())
+			numXYZ++
+		} else if fileExt == ".key" {
+			keyPath = filepath.Join(subDir, fileInfo[i].Name())
+			numKEY++
+		} else if fileExt == ".arc" {
+			arcPath = filepath.Join(subDir, fileInfo[i].Name())
+			err = os.Chmod(arcPath, octalPermissions)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to update file permissions for arc file %s: %w", arcPath, err)
+			}
+		} else if fileExt == ".dyn" {
+			dynPath = filepath.Join(subDir, fileInfo[i].Name())
+			err = os.Chmod(dynPath, octalPermissions)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to update permissions for dyn file %s: %w", dynPath, err)
+			}
+		}
+	}
+
+	// Check for deficiencies with directory
+	if numXYZ != 1 || numKEY != 1 {
+		return "", "", errors.New("missing or multiple XYZ or KEY file(s) in directory " + subDir)
+	}
+
+	return xyzPath, keyPath, nil
+}
+
+/*// remove log, arc, dyn files from a directory
+func removeDynamicOutputFiles(dir string) {
+	// read directory
+	fileInfo, err := ioutil.ReadDir(dir)
+	if err != nil {
+		fmt.Println("Failed to read directory to remove arc/log/dyn files from")
+		log.Fatal(err)
+	}
+	// iterate through all files
+	for i := 0; i < len(fileInfo); i++ {
+		// get file extension
+		fileExt := strings.Split(fileInfo[i].Name(), ".")[1]
+		// if ext designates it as a dynamic output file...
+		if fileExt == "arc" || fileExt == "dyn" || fileExt == "log" {
+			// ...delete it
+			filePath := filepath.Join(dir, fileInfo[i].Name())
+			err = os.Remove(filePath)
+			if err != nil {
+				fmt.Println("Failed to remove arc/dyn/log files from directory: " + dir)
+				log.Fatal(err)
+			}
+		}
+	}
+}*/
+
+// Currently non-functional code to automatically generate scripts to kill all dynamic jobs
+
+/*func writeKillAllScript(genPrm *generalParameters, dynPrm *dynamicParameters, nodeIndices []int, iteration int, ng *nodeGroup) {
+	scriptPath := filepath.Join(genPrm.targetDirectory,"temp",dynPrm.name + "_" + strconv.Itoa(iteration) + "_abortAll.sh")
+	f, err := os.Create(scriptPath)
+	if err != nil {
+		fmt.Println("Failed to create kill all script")
+		log.Fatal(err)
+	}
+	err = os.Chmod(scriptPath, octalPermissions)
+	if err != nil {
+		fmt.Println("Failed to change permissions of kill all script")
+		log.Fatal(err)
+	}
+
+
+	// create struct to store set of structs associating nodes and their running gpu processes
+	var proc processTrackerHolder
+	proc.processTrackers = make([]processTracker, len(nodeIndices))
+
+	wg2 := sync.WaitGroup{}
+	// get pids
+	for i, nodeIndex := range nodeIndices {
+		wg2.Add(1)
+		go getPIDs(&proc, &ng.nodes[nodeIndex], genPrm, i, &wg2)
+		proc.processTrackers[i].nodeName = ng.nodes[nodeIndex].name
+	}
+	wg2.Wait()
+
+	// Start with header
+	_, err = f.WriteString("#!/bin/bash")
+
+	for _, processTracker := range proc.processTrackers {
+		// Begin here document (all following command will be performed inside node)
+		_, err = f.WriteString("ssh -o \"StrictHostKeyChecking no\" " + processTracker.nodeName + " << END\n")
+
+		for _, pid := range processTracker.pids {
+			_, err = f.WriteString("kill " + pid + "\n")
+		}
+		_, err = f.WriteString("echo \"Process(es) on " + processTracker.nodeName + " killed\" \n")
+
+		// end here document
+		_, err = f.WriteString("END\n\n")
+	}
+}
+
+type processTrackerHolder struct {
+	processTrackers []processTracker
+}
+
+type processTracker struct {
+	nodeName string
+	pids []string
+}
+
+// Get tinker PID(s) on node
+func getPIDs(proc *processTrackerHolder,n *node, genPrm *generalParameters, i int, wg2 *sync.WaitGroup) {
+	var pids []string
+
+	tempFilePath := filepath.Join(genPrm.targetDirectory,"temp",nodeCheckScriptName)
+	// ssh into node, run "nvidia-smi", and capture output
+	out, err := exec.Command("sh", tempFilePath, n.name).CombinedOutput()
+	if err != nil {
+		fmt.Print("error encountered on " + n.name + ": ")
+		fmt.Print(err)
+		fmt.Println("\nout = " + string(out))
+		fmt.Println("The most likely cause of this error is that you did not ssh into bme-nova before running gofep, " +
+			"but it is also possible the node is down. Check node manually to verify.")
+	}
+	outString := string(out)
+	tokens := strings.Fields(outString)
+	for i,token := range tokens {
+		if strings.Count(token, "dynamic_omm") > 0 {
+			pids = append(pids,tokens[i-2])
+		}
+
+	}
+	proc.processTrackers[i].pids = pids
+
+	wg2.Done()
+}*/
@@ -0,0 +1,290 @@
+package fep
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DynamicSetup creates a folder in the dynamic directory for each combination of lambdas in the setup parameters, and
+// populates it with an xyz file and a key file with the lambdas set. The preSetup and postSetup hooks run around it.
+// Stage events are sent to events. Hooks and events may both be nil
+func DynamicSetup(genPrm *GeneralParameters, setupPrm *SetupParameters, hooks *HookParameters, events *Emitter) error {
+	if hooks == nil {
+		hooks = &HookParameters{}
+	}
+	events.emitStage(StageStarted, SetupStage, nil)
+	err := runHook(genPrm, "preSetup", hooks.PreSetup)
+	if err == nil {
+		err = dynamicSetup(genPrm, setupPrm)
+	}
+	if err == nil {
+		err = runHook(genPrm, "postSetup", hooks.PostSetup)
+	}
+	events.emitStage(StageFinished, SetupStage, err)
+	return err
+}
+
+// Set up dynamic folders, called by DynamicSetup
+func dynamicSetup(genPrm *GeneralParameters, setupPrm *SetupParameters) error {
+
+	// get sys time
+	start := time.Now()
+
+	fmt.Println("\nBeginning setup in directory: " + genPrm.TargetDirectory)
+
+	// Copy Prm File into directory in its own folder
+	fmt.Println("\nSetting up Parameters Folder...")
+	absPrmPath, err := copyPrmFile(genPrm.PrmPath, genPrm.TargetDirectory)
+	if err != nil {
+		return err
+	}
+
+	// Get folder names to store xyz and key files
+	fmt.Println("\nCalculating Folder Names...")
+	dynamicFolders, err := GetDynamicFolderNames(setupPrm)
+	if err != nil {
+		return err
+	}
+	if setupPrm.Generated {
+		printSchedule(os.Stdout, setupPrm)
+	}
+
+	// Get inputs of windows that differ from the rest
+	overrides, err := getWindowOverrides(setupPrm, dynamicFolders)
+	if err != nil {
+		return err
+	}
+	prmPaths, err := copyWindowPrmFiles(genPrm.TargetDirectory, absPrmPath, overrides)
+	if err != nil {
+		return err
+	}
+	for _, o := range overrides {
+		if o.String() != "" {
+			fmt.Println("Window " + o.Window + " overrides " + o.String())
+		}
+	}
+
+	// Rename folders of the same windows named by older versions
+	err = renameLegacyWindows(genPrm.TargetDirectory, dynamicFolders, filepath.Base(genPrm.KeyPath), len(setupPrm.Rst) > 0)
+	if err != nil {
+		return err
+	}
+
+	// Create folders to store xyz and key files
+	fmt.Println("\nCreating Folders...")
+	err = createDynamicFolders(genPrm.TargetDirectory, dynamicFolders)
+	if err != nil {
+		return err
+	}
+
+	// Populate folders with xyz files
+	fmt.Println("\nPopulating Folders with XYZ files...")
+	err = createXYZFiles(genPrm.TargetDirectory, genPrm.XYZPath, dynamicFolders, setupPrm, overrides)
+	if err != nil {
+		return err
+	}
+
+	// Populate folders with key files
+	fmt.Println("\nPopulating Folders with KEY files...")
+	err = createKeyFiles(genPrm.TargetDirectory, genPrm.KeyPath, dynamicFolders, setupPrm, prmPaths, overrides)
+	if err != nil {
+		return err
+	}
+
+	// Describe each window in its folder
+	fmt.Println("\nWriting window manifests...")
+	err = createWindowManifests(genPrm.TargetDirectory, dynamicFolders, setupPrm, genPrm, overrides)
+	if err != nil {
+		return err
+	}
+
+	end := time.Now()
+	fmt.Println("\nSetup finished in " + end.Sub(start).String())
+	fmt.Println()
+	return nil
+}
+
+// GetDynamicFolderNames calculates folder names for dynamic files based on vdw/ele parameters, and restraints if set.
+// Lambdas are written in full (e.g. vdw0.125ele0.0), so only windows with the same lambdas would share a folder, which
+// is an error
+func GetDynamicFolderNames(prm *SetupParameters) ([]string, error) {
+
+	// Create array to save coeff combinations for usage in file and directory name
+	numDirs := len(prm.Vdw)
+	dynamicFolders := make([]string, numDirs)
+
+	// Iterate through all vdw/ele params and write combination to dynamicFolder array
+	for i := 0; i < numDirs; i++ {
+		rst := ""
+		if len(prm.Rst) > 0 {
+			rst = prm.Rst[i]
+		}
+		name, err := getWindowName(prm.Vdw[i], prm.Ele[i], rst)
+		if err != nil {
+			return nil, err
+		}
+		dynamicFolders[i] = name
+	}
+
+	return dynamicFolders, checkWindowNames(dynamicFolders)
+}
+
+// Copy parameters file from current location to target directory
+func copyPrmFile(sourcePrmPath string, targetDirectory string) (string, error) {
+
+	// If source prm path is not absolute, redefine from target directory
+	sourcePrmPath, err := filepath.Abs(sourcePrmPath)
+	if err != nil {
+		return "", fmt.Errorf("could not compute absolute path to parameters file location \"%s\" specified in general section of INI: %w", sourcePrmPath, err)
+	}
+
+	// Get parameter name from sourcePrmPath
+	prmName := filepath.Base(sourcePrmPath)
+
+	// Create folder
+	folderPath := filepath.Join(targetDirectory, "parameters")
+	err = os.MkdirAll(folderPath, octalPermissions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create directory to store parameters file %s: %w", folderPath, err)
+	}
+
+	// Create new prm file
+	newPrmPath := filepath.Join(folderPath, prmName)
+	err = copyFile(newPrmPath, sourcePrmPath)
+	if err != nil {
+		return "", err
+	}
+
+	return newPrmPath, nil
+}
+
+// Create subdirectories in dynamic folder based on folder names
+func createDynamicFolders(directory string, dynamicFolders []string) error {
+
+	// Iterate through all folders to be created in ~/dynamic/
+	for _, folderName := range dynamicFolders {
+
+		// Create folder
+		folderPath := filepath.Join(directory, "dynamic", folderName)
+		err := os.MkdirAll(folderPath, octalPermissions)
+		if err != nil {
+			return fmt.Errorf("failed to create dynamic folder %s: %w", folderPath, err)
+		}
+	}
+	return nil
+}
+
+// Populate dynamic folders with xyz files
+func createXYZFiles(directory string, sourcePath string, dynamicFolders []string, prm *SetupParameters, overrides []WindowOverride) error {
+
+	// If source path is not absolute already, redefine from CWD
+	sourcePath, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return fmt.Errorf("could not compute absolute path to xyz file location \"%s\" specified in general block of INI: %w", sourcePath, err)
+	}
+
+	// Get name of xyz file
+	xyzName := filepath.Base(sourcePath)
+
+	// Iterate through all folders in ~/dynamic/
+	for i := 0; i < len(dynamicFolders); i++ {
+		// copy xyz file to dir, under the same name if the window has its own. Seeded windows keep the xyz file they were
+		// seeded with, as dynamic replaces it when their seed changes
+		destPath := filepath.Join(directory, "dynamic", dynamicFolders[i], xyzName)
+		if _, err := os.Stat(destPath); err == nil && isSeeded(prm, overrides, i) {
+			continue
+		}
+		windowPath := sourcePath
+		if overrides[i].XYZ != "" {
+			windowPath = overrides[i].XYZ
+		}
+		err := copyFile(destPath, windowPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Populate dynamic folders with key files
+func createKeyFiles(directory string, sourcePath string, dynamicFolders []string, prm *SetupParameters, prmPaths []string, overrides []WindowOverride) error {
+
+	// If source prm path is not absolute already, redefine from target directory
+	sourcePath, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return fmt.Errorf("could not compute absolute path to key file location \"%s\" specified in general block of INI: %w", sourcePath, err)
+	}
+
+	// Iterate through all folders in ~/dynamic/
+	for i := 0; i < len(dynamicFolders); i++ {
+		err = createKeyFile(directory, sourcePath, dynamicFolders[i], prm, i, prmPaths[i], overrides[i].KeyLines)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write key file for window i to its dynamic folder
+func createKeyFile(directory string, sourcePath string, dynamicFolder string, prm *SetupParameters, i int, absPrmPath string, keyLines [][]string) error {
+
+	// Build key file of window from source key file
+	key, err := getWindowKeyFile(sourcePath, dynamicFolder, prm, i, absPrmPath, keyLines)
+	if err != nil {
+		return err
+	}
+
+	// Get folder path
+	folderPath := filepath.Join(directory, "dynamic", dynamicFolder)
+	keyPath := filepath.Join(folderPath, filepath.Base(sourcePath))
+
+	// Create new key file
+	newKeyFile, err := os.Create(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to create new key file %s: %w", keyPath, err)
+	}
+	_, err = newKeyFile.WriteString(key.String())
+	if err != nil {
+		newKeyFile.Close()
+		return fmt.Errorf("failed to write key file %s: %w", keyPath, err)
+	}
+	// Close new key file
+	err = newKeyFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close key %s: %w", keyPath, err)
+	}
+	return nil
+}
+
+// Get the key file of window i: the source key file with its parameters, lambdas and restraint force set for the
+// window, adding the keywords if they are missing, and then keyLines set, or added for keywords that can be repeated
+func getWindowKeyFile(sourcePath string, dynamicFolder string, prm *SetupParameters, i int, absPrmPath string, keyLines [][]string) (*keyFile, error) {
+
+	// Read source key file
+	key, err := readKeyFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set parameters (which Tinker expects first), lambdas and restraint force. Restraint groups can't be made up, so
+	// restraints need a restrain-groups line in the source key file
+	key.set("parameters", true, absPrmPath)
+	key.set("vdw-lambda", false, prm.Vdw[i])
+	key.set("ele-lambda", false, prm.Ele[i])
+	if len(prm.Rst) > 0 {
+		err = key.setValue("restrain-groups", 2, prm.Rst[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to set restraint of window %s in key file %s: %w", dynamicFolder, sourcePath, err)
+		}
+	}
+	for _, line := range keyLines {
+		if isRepeatableKeyword(line[0]) {
+			key.add(line[0], line[1:]...)
+		} else {
+			key.set(line[0], false, line[1:]...)
+		}
+	}
+	return key, nil
+}
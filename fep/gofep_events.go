@@ -0,0 +1,175 @@
+package fep
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Events: contains the typed progress events emitted by setup and the managers, and the emitter that delivers them to
+// callbacks, channels and JSON lines writers
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// EventType identifies what happened
+type EventType string
+
+const (
+	// JobQueued is emitted when a job has been assigned a node but not yet started
+	JobQueued EventType = "job_queued"
+	// JobStarted is emitted when a job starts preparing its script
+	JobStarted EventType = "job_started"
+	// JobProgress is emitted periodically while a dynamic job runs, with Progress set to the fraction of it complete
+	JobProgress EventType = "job_progress"
+	// JobFinished is emitted when a job completes successfully
+	JobFinished EventType = "job_finished"
+	// JobFailed is emitted when a job fails, with Error set
+	JobFailed EventType = "job_failed"
+	// StageStarted is emitted when a stage (setup, dynamic, bar setup, bar1, bar2) begins
+	StageStarted EventType = "stage_started"
+	// StageFinished is emitted when a stage ends, with Error set if it could not continue
+	StageFinished EventType = "stage_finished"
+	// NodeStatusChanged is emitted when a node is first seen or changes between free and busy, with Status set
+	NodeStatusChanged EventType = "node_status_changed"
+	// ResultsWritten is emitted when free energies have been written to results.txt, with Results set and Dir set to
+	// the path of the file
+	ResultsWritten EventType = "results_written"
+)
+
+// Stage names used in stage events
+const (
+	SetupStage    string = "setup"
+	DynamicStage  string = "dynamic"
+	BARSetupStage string = "bar setup"
+	BAR1Stage     string = "bar1"
+	BAR2Stage     string = "bar2"
+)
+
+// Event is a single progress event. Only the fields relevant to its type are set
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Stage is set for stage events
+	Stage string `json:"stage,omitempty"`
+	// Job fields are set for job events. Repetition counts from 0
+	Job        string  `json:"job,omitempty"`
+	Kind       JobKind `json:"kind,omitempty"`
+	Dir        string  `json:"dir,omitempty"`
+	Block      string  `json:"block,omitempty"`
+	Repetition int     `json:"repetition,omitempty"`
+	Ns         float64 `json:"ns,omitempty"`
+	Progress   float64 `json:"progress,omitempty"`
+	// NsPerDay and ETASeconds are set for progress events once throughput is known
+	NsPerDay   float64 `json:"ns_per_day,omitempty"`
+	ETASeconds float64 `json:"eta_seconds,omitempty"`
+	// Node is set for job and node status events
+	Node string `json:"node,omitempty"`
+	// Status is "free" or "busy" for node status events
+	Status string `json:"status,omitempty"`
+	// Result is set when a BAR2 job finishes
+	Result *PairResult `json:"result,omitempty"`
+	// Results is set when results are written
+	Results *Results `json:"results,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Emitter delivers events to subscribers in the order they were emitted. A nil *Emitter discards all events, so
+// callers that don't want events never need to create one
+type Emitter struct {
+	mu       sync.Mutex
+	handlers []func(Event)
+	channels []chan Event
+}
+
+// NewEmitter creates an emitter with no subscribers
+func NewEmitter() *Emitter {
+	return &Emitter{}
+}
+
+// Subscribe registers handler to be called with every event. Handlers are called one at a time from the goroutine
+// that emitted the event, so they should return quickly
+func (e *Emitter) Subscribe(handler func(Event)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers = append(e.handlers, handler)
+}
+
+// Channel returns a channel that receives every event, buffered to size. Sends block once the buffer is full, so the
+// channel must be drained for the run to make progress. It is closed by Close
+func (e *Emitter) Channel(size int) <-chan Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ch := make(chan Event, size)
+	e.channels = append(e.channels, ch)
+	return ch
+}
+
+// Close closes all channels returned by Channel. No events may be emitted after Close
+func (e *Emitter) Close() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, ch := range e.channels {
+		close(ch)
+	}
+	e.channels = nil
+}
+
+// Emit sends ev to all subscribers, setting its time to now if unset
+func (e *Emitter) Emit(ev Event) {
+	if e == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, handler := range e.handlers {
+		handler(ev)
+	}
+	for _, ch := range e.channels {
+		ch <- ev
+	}
+}
+
+// JSONLinesHandler returns a handler that writes each event to w as one line of JSON. Write errors are ignored so
+// a broken writer never stops a run
+func JSONLinesHandler(w io.Writer) func(Event) {
+	encoder := json.NewEncoder(w)
+	return func(ev Event) {
+		_ = encoder.Encode(ev)
+	}
+}
+
+// Emit a stage event. err is only reported for StageFinished
+func (e *Emitter) emitStage(t EventType, stage string, err error) {
+	ev := Event{Type: t, Stage: stage}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	e.Emit(ev)
+}
+
+// Emit a job event describing job
+func (e *Emitter) emitJob(t EventType, job *Job) {
+	ev := Event{Type: t, Job: job.Name(), Kind: job.Kind, Dir: job.Dir, Block: job.Block, Repetition: job.Repetition, Ns: job.Ns,
+		Node: job.Node, Result: job.Result}
+	if job.Err != nil {
+		ev.Error = job.Err.Error()
+	}
+	e.Emit(ev)
+}
+
+// Emit JobFinished or JobFailed for a job that has ended
+func (e *Emitter) emitJobEnd(job *Job) {
+	if job.Err != nil {
+		e.emitJob(JobFailed, job)
+	} else {
+		e.emitJob(JobFinished, job)
+	}
+}
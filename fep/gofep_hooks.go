@@ -0,0 +1,86 @@
+package fep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Hooks: contains functions that run the user's shell commands before and after each part of a run
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Run command as the hook called name with sh in the target directory, printing its output. Environment variables
+// describing the run are set along with env. An empty command does nothing. Returns an error if the command fails
+func runHook(genPrm *GeneralParameters, name string, command string, env ...string) error {
+	if command == "" {
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = genPrm.TargetDirectory
+	cmd.Env = append(os.Environ(), "GOFEP_HOOK="+name,
+		"GOFEP_TARGET_DIRECTORY="+genPrm.TargetDirectory,
+		"GOFEP_DYNAMIC_DIR="+filepath.Join(genPrm.TargetDirectory, "dynamic"),
+		"GOFEP_BAR_DIR="+filepath.Join(genPrm.TargetDirectory, "bar"),
+		"GOFEP_INPUT_XYZ="+genPrm.XYZPath,
+		"GOFEP_INPUT_KEY="+genPrm.KeyPath,
+		"GOFEP_INPUT_PRM="+genPrm.PrmPath)
+	cmd.Env = append(cmd.Env, env...)
+	out, err := cmd.CombinedOutput()
+
+	// Prefix output with hook name, as hooks of different windows may run at once
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	var lines strings.Builder
+	for scanner.Scan() {
+		lines.WriteString("[" + name + "] " + scanner.Text() + "\n")
+	}
+	fmt.Print(lines.String())
+
+	if err != nil {
+		return fmt.Errorf("%s hook \"%s\" failed: %w", name, command, err)
+	}
+	return nil
+}
+
+// Get environment variables describing the dynamic window in subDir for repetition repetitionNum of dynPrm on node n
+func windowHookEnv(dynPrm *DynamicParameters, subDir string, xyzPath string, keyPath string, repetitionNum int, n *Node) []string {
+	repetitionNumStr := strconv.Itoa(repetitionNum)
+	return []string{"GOFEP_BLOCK=" + dynPrm.Name,
+		"GOFEP_REPETITION=" + repetitionNumStr,
+		"GOFEP_WINDOW=" + filepath.Base(subDir),
+		"GOFEP_WINDOW_DIR=" + subDir,
+		"GOFEP_XYZ=" + xyzPath,
+		"GOFEP_KEY=" + keyPath,
+		"GOFEP_LOG=" + filepath.Join(subDir, dynPrm.Name+"_"+repetitionNumStr+".log"),
+		"GOFEP_ARC=" + strings.TrimSuffix(xyzPath, filepath.Ext(xyzPath)) + ".arc",
+		"GOFEP_NODE=" + n.Name}
+}
+
+// Get environment variables listing the BAR pairs in subDirs
+func pairsHookEnv(subDirs []string) []string {
+	pairs := make([]string, len(subDirs))
+	for i, subDir := range subDirs {
+		pairs[i] = filepath.Base(subDir)
+	}
+	return []string{"GOFEP_PAIRS=" + strings.Join(pairs, " ")}
+}
+
+// Get environment variables holding the total free energies in results, written to outputFile
+func resultsHookEnv(outputFile string, results *Results) []string {
+	return []string{"GOFEP_RESULTS_FILE=" + outputFile,
+		"GOFEP_FORWARD_ENERGY=" + strconv.FormatFloat(results.Forward.Energy, 'f', -1, 64),
+		"GOFEP_FORWARD_ERROR=" + strconv.FormatFloat(results.Forward.Error, 'f', -1, 64),
+		"GOFEP_BACKWARD_ENERGY=" + strconv.FormatFloat(results.Backward.Energy, 'f', -1, 64),
+		"GOFEP_BACKWARD_ERROR=" + strconv.FormatFloat(results.Backward.Error, 'f', -1, 64)}
+}
+
+// Check whether any hook is set
+func (h *HookParameters) any() bool {
+	return *h != HookParameters{}
+}
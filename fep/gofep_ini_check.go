@@ -0,0 +1,158 @@
+package fep
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// INI check: contains functions to collect every problem found while reading a settings INI file, each with the line
+// it is on, and to warn about keys no block knows, which are most likely typos
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// SettingsError is returned by GetParams when a settings INI file has errors. It holds every problem found, warnings
+// included, ordered by line
+type SettingsError struct {
+	Issues []InputIssue
+}
+
+// Error lists every problem, one per line
+func (e *SettingsError) Error() string {
+	numErrors := 0
+	for _, issue := range e.Issues {
+		if !issue.Warning {
+			numErrors++
+		}
+	}
+	message := "found " + strconv.Itoa(numErrors) + " error(s) in settings INI file:"
+	for _, issue := range e.Issues {
+		message += "\n  " + issue.String()
+	}
+	return message
+}
+
+// Keys each block knows. Keys of the setup block that generate a schedule or override windows are added from their
+// own lists
+var blockKeys = map[string][]string{
+	"general": {"targetDirectory", "xyz", "key", "prm", "nodeINI", "nodePreference", "intelSource", "cuda8Source", "cuda10Source",
+		"cuda8Home", "cuda10Home", "nsPerDay", "progressInterval", "logAccess"},
+	"setup":     {"vdwLambdas", "eleLambdas", "restraints", "seeding"},
+	"dynamic":   {"name", "order", "repetitions", "ensemble", "temp", "pressure", "stepInterval", "saveInterval", "simulationTime"},
+	"bar":       {"temp", "frameInterval", "extraPairs"},
+	"scheduler": {"maxNodesPerUser", "userMaxNodes", "usageHalfLife", "priorityAging", "maxPriority"},
+	"notify":    {"webhook", "email", "smtpServer", "smtpFrom", "smtpUser", "smtpPassword", "command", "on"},
+	"hooks": {"preSetup", "postSetup", "preDynamic", "postDynamic", "preRepetition", "postRepetition", "preBAR1", "postBAR1",
+		"preBAR2", "postBAR2", "preResults", "postResults"},
+}
+
+// Collects the problems found while reading a settings INI file
+type iniReport struct {
+	path   string
+	issues []InputIssue
+}
+
+// Report an error on line of the INI file, or in the file as a whole if line is 0
+func (r *iniReport) error(line int, message string) {
+	r.issues = append(r.issues, InputIssue{Path: r.path, Line: line, Message: message})
+}
+
+// Report a warning on line of the INI file
+func (r *iniReport) warn(line int, message string) {
+	r.issues = append(r.issues, InputIssue{Path: r.path, Line: line, Message: message, Warning: true})
+}
+
+// Check whether any error was reported
+func (r *iniReport) hasErrors() bool {
+	for _, issue := range r.issues {
+		if !issue.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the issues reported, ordered by line
+func (r *iniReport) sorted() []InputIssue {
+	sort.SliceStable(r.issues, func(i, j int) bool {
+		return r.issues[i].Line < r.issues[j].Line
+	})
+	return r.issues
+}
+
+// Warn about keys of the block that the block doesn't know, suggesting the known key meant if one is close, and about
+// keys given more than once where only the last is used
+func (r *iniReport) checkKeys(b block) {
+	known := append([]string{}, blockKeys[b.blockType]...)
+	repeatable := []string{}
+	if b.blockType == "setup" {
+		known = append(append(known, scheduleKeys...), overrideKeys...)
+		repeatable = overrideKeys
+	}
+
+	lineOfKey := make(map[string]int)
+	for _, p := range b.params {
+		if !contains(known, p.key) {
+			message := "unknown parameter \"" + p.key + "\" in block \"" + b.blockType + "\" is ignored"
+			if suggestion := suggestKey(p.key, known); suggestion != "" {
+				message += " (did you mean \"" + suggestion + "\"?)"
+			}
+			r.warn(p.line, message)
+			continue
+		}
+		if first, ok := lineOfKey[p.key]; ok && !contains(repeatable, p.key) {
+			r.warn(p.line, "parameter \""+p.key+"\" in block \""+b.blockType+"\" is also set on line "+strconv.Itoa(first)+
+				": only the last value is used")
+		}
+		lineOfKey[p.key] = p.line
+	}
+}
+
+// Get the key of known that key most likely is a typo of: the same ignoring case, or else the closest within two
+// edits. Returns "" if none is close
+func suggestKey(key string, known []string) string {
+	best := ""
+	bestDistance := 3
+	for _, k := range known {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+		if d := editDistance(strings.ToLower(k), strings.ToLower(key)); d < bestDistance {
+			best = k
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// Get the number of single character insertions, deletions and substitutions that turn a into b
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Get the smallest of three numbers
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,175 @@
+package fep
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Write a settings INI with text, in which DIR stands for a temporary folder holding the xyz, key and node INI files it
+// may use, and return its path along with a function removing the folder
+func writeTestINI(t *testing.T, text string) (string, func()) {
+	dir, err := ioutil.TempDir("", "gofep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"lig.xyz", "lig.key", "water.prm", "nodes.ini"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	iniPath := filepath.Join(dir, "settings.ini")
+	err = ioutil.WriteFile(iniPath, []byte(strings.Replace(text, "DIR", dir, -1)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return iniPath, func() { os.RemoveAll(dir) }
+}
+
+// Get issues as "line: message", with "warning: " before the message of a warning
+func testIssues(issues []InputIssue) []string {
+	var got []string
+	for _, issue := range issues {
+		s := strconv.Itoa(issue.Line) + ": "
+		if issue.Warning {
+			s += "warning: "
+		}
+		got = append(got, s+issue.Message)
+	}
+	return got
+}
+
+func TestGetParamsReportsEveryProblem(t *testing.T) {
+	iniPath, remove := writeTestINI(t, `general {
+    targetDirectory DIR
+    xyz DIR/lig.xyz
+    key DIR/lig.key
+    prm DIR/missing.prm
+    nodeINI DIR/nodes.ini
+    nodePrefrence fastest
+    nodePreference fastest
+    intelSource /intel.sh
+    cuda8Source /cuda8.sh
+    cuda10Source /cuda10.sh
+    cuda8Home /omm8
+    cuda10Home /omm10
+    nsPerDay fast
+}
+
+setup {
+    vdwLambdas 1.0 0.5 0.0
+    eleLambdas 1.0 0.0
+}
+
+dynamic {
+    name equil
+    order 1
+    repetitions two
+    ensemble 2
+    temp 298
+    stepInterval 2
+    saveInterval 1
+    simulationTime 0.1
+    simulationTime 0.2
+}
+`)
+	defer remove()
+	dir := filepath.Dir(iniPath)
+
+	settings, err := GetParams(iniPath)
+	if settings != nil {
+		t.Errorf("got settings despite errors")
+	}
+	var settingsErr *SettingsError
+	if !errors.As(err, &settingsErr) {
+		t.Fatalf("got error %v, want a *SettingsError", err)
+	}
+	for _, issue := range settingsErr.Issues {
+		if issue.Path != iniPath {
+			t.Errorf("got issue in %q, want %q", issue.Path, iniPath)
+		}
+	}
+	want := []string{
+		`0: missing "bar" block in INI file`,
+		`5: file specified in INI "` + dir + `/missing.prm" does not exist`,
+		`7: warning: unknown parameter "nodePrefrence" in block "general" is ignored (did you mean "nodePreference"?)`,
+		`14: parameter "nsPerDay" in block "general" must be a positive number`,
+		`18: vdwLambdas (3), eleLambdas (2) specified in setup block of INI file are of unequal lengths. Please fix this and run setup again`,
+		`25: failed to convert "repetitions" parameter in "dynamic" block from string to integer: strconv.Atoi: parsing "two": invalid syntax`,
+		`31: warning: parameter "simulationTime" in block "dynamic" is also set on line 30: only the last value is used`,
+	}
+	if got := testIssues(settingsErr.Issues); !reflect.DeepEqual(got, want) {
+		t.Errorf("got issues\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.HasPrefix(err.Error(), "found 5 error(s) in settings INI file:") {
+		t.Errorf("got error message %q", err.Error())
+	}
+}
+
+func TestGetParamsReturnsWarnings(t *testing.T) {
+	iniPath, remove := writeTestINI(t, `[general]
+targetDirectory DIR
+xyz DIR/lig.xyz
+key DIR/lig.key
+prm DIR/water.prm
+nodeINI DIR/nodes.ini
+nodePreference fastest
+intelSource /intel.sh
+cuda8Source /cuda8.sh
+cuda10Source /cuda10.sh
+cuda8Home /omm8
+cuda10Home /omm10
+NsPerDay 20
+
+[setup]
+vdwLambdas [1.0, 0.5,
+            0.0]
+eleLambdas [1.0 0.0 0.0]
+restrains 1
+
+[bar]
+temp 298
+frameInterval 1
+`)
+	defer remove()
+
+	settings, err := GetParams(iniPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		`13: warning: unknown parameter "NsPerDay" in block "general" is ignored (did you mean "nsPerDay"?)`,
+		`19: warning: unknown parameter "restrains" in block "setup" is ignored (did you mean "restraints"?)`,
+	}
+	if got := testIssues(settings.Warnings); !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !reflect.DeepEqual(settings.Setup.Vdw, []string{"1.0", "0.5", "0.0"}) {
+		t.Errorf("got vdwLambdas %q", settings.Setup.Vdw)
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	known := []string{"vdwLambdas", "eleLambdas", "restraints", "seeding"}
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"VDWLAMBDAS", "vdwLambdas"},
+		{"eleLambda", "eleLambdas"},
+		{"restrains", "restraints"},
+		{"seding", "seeding"},
+		{"temperature", ""},
+	}
+	for _, test := range tests {
+		if got := suggestKey(test.key, known); got != test.want {
+			t.Errorf("suggestKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package fep
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// INI parser: contains the tokenizer and parser of settings INI files, which split a file into blocks of parameters
+// while keeping the line each comes from
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Types of blocks a settings INI file may have
+var blockTypes = []string{"general", "setup", "dynamic", "bar", "scheduler", "notify", "hooks"}
+
+// A word of a line of a settings INI file, with any quotes removed
+type iniWord struct {
+	text string
+	// quoted is set if any part of the word was quoted, so it is a value even if it looks like "{" or "["
+	quoted bool
+	// lead and trail are the numbers of bytes of a quoted word before its first quote and after its last one
+	lead  int
+	trail int
+	// end is the offset in the line just after the word
+	end int
+}
+
+// A line of a block setting a parameter
+type param struct {
+	key    string
+	values []string
+	// raw is the rest of the line after the key as written, without its comment, for parameters that take a command
+	raw string
+	// line is the line of the ini file the parameter starts on, endLine the one it ends on if its list spans lines
+	line    int
+	endLine int
+}
+
+// Check whether the parameter key of blocks of type blockType takes the rest of its line as written (a shell command),
+// so brackets are not read as a list
+func isRawParam(blockType string, key string) bool {
+	return blockType == "hooks" || (blockType == "notify" && key == "command")
+}
+
+// Split a line of a settings INI file into words separated by whitespace. Parts of a word may be quoted with double
+// quotes (in which \" and \\ stand for " and \) or single quotes to keep whitespace or "#" in it. A "#" that starts a
+// word outside quotes starts a comment running to the end of the line. Returns the words along with the line without
+// its comment
+func splitINILine(line string) ([]iniWord, string, error) {
+	var words []iniWord
+	i := 0
+	for i < len(line) {
+		// Skip whitespace between words
+		if line[i] == ' ' || line[i] == '\t' || line[i] == '\r' {
+			i++
+			continue
+		}
+		if line[i] == '#' {
+			return words, strings.TrimRight(line[:i], " \t\r"), nil
+		}
+
+		// Read word up to the next whitespace outside quotes
+		var word strings.Builder
+		quoted := false
+		lead, trail := 0, 0
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' && line[i] != '\r' {
+			quote := line[i]
+			if quote != '"' && quote != '\'' {
+				word.WriteByte(quote)
+				trail++
+				i++
+				continue
+			}
+			if !quoted {
+				lead = trail
+			}
+			quoted = true
+			trail = 0
+			i++
+			closed := false
+			for i < len(line) {
+				if line[i] == quote {
+					closed = true
+					i++
+					break
+				}
+				if quote == '"' && line[i] == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+					i++
+				}
+				word.WriteByte(line[i])
+				i++
+			}
+			if !closed {
+				return nil, "", errors.New("quote " + string(quote) + " is not closed on the line it is opened on")
+			}
+		}
+		words = append(words, iniWord{text: word.String(), quoted: quoted, lead: lead, trail: trail, end: i})
+	}
+	return words, strings.TrimRight(line, " \t\r"), nil
+}
+
+// Parse the text of a settings INI file into its blocks, reporting any problem with its structure to r and carrying
+// on. Blocks are either delimited by braces ("dynamic {" up to "}", with the "{" on the same line or the next one)
+// or sections ("[dynamic]" up to the next block). Each line of a block sets the parameter named by its first word to
+// the words after it, or to the items of a list in brackets, which may span lines and separate items with commas
+func parseINI(text string, r *iniReport) []block {
+	const (
+		outside = iota
+		awaitingBrace
+		inBraces
+		inSection
+	)
+	var blocks []block
+	state := outside
+	// list is the index of the parameter of the last block whose list is open, or -1
+	list := -1
+
+	start := func(blockType string, lineNum int) {
+		blocks = append(blocks, block{blockType: blockType, line: lineNum, open: lineNum})
+	}
+	isWord := func(w iniWord, s string) bool {
+		return !w.quoted && w.text == s
+	}
+
+	// Split every line into words first, so a header can look at the line after it
+	lines := strings.Split(text, "\n")
+	lineWords := make([][]iniWord, len(lines))
+	contents := make([]string, len(lines))
+	for n, line := range lines {
+		words, content, err := splitINILine(line)
+		if err != nil {
+			r.error(n+1, err.Error())
+			continue
+		}
+		lineWords[n] = words
+		contents[n] = content
+	}
+	// Check whether the first line with words after line n is "{"
+	braceNext := func(n int) bool {
+		for n++; n < len(lines); n++ {
+			if len(lineWords[n]) > 0 {
+				return len(lineWords[n]) == 1 && isWord(lineWords[n][0], "{")
+			}
+		}
+		return false
+	}
+
+	for n := range lines {
+		lineNum := n + 1
+		words, content := lineWords[n], contents[n]
+		if len(words) == 0 {
+			continue
+		}
+
+		// A list left open is ended by "}" or a section header, which can't be items of it
+		if list >= 0 && !words[0].quoted && (words[0].text == "}" || strings.HasPrefix(words[0].text, "[")) {
+			b := blocks[len(blocks)-1]
+			r.error(b.params[list].line, "list of parameter \""+b.params[list].key+"\" is not closed with \"]\"")
+			list = -1
+		}
+
+		// Lines of an open list add to it until it is closed
+		if list >= 0 {
+			p := &blocks[len(blocks)-1].params[list]
+			items, closed, rest := readListItems(words)
+			p.values = append(p.values, items...)
+			p.endLine = lineNum
+			if closed {
+				list = -1
+				if len(rest) > 0 {
+					r.error(lineNum, "unexpected \""+rest[0].text+"\" after the end of the list of parameter \""+p.key+"\"")
+				}
+			}
+			continue
+		}
+
+		// A block header on its own line must be followed by "{"
+		if state == awaitingBrace {
+			b := &blocks[len(blocks)-1]
+			state = inBraces
+			if len(words) == 1 && isWord(words[0], "{") {
+				b.open = lineNum
+				continue
+			}
+			r.error(b.line, "block \""+b.blockType+"\" must be followed by \"{\"")
+		}
+
+		// Section headers: [name]
+		first := words[0]
+		if !first.quoted && strings.HasPrefix(first.text, "[") {
+			last := words[len(words)-1]
+			var names []string
+			for _, w := range words {
+				names = append(names, w.text)
+			}
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.Join(names, " "), "["), "]"))
+			if last.quoted || !strings.HasSuffix(last.text, "]") || name == "" || strings.ContainsAny(name, " []") {
+				r.error(lineNum, "section header \""+strings.TrimSpace(content)+"\" must be of the form [block]")
+				continue
+			}
+			if state == inBraces {
+				b := blocks[len(blocks)-1]
+				r.error(lineNum, "block \""+b.blockType+"\" starting on line "+strconv.Itoa(b.line)+" is not closed with \"}\" before section ["+name+"]")
+			}
+			start(name, lineNum)
+			state = inSection
+			continue
+		}
+
+		// Closing braces
+		if isWord(first, "}") {
+			if state != inBraces {
+				r.error(lineNum, "\"}\" does not close any block")
+			} else if len(words) > 1 {
+				r.error(lineNum, "unexpected \""+words[1].text+"\" after \"}\"")
+			}
+			if state == inBraces {
+				state = outside
+			}
+			continue
+		}
+
+		// Brace delimited block headers: name {, or name alone with "{" on the next line
+		if !first.quoted && ((len(words) == 2 && isWord(words[1], "{")) || (len(words) == 1 && (state == outside || braceNext(n)))) {
+			if state == inBraces {
+				b := blocks[len(blocks)-1]
+				r.error(lineNum, "block \""+b.blockType+"\" starting on line "+strconv.Itoa(b.line)+" is not closed with \"}\" before block \""+
+					first.text+"\"")
+			}
+			start(first.text, lineNum)
+			state = inBraces
+			if len(words) == 1 {
+				state = awaitingBrace
+			}
+			continue
+		}
+
+		// Anything else sets a parameter of the current block
+		if state == outside {
+			r.error(lineNum, "parameter \""+first.text+"\" is outside any block")
+			continue
+		}
+		b := &blocks[len(blocks)-1]
+		p := param{key: first.text, raw: strings.TrimSpace(content[first.end:]), line: lineNum, endLine: lineNum}
+		values := words[1:]
+		if len(values) > 0 && (!values[0].quoted || values[0].lead > 0) && strings.HasPrefix(values[0].text, "[") &&
+			!isRawParam(b.blockType, p.key) {
+			values[0].text = values[0].text[1:]
+			if values[0].quoted {
+				values[0].lead--
+			}
+			items, closed, rest := readListItems(values)
+			p.values = items
+			if !closed {
+				list = len(b.params)
+			} else if len(rest) > 0 {
+				r.error(lineNum, "unexpected \""+rest[0].text+"\" after the end of the list of parameter \""+p.key+"\"")
+			}
+		} else {
+			for _, w := range values {
+				p.values = append(p.values, w.text)
+			}
+		}
+		b.params = append(b.params, p)
+	}
+
+	// Report blocks and lists left open at the end of the file
+	if len(blocks) > 0 {
+		b := blocks[len(blocks)-1]
+		if list >= 0 {
+			r.error(b.params[list].line, "list of parameter \""+b.params[list].key+"\" is not closed with \"]\"")
+		}
+		if state == inBraces || state == awaitingBrace {
+			r.error(b.line, "block \""+b.blockType+"\" is not closed with \"}\"")
+		}
+	}
+	return blocks
+}
+
+// Read items of a list from words, each separated by whitespace or commas, up to the word ending in "]" that closes
+// the list. Commas and brackets only count outside quotes. Returns the items, whether the list was closed and the
+// words after the one closing it
+func readListItems(words []iniWord) ([]string, bool, []iniWord) {
+	var items []string
+	add := func(item string, quoted bool) {
+		if item != "" || quoted {
+			items = append(items, item)
+		}
+	}
+	for i, w := range words {
+		// Split word into the part before its quotes, the quoted middle and the part after, all of a word without
+		// quotes being after
+		text, lead, trail := w.text, w.lead, w.trail
+		if !w.quoted {
+			lead, trail = 0, len(text)
+		}
+		closed := trail > 0 && strings.HasSuffix(text, "]")
+		if closed {
+			text = text[:len(text)-1]
+			trail--
+		}
+		head := strings.Split(text[:lead], ",")
+		tail := strings.Split(text[len(text)-trail:], ",")
+		for _, item := range head[:len(head)-1] {
+			add(item, false)
+		}
+		add(head[len(head)-1]+text[lead:len(text)-trail]+tail[0], w.quoted)
+		for _, item := range tail[1:] {
+			add(item, false)
+		}
+		if closed {
+			return items, true, words[i+1:]
+		}
+	}
+	return items, false, nil
+}
+
+// Quote a value for a settings INI file if it would not otherwise be read back as one word
+func quoteINIValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\"'#[]{}") {
+		return value
+	}
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
@@ -0,0 +1,250 @@
+package fep
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A parameter as parsed, without the fields a test doesn't check
+type testParam struct {
+	key     string
+	values  []string
+	line    int
+	endLine int
+}
+
+// A block as parsed, without the fields a test doesn't check
+type testBlock struct {
+	blockType string
+	line      int
+	open      int
+	params    []testParam
+}
+
+// Get the parts of blocks the tests check
+func testBlocks(blocks []block) []testBlock {
+	var got []testBlock
+	for _, b := range blocks {
+		tb := testBlock{blockType: b.blockType, line: b.line, open: b.open}
+		for _, p := range b.params {
+			tb.params = append(tb.params, testParam{key: p.key, values: p.values, line: p.line, endLine: p.endLine})
+		}
+		got = append(got, tb)
+	}
+	return got
+}
+
+func TestSplitINILine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		words   []string
+		content string
+		err     string
+	}{
+		{"plain words", "  xyz   lig.xyz\t", []string{"xyz", "lig.xyz"}, "  xyz   lig.xyz", ""},
+		{"double quotes keep whitespace", `xyz "my lig.xyz"`, []string{"xyz", "my lig.xyz"}, `xyz "my lig.xyz"`, ""},
+		{"escapes in double quotes", `say "a \"b\" c\\d"`, []string{"say", `a "b" c\d`}, `say "a \"b\" c\\d"`, ""},
+		{"other backslashes are kept", `path "c:\tinker"`, []string{"path", `c:\tinker`}, `path "c:\tinker"`, ""},
+		{"single quotes are literal", `say 'a \"b'`, []string{"say", `a \"b`}, `say 'a \"b'`, ""},
+		{"quoted parts join one word", `say ab"c d"'e f'`, []string{"say", "abc de f"}, `say ab"c d"'e f'`, ""},
+		{"inline comment", "temp 298 # kelvin", []string{"temp", "298"}, "temp 298", ""},
+		{"comment line", "# temp 298", nil, "", ""},
+		{"hash inside quotes", `note "a # b" '#c' # comment`, []string{"note", "a # b", "#c"}, `note "a # b" '#c'`, ""},
+		{"hash inside a word", "note a#b", []string{"note", "a#b"}, "note a#b", ""},
+		{"unclosed double quote", `xyz "lig.xyz`, nil, "", `quote " is not closed on the line it is opened on`},
+		{"unclosed single quote", `xyz 'lig.xyz`, nil, "", `quote ' is not closed on the line it is opened on`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			words, content, err := splitINILine(test.line)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var texts []string
+			for _, w := range words {
+				texts = append(texts, w.text)
+			}
+			if !reflect.DeepEqual(texts, test.words) {
+				t.Errorf("got words %q, want %q", texts, test.words)
+			}
+			if content != test.content {
+				t.Errorf("got content %q, want %q", content, test.content)
+			}
+		})
+	}
+}
+
+func TestParseINI(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		blocks []testBlock
+	}{
+		{
+			name: "brace blocks",
+			text: "general {\n  xyz lig.xyz\n}\n\nbar {\n  temp 298\n  frameInterval 1\n}\n",
+			blocks: []testBlock{
+				{"general", 1, 1, []testParam{{"xyz", []string{"lig.xyz"}, 2, 2}}},
+				{"bar", 5, 5, []testParam{{"temp", []string{"298"}, 6, 6}, {"frameInterval", []string{"1"}, 7, 7}}},
+			},
+		},
+		{
+			name: "section blocks",
+			text: "# settings\n[general]\nxyz lig.xyz\n\n[bar]\ntemp 298\n",
+			blocks: []testBlock{
+				{"general", 2, 2, []testParam{{"xyz", []string{"lig.xyz"}, 3, 3}}},
+				{"bar", 5, 5, []testParam{{"temp", []string{"298"}, 6, 6}}},
+			},
+		},
+		{
+			name: "brace on the next line",
+			text: "dynamic\n{\n  name equil\n}\n[bar]\ntemp 298\nsetup\n{\nvdwLambdas 1\n}\n",
+			blocks: []testBlock{
+				{"dynamic", 1, 2, []testParam{{"name", []string{"equil"}, 3, 3}}},
+				{"bar", 5, 5, []testParam{{"temp", []string{"298"}, 6, 6}}},
+				{"setup", 7, 8, []testParam{{"vdwLambdas", []string{"1"}, 9, 9}}},
+			},
+		},
+		{
+			name: "quoted values",
+			text: "general {\n  xyz \"my lig.xyz\"\n  key 'my lig.key'\n  prm \"a \\\"b\\\" c\\\\d\"\n  nodeINI \"}\"\n}\n",
+			blocks: []testBlock{
+				{"general", 1, 1, []testParam{
+					{"xyz", []string{"my lig.xyz"}, 2, 2},
+					{"key", []string{"my lig.key"}, 3, 3},
+					{"prm", []string{`a "b" c\d`}, 4, 4},
+					{"nodeINI", []string{"}"}, 5, 5},
+				}},
+			},
+		},
+		{
+			name: "comments",
+			text: "# header\ngeneral { # comment\n  xyz lig.xyz # comment\n  key \"lig # 2.key\"\n  # xyz other.xyz\n} # end\n",
+			blocks: []testBlock{
+				{"general", 2, 2, []testParam{{"xyz", []string{"lig.xyz"}, 3, 3}, {"key", []string{"lig # 2.key"}, 4, 4}}},
+			},
+		},
+		{
+			name: "multi-line lists",
+			text: "setup {\n  vdwLambdas [1.0, 1.0,\n    0.5,0.0\n  ]\n  eleLambdas [1.0 0.5 0.0 0.0]\n  restraints [\"1 0\" 2]\n}\n",
+			blocks: []testBlock{
+				{"setup", 1, 1, []testParam{
+					{"vdwLambdas", []string{"1.0", "1.0", "0.5", "0.0"}, 2, 4},
+					{"eleLambdas", []string{"1.0", "0.5", "0.0", "0.0"}, 5, 5},
+					{"restraints", []string{"1 0", "2"}, 6, 6},
+				}},
+			},
+		},
+		{
+			name: "quoted list items",
+			text: "[notify]\nemail [\"a b\", 'c,d',e \"f\"]\nwebhook \"[not a list]\"\n",
+			blocks: []testBlock{
+				{"notify", 1, 1, []testParam{
+					{"email", []string{"a b", "c,d", "e", "f"}, 2, 2},
+					{"webhook", []string{"[not a list]"}, 3, 3},
+				}},
+			},
+		},
+		{
+			name: "commands keep brackets",
+			text: "[hooks]\npostSetup echo [done]\n",
+			blocks: []testBlock{
+				{"hooks", 1, 1, []testParam{{"postSetup", []string{"echo", "[done]"}, 2, 2}}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &iniReport{}
+			blocks := testBlocks(parseINI(test.text, r))
+			if len(r.issues) > 0 {
+				t.Errorf("unexpected issues: %q", testIssues(r.issues))
+			}
+			if !reflect.DeepEqual(blocks, test.blocks) {
+				t.Errorf("got blocks\n%+v\nwant\n%+v", blocks, test.blocks)
+			}
+		})
+	}
+}
+
+func TestParseINIRaw(t *testing.T) {
+	blocks := parseINI("[hooks]\npostSetup  echo \"[setup done]\" | tee -a log   # comment\n", &iniReport{})
+	if got, want := blocks[0].getRaw("postSetup"), `echo "[setup done]" | tee -a log`; got != want {
+		t.Errorf("got raw %q, want %q", got, want)
+	}
+}
+
+func TestParseINIErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		issues []string
+	}{
+		{
+			name:   "unclosed block",
+			text:   "general {\n  xyz lig.xyz\n",
+			issues: []string{`1: block "general" is not closed with "}"`},
+		},
+		{
+			name:   "unclosed block before the next",
+			text:   "general {\n  xyz lig.xyz\nbar {\n  temp 298\n}\n",
+			issues: []string{`3: block "general" starting on line 1 is not closed with "}" before block "bar"`},
+		},
+		{
+			name:   "brace missing after header",
+			text:   "general\n  xyz lig.xyz\n}\n",
+			issues: []string{`1: block "general" must be followed by "{"`},
+		},
+		{
+			name:   "unclosed list",
+			text:   "setup {\n  vdwLambdas [1.0, 0.5\n  eleLambdas 1.0 0.0\n}\n",
+			issues: []string{`2: list of parameter "vdwLambdas" is not closed with "]"`},
+		},
+		{
+			name:   "unclosed list at the end of the file",
+			text:   "[setup]\nvdwLambdas [1.0, 0.5\n",
+			issues: []string{`2: list of parameter "vdwLambdas" is not closed with "]"`},
+		},
+		{
+			name:   "words after a list",
+			text:   "[setup]\nvdwLambdas [1.0 0.5] 0.0\n",
+			issues: []string{`2: unexpected "0.0" after the end of the list of parameter "vdwLambdas"`},
+		},
+		{
+			name:   "unclosed quote",
+			text:   "general {\n  xyz \"lig.xyz\n}\n",
+			issues: []string{`2: quote " is not closed on the line it is opened on`},
+		},
+		{
+			name:   "stray brace",
+			text:   "general {\n  xyz lig.xyz\n}\n}\n",
+			issues: []string{`4: "}" does not close any block`},
+		},
+		{
+			name:   "parameter outside any block",
+			text:   "xyz lig.xyz\n",
+			issues: []string{`1: parameter "xyz" is outside any block`},
+		},
+		{
+			name:   "malformed section header",
+			text:   "[setup\nvdwLambdas 1\n",
+			issues: []string{`1: section header "[setup" must be of the form [block]`, `2: parameter "vdwLambdas" is outside any block`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &iniReport{}
+			parseINI(test.text, r)
+			if got := testIssues(r.sorted()); !reflect.DeepEqual(got, test.issues) {
+				t.Errorf("got issues\n%q\nwant\n%q", got, test.issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,759 @@
+package fep
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameters the general block of a settings INI file must set, for a run and for a server
+var runGeneralKeys = []string{"xyz", "key", "prm", "nodeINI", "nodePreference", "intelSource", "cuda8Source", "cuda10Source",
+	"cuda8Home", "cuda10Home"}
+var serverGeneralKeys = []string{"nodeINI", "nodePreference", "intelSource", "cuda8Source", "cuda10Source", "cuda8Home",
+	"cuda10Home"}
+
+// GetParams reads a settings INI file and returns the FEP parameters it defines. Every problem with the file is
+// reported at once: if there are errors, the error returned is a *SettingsError listing all of them with their lines,
+// while warnings are returned in the Warnings of the settings
+func GetParams(iniPath string) (*Settings, error) {
+	return readSettings(iniPath, false)
+}
+
+// GetServerParams reads the settings INI file of a server, which needs only a general block, without the xyz, key and
+// prm files of a run, and may have scheduler and notify blocks. Other blocks are ignored with a warning. Problems are
+// reported as by GetParams
+func GetServerParams(iniPath string) (*Settings, error) {
+	return readSettings(iniPath, true)
+}
+
+// Read a settings INI file of a run, or of a server if server is set
+func readSettings(iniPath string, server bool) (*Settings, error) {
+
+	// Read INI file
+	data, err := ioutil.ReadFile(iniPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ini file %s: %w", iniPath, err)
+	}
+
+	// Identify blocks in INI, along with problems with its structure
+	r := &iniReport{path: iniPath}
+	blocks := parseINI(string(data), r)
+
+	// Initialize param variables
+	settings := &Settings{}
+
+	// Keep line of first block of each type to make sure duplicate blocks are not defined (duplicate dynamic blocks
+	// are allowed)
+	blockLines := make(map[string]int)
+	var setupBlock block
+
+	// iterate over all blocks
+	for _, b := range blocks {
+		if !contains(blockTypes, b.blockType) {
+			message := "unknown block \"" + b.blockType + "\" in INI file"
+			if suggestion := suggestKey(b.blockType, blockTypes); suggestion != "" {
+				message += " (did you mean \"" + suggestion + "\"?)"
+			}
+			r.error(b.line, message)
+			continue
+		}
+		if first, ok := blockLines[b.blockType]; ok && b.blockType != "dynamic" {
+			r.error(b.line, "multiple \""+b.blockType+"\" blocks defined in INI file (the first starts on line "+strconv.Itoa(first)+")")
+			continue
+		}
+		blockLines[b.blockType] = b.line
+		if server && b.blockType != "general" && b.blockType != "scheduler" && b.blockType != "notify" {
+			r.warn(b.line, "block \""+b.blockType+"\" is not used by a server and is ignored")
+			continue
+		}
+		r.checkKeys(b)
+
+		// Based on blocktype, turn parameters of block into the relevant parameter struct
+		if b.blockType == "general" {
+			required := runGeneralKeys
+			if server {
+				required = serverGeneralKeys
+			}
+			settings.General = generateGenParams(b, r, required)
+		} else if b.blockType == "setup" {
+			settings.Setup = generateSetupParams(b, r)
+			setupBlock = b
+		} else if b.blockType == "dynamic" {
+			dynPrm := generateDynamicParams(b, r)
+			// Check that no 2 dynamic blocks have the same order or name
+			for _, prm := range settings.Dynamic {
+				if b.getLine("order") != b.line && prm.Order == dynPrm.Order {
+					r.error(b.getLine("order"), "no two \"dynamic\" blocks can have the same \"order\" parameter: dynamic blocks "+
+						prm.Name+" and "+dynPrm.Name+" have the same value for \"order\"")
+				}
+				if dynPrm.Name != "" && prm.Name == dynPrm.Name {
+					r.error(b.getLine("name"), "no two \"dynamic\" blocks can have the same \"name\" parameter: there are two dynamic blocks named "+
+						prm.Name)
+				}
+			}
+			settings.Dynamic = append(settings.Dynamic, dynPrm)
+		} else if b.blockType == "bar" {
+			settings.BAR = generateBARParams(b, r)
+		} else if b.blockType == "scheduler" {
+			settings.Scheduler = generateSchedulerParams(b, r)
+		} else if b.blockType == "notify" {
+			settings.Notify = generateNotifyParams(b, r)
+		} else if b.blockType == "hooks" {
+			settings.Hooks = generateHookParams(b)
+		}
+	}
+
+	// Make sure required blocks are defined
+	required := []string{"general", "setup", "bar"}
+	if server {
+		required = []string{"general"}
+	}
+	for _, blockType := range required {
+		if _, ok := blockLines[blockType]; !ok {
+			r.error(0, "missing \""+blockType+"\" block in INI file")
+		}
+	}
+
+	// The scheduler block is optional
+	if _, ok := blockLines["scheduler"]; !ok {
+		settings.Scheduler = generateSchedulerParams(block{}, r)
+	}
+
+	// Sort dynamic parameter sets by order field
+	dynPrm := settings.Dynamic
+	less := func(i, j int) bool {
+		return dynPrm[i].Order < dynPrm[j].Order
+	}
+	sort.Slice(dynPrm, less)
+
+	// Seed from the first dynamic block unless another is named
+	if settings.Setup.Seeding == "sequential" {
+		if settings.Setup.SeedBlock == "" && len(dynPrm) > 0 {
+			settings.Setup.SeedBlock = dynPrm[0].Name
+		}
+		found := false
+		for _, prm := range dynPrm {
+			found = found || prm.Name == settings.Setup.SeedBlock
+		}
+		if !found {
+			r.error(setupBlock.getLine("seeding"), "sequential seeding in setup block of INI file needs a dynamic block to seed from, but there is no dynamic block named \""+
+				settings.Setup.SeedBlock+"\"")
+		}
+	}
+
+	// Return every problem if any is an error, or else the parameter structs along with any warnings
+	if r.hasErrors() {
+		return nil, &SettingsError{Issues: r.sorted()}
+	}
+	settings.Warnings = r.sorted()
+	return settings, nil
+}
+
+// removes comment blocks from a line (string)
+func cleanLine(line string) string {
+	// Look out for following byte signifying a comment
+	commentByte := []byte("#")[0]
+	// iterate through all bytes in line
+	for i := 0; i < len(line); i++ {
+		// if byte = comment byte, return line up until that byte
+		if line[i] == commentByte {
+			return line[0:i]
+		}
+	}
+	// if no comments found, return whole line
+	return line
+}
+
+// Get map of parameters of the block, where a parameter given more than once has the value it is last given
+func (b block) generateParamsMap() map[string][]string {
+	paramsMap := map[string][]string{}
+	for _, p := range b.params {
+		paramsMap[p.key] = p.values
+	}
+	return paramsMap
+}
+
+// Get the values of every line of the block setting key, for keys that may be given more than once, along with the
+// line of the ini file each is on
+func (b block) getRepeatedParams(key string) ([][]string, []int) {
+	var values [][]string
+	var lineNums []int
+	for _, p := range b.params {
+		if p.key == key {
+			values = append(values, p.values)
+			lineNums = append(lineNums, p.line)
+		}
+	}
+	return values, lineNums
+}
+
+// Get the line of the ini file of the last line of the block setting key, whose value is the one used, or the line
+// the block starts on if key is not set
+func (b block) getLine(key string) int {
+	for i := len(b.params) - 1; i >= 0; i-- {
+		if b.params[i].key == key {
+			return b.params[i].line
+		}
+	}
+	return b.line
+}
+
+// Get the rest of the last line of the block setting key as written, or "" if key is not set
+func (b block) getRaw(key string) string {
+	for i := len(b.params) - 1; i >= 0; i-- {
+		if b.params[i].key == key {
+			return b.params[i].raw
+		}
+	}
+	return ""
+}
+
+// Check that all necessary parameters were specified in the block, reporting each that was not on the line the block
+// starts on
+func (b block) checkIfParamsSpecified(r *iniReport, listOfKeys ...string) {
+	paramsMap := b.generateParamsMap()
+	for _, key := range listOfKeys {
+		if len(paramsMap[key]) < 1 {
+			r.error(b.line, "parameter \""+key+"\" in block \""+b.blockType+"\" has not been set")
+		}
+	}
+}
+
+// Get the first value of key in paramsMap, or "" if key is not set
+func getFirstParam(paramsMap map[string][]string, key string) string {
+	if len(paramsMap[key]) < 1 {
+		return ""
+	}
+	return paramsMap[key][0]
+}
+
+// Generate parameters struct from parameters of block
+func generateSetupParams(b block, r *iniReport) SetupParameters {
+	paramsMap := b.generateParamsMap()
+	prm := SetupParameters{}
+
+	// Expand schedule generators into lists
+	if hasSchedule(paramsMap) {
+		var err error
+		prm, err = generateSchedule(paramsMap)
+		if err != nil {
+			r.error(b.line, err.Error())
+		}
+	} else {
+		prm.Vdw = paramsMap["vdwLambdas"]
+		prm.Ele = paramsMap["eleLambdas"]
+		prm.Rst = paramsMap["restraints"]
+
+		if len(prm.Rst) > 0 {
+			if len(prm.Vdw) != len(prm.Ele) || len(prm.Ele) != len(prm.Rst) {
+				r.error(b.getLine("vdwLambdas"), "vdwLambdas ("+strconv.Itoa(len(prm.Vdw))+"), eleLambdas ("+strconv.Itoa(len(prm.Ele))+
+					"), restraints ("+strconv.Itoa(len(prm.Rst))+") specified in setup block of INI file are of unequal lengths. "+
+					"Please fix this and run setup again")
+			}
+		} else {
+			if len(prm.Vdw) != len(prm.Ele) {
+				r.error(b.getLine("vdwLambdas"), "vdwLambdas ("+strconv.Itoa(len(prm.Vdw))+"), eleLambdas ("+strconv.Itoa(len(prm.Ele))+
+					") specified in setup block of INI file are of unequal lengths. Please fix this and run setup again")
+			}
+		}
+	}
+
+	prm.Overrides = generateWindowOverrides(b, r)
+	prm.Seeding, prm.SeedBlock = generateSeeding(b, r)
+	return prm
+}
+
+// Get how windows of the setup block are seeded, given as "seeding sequential [block]" or "seeding independent"
+func generateSeeding(b block, r *iniReport) (string, string) {
+	value, ok := b.generateParamsMap()["seeding"]
+	if !ok {
+		return "independent", ""
+	}
+	if len(value) == 1 && value[0] == "independent" {
+		return value[0], ""
+	} else if len(value) == 1 && value[0] == "sequential" {
+		return value[0], ""
+	} else if len(value) == 2 && value[0] == "sequential" {
+		return value[0], value[1]
+	}
+	r.error(b.getLine("seeding"), "\"seeding\" in setup block of INI file must be \"independent\" or \"sequential [block]\", not \""+
+		strings.Join(value, " ")+"\"")
+	return "independent", ""
+}
+
+// Names dynamic blocks may have
+var blockNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Generate parameters struct from parameters of block
+func generateDynamicParams(b block, r *iniReport) DynamicParameters {
+	var err error
+	paramsMap := b.generateParamsMap()
+	prm := DynamicParameters{}
+
+	// Check if parameters were specified
+	b.checkIfParamsSpecified(r, "name", "order", "repetitions", "ensemble", "stepInterval", "saveInterval", "simulationTime")
+
+	// Set block name. It goes into the paths of logs and scripts run on nodes through a here document, where the shell
+	// would expand "$" and backticks, so only plain characters are allowed
+	prm.Name = getFirstParam(paramsMap, "name")
+	if prm.Name != "" && !blockNamePattern.MatchString(prm.Name) {
+		r.error(b.getLine("name"), "name \""+prm.Name+"\" of dynamic block may only contain letters, digits, \"_\", \".\" and \"-\"")
+	}
+
+	// Set block order
+	if order := getFirstParam(paramsMap, "order"); order != "" {
+		prm.Order, err = strconv.Atoi(order)
+		if err != nil {
+			r.error(b.getLine("order"), fmt.Errorf("failed to convert \"order\" parameter in \"dynamic\" block from string to integer: %w", err).Error())
+		}
+	}
+
+	// Set block repetitions
+	if repetitions := getFirstParam(paramsMap, "repetitions"); repetitions != "" {
+		prm.Repetitions, err = strconv.Atoi(repetitions)
+		if err != nil {
+			r.error(b.getLine("repetitions"), fmt.Errorf("failed to convert \"repetitions\" parameter in \"dynamic\" block from string to integer: %w", err).Error())
+		}
+	}
+
+	// Set block ensemble
+	prm.Ensemble = getFirstParam(paramsMap, "ensemble")
+	if prm.Ensemble != "" && prm.Ensemble != "1" && prm.Ensemble != "2" && prm.Ensemble != "3" && prm.Ensemble != "4" {
+		r.error(b.getLine("ensemble"), "ensemble in dynamic block \""+prm.Name+"\" must be set to \"1\", \"2\", \"3\", or \"4\"")
+	}
+
+	// Set block temp
+	if prm.Ensemble == "2" || prm.Ensemble == "4" {
+		prm.Temp = getFirstParam(paramsMap, "temp")
+		if prm.Temp == "" {
+			r.error(b.line, "parameter \"temp\" in block \"dynamic\" has not been set")
+		} else if _, err := strconv.ParseFloat(prm.Temp, 64); err != nil {
+			r.error(b.getLine("temp"), "temperature parameter set in dynamic block: \""+prm.Name+"\" of \""+prm.Temp+
+				"\" could not be parsed as float and thus Tinker would likely fail")
+		}
+	}
+
+	// Set block pressure
+	if prm.Ensemble == "3" || prm.Ensemble == "4" {
+		prm.Pressure = getFirstParam(paramsMap, "pressure")
+		if prm.Pressure == "" {
+			r.error(b.line, "parameter \"pressure\" in block \"dynamic\" has not been set")
+		} else if _, err := strconv.ParseFloat(prm.Pressure, 64); err != nil {
+			r.error(b.getLine("pressure"), "pressure parameter set in dynamic block: \""+prm.Name+"\" of \""+prm.Pressure+
+				"\" could not be parsed as float and thus Tinker would likely fail")
+		}
+	}
+
+	// Set block step and save interval
+	prm.StepInterval = getFirstParam(paramsMap, "stepInterval")
+	prm.SaveInterval = getFirstParam(paramsMap, "saveInterval")
+	for _, key := range []string{"stepInterval", "saveInterval"} {
+		param := getFirstParam(paramsMap, key)
+		if _, err := strconv.ParseFloat(param, 64); param != "" && err != nil {
+			r.error(b.getLine(key), "interval parameter set in dynamic block: \""+prm.Name+"\" of \""+param+
+				"\" could not be parsed as float and thus Tinker would likely fail")
+		}
+	}
+
+	// Set block number of steps
+	if simulationTime := getFirstParam(paramsMap, "simulationTime"); simulationTime != "" {
+		simTime, err := strconv.ParseFloat(simulationTime, 64)
+		if err != nil {
+			r.error(b.getLine("simulationTime"), fmt.Errorf("failed to convert \"simulationTime\" parameter in \"dynamic\" block from string to float: %w", err).Error())
+		} else if stepInt, err := strconv.ParseFloat(prm.StepInterval, 64); err == nil {
+			prm.NumSteps = strconv.Itoa(int(1e6*simTime/stepInt + 0.5))
+		}
+	}
+
+	return prm
+}
+
+// Generate parameters struct from parameters of block
+func generateBARParams(b block, r *iniReport) BARParameters {
+	paramsMap := b.generateParamsMap()
+	prm := BARParameters{}
+
+	// Check if parameters were specified
+	b.checkIfParamsSpecified(r, "frameInterval", "temp")
+
+	// Set frame interval
+	prm.FrameInterval = getFirstParam(paramsMap, "frameInterval")
+
+	// set temp
+	prm.Temp = getFirstParam(paramsMap, "temp")
+
+	if _, err := strconv.ParseFloat(prm.Temp, 64); prm.Temp != "" && err != nil {
+		r.error(b.getLine("temp"), "temperature parameter set in bar block: \""+prm.Temp+"\" could not be parsed as float and thus Tinker would likely fail")
+	}
+
+	if _, err := strconv.Atoi(prm.FrameInterval); prm.FrameInterval != "" && err != nil {
+		r.error(b.getLine("frameInterval"), "frame interval parameter set in bar block: \""+prm.FrameInterval+"\" could not be parsed as int and thus Tinker would likely fail")
+	}
+
+	// Set extra pairs, given as window:window pairs
+	for _, pair := range paramsMap["extraPairs"] {
+		tokens := strings.Split(pair, ":")
+		if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			r.error(b.getLine("extraPairs"), "entry \""+pair+"\" of parameter \"extraPairs\" in bar block must be of the form window:window")
+			continue
+		}
+		prm.ExtraPairs = append(prm.ExtraPairs, [2]string{tokens[0], tokens[1]})
+	}
+
+	return prm
+}
+
+// Generate parameters struct from parameters of block. All scheduler parameters are optional
+func generateSchedulerParams(b block, r *iniReport) SchedulerParameters {
+	var err error
+	paramsMap := b.generateParamsMap()
+	prm := SchedulerParameters{UserMaxNodes: map[string]int{}, UsageHalfLife: defaultUsageHalfLife, PriorityAging: defaultPriorityAging}
+
+	// Set default cap on nodes per user
+	if len(paramsMap["maxNodesPerUser"]) > 0 {
+		prm.MaxNodesPerUser, err = strconv.Atoi(paramsMap["maxNodesPerUser"][0])
+		if err != nil || prm.MaxNodesPerUser < 0 {
+			r.error(b.getLine("maxNodesPerUser"), "parameter \"maxNodesPerUser\" in block \"scheduler\" must be a whole number (0 for no cap)")
+		}
+	}
+
+	// Set caps of single users, given as user:nodes pairs
+	for _, pair := range paramsMap["userMaxNodes"] {
+		tokens := strings.Split(pair, ":")
+		if len(tokens) != 2 {
+			r.error(b.getLine("userMaxNodes"), "entry \""+pair+"\" of parameter \"userMaxNodes\" in block \"scheduler\" must be of the form user:nodes")
+			continue
+		}
+		prm.UserMaxNodes[tokens[0]], err = strconv.Atoi(tokens[1])
+		if err != nil || prm.UserMaxNodes[tokens[0]] < 0 {
+			r.error(b.getLine("userMaxNodes"), "entry \""+pair+"\" of parameter \"userMaxNodes\" in block \"scheduler\" must give a whole number of nodes")
+		}
+	}
+
+	// Set highest priority a run may be submitted with, so that users cannot put their runs ahead of all others
+	if len(paramsMap["maxPriority"]) > 0 {
+		prm.MaxPriority, err = strconv.Atoi(paramsMap["maxPriority"][0])
+		if err != nil {
+			r.error(b.getLine("maxPriority"), "parameter \"maxPriority\" in block \"scheduler\" must be a whole number")
+		}
+	}
+
+	// Set how fast past usage is forgotten and how fast waiting jobs gain priority, both in hours
+	durations := []struct {
+		key      string
+		duration *time.Duration
+	}{{"usageHalfLife", &prm.UsageHalfLife}, {"priorityAging", &prm.PriorityAging}}
+	for _, d := range durations {
+		if len(paramsMap[d.key]) > 0 {
+			hours, err := strconv.ParseFloat(paramsMap[d.key][0], 64)
+			if err != nil || hours < 0 {
+				r.error(b.getLine(d.key), "parameter \""+d.key+"\" in block \"scheduler\" must be a number of hours (0 disables it)")
+				continue
+			}
+			*d.duration = time.Duration(hours * float64(time.Hour))
+		}
+	}
+
+	return prm
+}
+
+// Generate parameters struct from parameters of block. Each way of notifying is optional
+func generateNotifyParams(b block, r *iniReport) NotifyParameters {
+	paramsMap := b.generateParamsMap()
+	prm := NotifyParameters{}
+
+	if len(paramsMap["webhook"]) > 0 {
+		prm.Webhook = paramsMap["webhook"][0]
+		if !strings.HasPrefix(prm.Webhook, "http://") && !strings.HasPrefix(prm.Webhook, "https://") {
+			r.error(b.getLine("webhook"), "parameter \"webhook\" in block \"notify\" must be an http:// or https:// URL")
+		}
+	}
+
+	// Email needs an SMTP server to send through
+	prm.Email = paramsMap["email"]
+	if len(prm.Email) > 0 {
+		for _, key := range []string{"smtpServer", "smtpFrom"} {
+			if len(paramsMap[key]) < 1 {
+				r.error(b.getLine("email"), "block \"notify\" sends email: parameter \""+key+"\" has not been set")
+			}
+		}
+		prm.SMTPServer = getFirstParam(paramsMap, "smtpServer")
+		if !strings.Contains(prm.SMTPServer, ":") {
+			prm.SMTPServer += ":25"
+		}
+		prm.SMTPFrom = getFirstParam(paramsMap, "smtpFrom")
+		if len(paramsMap["smtpUser"]) > 0 {
+			prm.SMTPUser = paramsMap["smtpUser"][0]
+			prm.SMTPPassword = os.Getenv("GOFEP_SMTP_PASSWORD")
+			if len(paramsMap["smtpPassword"]) > 0 {
+				prm.SMTPPassword = paramsMap["smtpPassword"][0]
+			}
+		}
+	}
+
+	// The command is the rest of the line
+	prm.Command = b.getRaw("command")
+
+	// Set what to notify about
+	prm.On = []string{"stages", "failures", "results"}
+	if len(paramsMap["on"]) > 0 {
+		prm.On = paramsMap["on"]
+		for _, on := range prm.On {
+			if on != "stages" && on != "failures" && on != "results" {
+				r.error(b.getLine("on"), "parameter \"on\" in block \"notify\" must list some of \"stages\", \"failures\" and \"results\"")
+				break
+			}
+		}
+	}
+
+	return prm
+}
+
+// Generate parameters struct from parameters of block. Each hook is the rest of its line
+func generateHookParams(b block) HookParameters {
+	return HookParameters{
+		PreSetup:       b.getRaw("preSetup"),
+		PostSetup:      b.getRaw("postSetup"),
+		PreDynamic:     b.getRaw("preDynamic"),
+		PostDynamic:    b.getRaw("postDynamic"),
+		PreRepetition:  b.getRaw("preRepetition"),
+		PostRepetition: b.getRaw("postRepetition"),
+		PreBAR1:        b.getRaw("preBAR1"),
+		PostBAR1:       b.getRaw("postBAR1"),
+		PreBAR2:        b.getRaw("preBAR2"),
+		PostBAR2:       b.getRaw("postBAR2"),
+		PreResults:     b.getRaw("preResults"),
+		PostResults:    b.getRaw("postResults"),
+	}
+}
+
+// Generate params data type from parameters of block
+func generateGenParams(b block, r *iniReport, required []string) GeneralParameters {
+	var err error
+	paramsMap := b.generateParamsMap()
+	prm := GeneralParameters{}
+
+	// Check if parameters were specified
+	b.checkIfParamsSpecified(r, required...)
+
+	// Check if targetDirectory was specified
+	_, ok := paramsMap["targetDirectory"]
+	if ok {
+		// prm.targetDirectory is specified - xyz/key/prm paths are assumed to be absolute paths
+		prm.TargetDirectory = getFirstParam(paramsMap, "targetDirectory")
+		prm.XYZPath = getFirstParam(paramsMap, "xyz")
+		prm.KeyPath = getFirstParam(paramsMap, "key")
+		prm.PrmPath = getFirstParam(paramsMap, "prm")
+		prm.NodeINIPath = getFirstParam(paramsMap, "nodeINI")
+	} else {
+		// prm.targetDirectory is not specified - assumed to be current working directory - xyz/key/prm paths are
+		// assumed to be relative to CWD
+		prm.TargetDirectory, err = os.Getwd()
+		if err != nil {
+			r.error(b.line, fmt.Errorf("error while setting target directory to current working directory: %w", err).Error())
+		}
+		prm.XYZPath = filepath.Join(prm.TargetDirectory, getFirstParam(paramsMap, "xyz"))
+		prm.KeyPath = filepath.Join(prm.TargetDirectory, getFirstParam(paramsMap, "key"))
+		prm.PrmPath = filepath.Join(prm.TargetDirectory, getFirstParam(paramsMap, "prm"))
+		prm.NodeINIPath = filepath.Join(prm.TargetDirectory, getFirstParam(paramsMap, "nodeINI"))
+	}
+
+	prm.NodePreference = getFirstParam(paramsMap, "nodePreference")
+
+	prm.IntelSource = getFirstParam(paramsMap, "intelSource")
+	prm.Cuda8Source = getFirstParam(paramsMap, "cuda8Source")
+	prm.Cuda10Source = getFirstParam(paramsMap, "cuda10Source")
+	prm.Cuda8Home = getFirstParam(paramsMap, "cuda8Home")
+	prm.Cuda10Home = getFirstParam(paramsMap, "cuda10Home")
+
+	// Set optional throughput estimate used to plan runs
+	prm.NsPerDay = defaultNsPerDay
+	if len(paramsMap["nsPerDay"]) > 0 {
+		prm.NsPerDay, err = strconv.ParseFloat(paramsMap["nsPerDay"][0], 64)
+		if err != nil || prm.NsPerDay <= 0 {
+			r.error(b.getLine("nsPerDay"), "parameter \"nsPerDay\" in block \"general\" must be a positive number")
+		}
+	}
+
+	// Set optional settings for live progress of dynamic
+	prm.ProgressInterval = defaultProgressInterval
+	if len(paramsMap["progressInterval"]) > 0 {
+		seconds, err := strconv.ParseFloat(paramsMap["progressInterval"][0], 64)
+		if err != nil || seconds < 0 {
+			r.error(b.getLine("progressInterval"), "parameter \"progressInterval\" in block \"general\" must be a number of seconds (0 disables progress)")
+		} else {
+			prm.ProgressInterval = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	prm.LogAccess = "shared"
+	if len(paramsMap["logAccess"]) > 0 {
+		prm.LogAccess = paramsMap["logAccess"][0]
+		if prm.LogAccess != "shared" && prm.LogAccess != "ssh" {
+			r.error(b.getLine("logAccess"), "parameter \"logAccess\" in block \"general\" must be \"shared\" or \"ssh\"")
+		}
+	}
+
+	// Check files specified really exist (files used on cluster nodes are checked by the backend before running)
+	files := []struct {
+		key  string
+		path string
+	}{{"key", prm.KeyPath}, {"xyz", prm.XYZPath}, {"prm", prm.PrmPath}, {"nodeINI", prm.NodeINIPath}}
+	for _, file := range files {
+		if len(paramsMap[file.key]) < 1 {
+			continue
+		}
+		fileExists, err := pathExists(file.path)
+		if err != nil {
+			r.error(b.getLine(file.key), fmt.Errorf("error while verifying existence of file \"%s\": %w", file.path, err).Error())
+		} else if fileExists == false {
+			r.error(b.getLine(file.key), "file specified in INI \""+file.path+"\" does not exist")
+		}
+	}
+
+	return prm
+}
+
+// Settings holds all parameters read from a settings INI file
+type Settings struct {
+	// Warnings are problems found in the INI file that don't stop goFEP from running, such as unknown parameters
+	Warnings []InputIssue
+	General  GeneralParameters
+	Setup    SetupParameters
+	// dynamic blocks, sorted by their order
+	Dynamic []DynamicParameters
+	BAR     BARParameters
+	// Scheduler is only used by the server
+	Scheduler SchedulerParameters
+	Notify    NotifyParameters
+	Hooks     HookParameters
+}
+
+// GeneralParameters contains fields for parameters relevant to multiple steps
+type GeneralParameters struct {
+	TargetDirectory string
+	XYZPath         string
+	KeyPath         string
+	PrmPath         string
+	NodeINIPath     string
+	NodePreference  string
+	IntelSource     string
+	Cuda8Source     string
+	Cuda8Home       string
+	Cuda10Source    string
+	Cuda10Home      string
+	// estimated throughput of dynamic, used to plan runs
+	NsPerDay float64
+	// how often progress of running dynamic jobs is reported (0 disables it), and whether their logs are read from the
+	// shared file system ("shared") or over ssh on the node running them ("ssh")
+	ProgressInterval time.Duration
+	LogAccess        string
+}
+
+// SetupParameters contains fields for parameters relevant to gofep_dynamic_setup
+type SetupParameters struct {
+	Vdw []string
+	Ele []string
+	Rst []string
+	// Generated is set when the lists were generated from a schedule rather than listed in the INI file
+	Generated bool
+	// Overrides change the inputs of single windows
+	Overrides []WindowOverride
+	// Seeding is "sequential" if each window starts from the last frame of block SeedBlock of the window before it
+	// rather than from the input xyz file, which is "independent", the default
+	Seeding   string
+	SeedBlock string
+}
+
+// DynamicParameters contains fields for parameters relevant to gofep_dynamic
+type DynamicParameters struct {
+	Name         string
+	Order        int
+	Repetitions  int
+	StepInterval string
+	SaveInterval string
+	NumSteps     string
+	Ensemble     string
+	Temp         string
+	Pressure     string
+}
+
+// BARParameters contains fields for parameters relevant to gofep_bar
+type BARParameters struct {
+	Temp          string
+	FrameInterval string
+	// ExtraPairs are pairs of windows apart along the lambda path to run BAR on as well, each window given by name or
+	// by index along the path
+	ExtraPairs [][2]string
+}
+
+// SchedulerParameters contains fields for parameters relevant to gofep_scheduler, used when a server shares nodes
+// between runs
+type SchedulerParameters struct {
+	// MaxNodesPerUser caps the nodes the jobs of one user may hold at once (0 for no cap), unless UserMaxNodes sets a
+	// cap for that user
+	MaxNodesPerUser int
+	UserMaxNodes    map[string]int
+	// UsageHalfLife is the time after which GPU-hours used by a user count half as much when sharing nodes (0 to never
+	// forget them)
+	UsageHalfLife time.Duration
+	// PriorityAging is the time a job must wait to gain one level of priority (0 to disable)
+	PriorityAging time.Duration
+	// MaxPriority is the highest priority a run may be submitted with (default 0)
+	MaxPriority int
+}
+
+// NotifyParameters contains fields for parameters relevant to gofep_notify. Notifications are sent to every way set
+type NotifyParameters struct {
+	// Webhook is a URL notifications are posted to as JSON
+	Webhook string
+	// Email lists addresses notifications are mailed to through SMTPServer (host:port) from SMTPFrom, logging in as
+	// SMTPUser if set
+	Email        []string
+	SMTPServer   string
+	SMTPFrom     string
+	SMTPUser     string
+	SMTPPassword string
+	// Command is a shell command run for each notification
+	Command string
+	// On lists what to notify about: "stages" ending, job "failures" and "results" being written
+	On []string
+}
+
+// HookParameters contains the shell commands gofep_hooks runs before and after each part of a run. Empty ones are
+// skipped
+type HookParameters struct {
+	// Run once around setup
+	PreSetup  string
+	PostSetup string
+	// Run once around each dynamic block
+	PreDynamic  string
+	PostDynamic string
+	// Run around each repetition of each window in a dynamic block
+	PreRepetition  string
+	PostRepetition string
+	// Run once around BAR1 and BAR2
+	PreBAR1  string
+	PostBAR1 string
+	PreBAR2  string
+	PostBAR2 string
+	// Run around collecting results
+	PreResults  string
+	PostResults string
+}
+
+// Derived from a brace enclosed section of the ini file
+type block struct {
+	// type: setup, bar, or dynamic
+	blockType string
+	// line of the ini file the block starts on, from 1, and the line its parameters start after (that of its "{")
+	line int
+	open int
+	// parameters in the order they are given
+	params []param
+}
@@ -0,0 +1,70 @@
+package fep
+
+import (
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Jobs: contains the record kept of every script goFEP runs on a node
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JobKind identifies which Tinker program a job runs
+type JobKind string
+
+const (
+	// DynamicJob runs dynamic_omm.x in one window for one repetition of one dynamic block
+	DynamicJob JobKind = "dynamic"
+	// BAR1Job runs part 1 of bar_omm.x between two windows
+	BAR1Job JobKind = "bar1"
+	// BAR2Job runs part 2 of bar_omm.x on the bar file written by BAR1
+	BAR2Job JobKind = "bar2"
+)
+
+// Job records one script run on a node
+type Job struct {
+	Kind JobKind
+	// Dir is the window directory for dynamic jobs and the BAR pair directory for BAR jobs
+	Dir string
+	// Block and Repetition identify the dynamic block and its repetition, and Ns the simulation time in ns the job
+	// covers (dynamic jobs only)
+	Block      string
+	Repetition int
+	Ns         float64
+	// Node is the name of the node the job ran on
+	Node   string
+	Script string
+	// Output holds everything the script wrote to stdout and stderr
+	Output   []byte
+	Started  time.Time
+	Finished time.Time
+	// Err is non-nil if the job failed
+	Err error
+	// Result holds the free energy of the pair for BAR2 jobs that finished
+	Result *PairResult
+}
+
+// Name returns a short description of the job, e.g. "dynamic prod #2 vdw050ele000"
+func (j *Job) Name() string {
+	if j.Kind == DynamicJob {
+		return string(j.Kind) + " " + j.Block + " #" + strconv.Itoa(j.Repetition+1) + " " + filepath.Base(j.Dir)
+	}
+	return string(j.Kind) + " " + filepath.Base(j.Dir)
+}
+
+// Duration returns how long the job took
+func (j *Job) Duration() time.Duration {
+	return j.Finished.Sub(j.Started)
+}
+
+// CountFailed returns the number of jobs that failed
+func CountFailed(jobs []Job) int {
+	failed := 0
+	for _, job := range jobs {
+		if job.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,331 @@
+package fep
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Journal: contains the run journal, a file of JSON line events kept in the target directory, and the state of a run
+// rebuilt from it
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// OpenJournal opens the run journal in the target directory for appending, creating it if needed. Subscribe
+// JSONLinesHandler on the returned file to an emitter to record a run
+func OpenJournal(targetDirectory string) (*os.File, error) {
+	journalPath := filepath.Join(targetDirectory, JournalFileName)
+	file, err := os.OpenFile(journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, octalPermissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run journal %s: %w", journalPath, err)
+	}
+	return file, nil
+}
+
+// ReadJournal reads all events in the run journal of the target directory. Lines that cannot be parsed, such as one
+// still being written, are skipped
+func ReadJournal(targetDirectory string) ([]Event, error) {
+	journalPath := filepath.Join(targetDirectory, JournalFileName)
+	file, err := os.Open(journalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run journal %s: %w", journalPath, err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var ev Event
+		if json.Unmarshal(scanner.Bytes(), &ev) == nil {
+			events = append(events, ev)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return events, fmt.Errorf("failed to read run journal %s: %w", journalPath, err)
+	}
+	return events, nil
+}
+
+// Job states used in run state
+const (
+	StateQueued   string = "queued"
+	StateRunning  string = "running"
+	StateFinished string = "finished"
+	StateFailed   string = "failed"
+)
+
+// WindowState is the latest dynamic job seen in one lambda window
+type WindowState struct {
+	Window     string        `json:"window"`
+	Dir        string        `json:"dir"`
+	Block      string        `json:"block"`
+	Repetition int           `json:"repetition"`
+	State      string        `json:"state"`
+	Node       string        `json:"node"`
+	Progress   float64       `json:"progress"`
+	NsPerDay   float64       `json:"ns_per_day"`
+	ETA        time.Duration `json:"-"`
+	Updated    time.Time     `json:"updated"`
+}
+
+// PairState is the latest BAR job seen for one pair of windows, along with its free energy once BAR2 has finished
+type PairState struct {
+	Pair   string      `json:"pair"`
+	Dir    string      `json:"dir"`
+	Kind   JobKind     `json:"kind"`
+	State  string      `json:"state"`
+	Node   string      `json:"node"`
+	Result *PairResult `json:"result,omitempty"`
+}
+
+// NodeState is the last known status of a node and the number of jobs running on it
+type NodeState struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Running int    `json:"running"`
+}
+
+// JobState is the latest state of one job, identified by its name
+type JobState struct {
+	Name       string    `json:"name"`
+	Kind       JobKind   `json:"kind"`
+	Dir        string    `json:"dir"`
+	Block      string    `json:"block,omitempty"`
+	Repetition int       `json:"repetition,omitempty"`
+	Node       string    `json:"node"`
+	State      string    `json:"state"`
+	Ns         float64   `json:"ns,omitempty"`
+	Progress   float64   `json:"progress,omitempty"`
+	NsPerDay   float64   `json:"ns_per_day,omitempty"`
+	Queued     time.Time `json:"queued"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RunState is the state of a run rebuilt from its events
+type RunState struct {
+	Stage        string        `json:"stage"`
+	StageRunning bool          `json:"stage_running"`
+	StageError   string        `json:"stage_error,omitempty"`
+	Started      time.Time     `json:"started"`
+	Updated      time.Time     `json:"updated"`
+	Windows      []WindowState `json:"windows"`
+	Pairs        []PairState   `json:"pairs"`
+	Nodes        []NodeState   `json:"nodes"`
+	Jobs         []JobState    `json:"jobs"`
+	// Failed counts failed jobs over the whole run
+	Failed int `json:"failed"`
+	// Recent holds the most recent events, oldest first
+	Recent []Event `json:"-"`
+}
+
+// NewRunState creates an empty run state
+func NewRunState() *RunState {
+	return &RunState{}
+}
+
+// BuildRunState folds events into a new run state
+func BuildRunState(events []Event) *RunState {
+	rs := NewRunState()
+	for _, ev := range events {
+		rs.Apply(ev)
+	}
+	return rs
+}
+
+// Apply updates the run state with one event
+func (rs *RunState) Apply(ev Event) {
+	if rs.Started.IsZero() {
+		rs.Started = ev.Time
+	}
+	rs.Updated = ev.Time
+	rs.Recent = append(rs.Recent, ev)
+	if len(rs.Recent) > runStateRecentEvents {
+		rs.Recent = rs.Recent[len(rs.Recent)-runStateRecentEvents:]
+	}
+
+	switch ev.Type {
+	case StageStarted:
+		rs.Stage = ev.Stage
+		rs.StageRunning = true
+		rs.StageError = ""
+	case StageFinished:
+		rs.Stage = ev.Stage
+		rs.StageRunning = false
+		rs.StageError = ev.Error
+	case NodeStatusChanged:
+		rs.node(ev.Node).Status = ev.Status
+	case JobQueued, JobStarted, JobProgress, JobFinished, JobFailed:
+		rs.applyJob(ev)
+	}
+}
+
+// Update window or pair state with a job event
+func (rs *RunState) applyJob(ev Event) {
+	state := StateRunning
+	switch ev.Type {
+	case JobQueued:
+		state = StateQueued
+	case JobFinished:
+		state = StateFinished
+	case JobFailed:
+		state = StateFailed
+		rs.Failed++
+	}
+
+	// Record job
+	job := rs.job(ev.Job)
+	job.Kind, job.Dir, job.Block, job.Repetition, job.Node, job.State = ev.Kind, ev.Dir, ev.Block, ev.Repetition, ev.Node, state
+	if ev.Ns > 0 {
+		job.Ns = ev.Ns
+	}
+	switch ev.Type {
+	case JobQueued:
+		// a job queued again is a new attempt
+		job.Queued, job.Started, job.Finished = ev.Time, time.Time{}, time.Time{}
+		job.Progress, job.NsPerDay, job.Error = 0, 0, ""
+	case JobStarted:
+		job.Started = ev.Time
+	case JobProgress:
+		job.Progress, job.NsPerDay = ev.Progress, ev.NsPerDay
+	case JobFinished, JobFailed:
+		job.Finished = ev.Time
+		job.Error = ev.Error
+		job.NsPerDay = 0
+		if ev.Type == JobFinished {
+			job.Progress = 1
+		}
+	}
+
+	// Count jobs running on each node
+	if ev.Node != "" {
+		n := rs.node(ev.Node)
+		if ev.Type == JobStarted {
+			n.Running++
+		} else if (ev.Type == JobFinished || ev.Type == JobFailed) && n.Running > 0 {
+			n.Running--
+		}
+	}
+
+	if ev.Kind == DynamicJob {
+		w := rs.window(ev.Dir)
+		// A new job in the window resets its progress
+		if ev.Type == JobQueued || w.Block != ev.Block || w.Repetition != ev.Repetition {
+			w.Progress, w.NsPerDay, w.ETA = 0, 0, 0
+		}
+		w.Block = ev.Block
+		w.Repetition = ev.Repetition
+		w.State = state
+		w.Node = ev.Node
+		w.Updated = ev.Time
+		if ev.Type == JobProgress {
+			w.Progress = ev.Progress
+			w.NsPerDay = ev.NsPerDay
+			w.ETA = time.Duration(ev.ETASeconds * float64(time.Second))
+		} else if ev.Type == JobFinished {
+			w.Progress = 1
+			w.ETA = 0
+		}
+		return
+	}
+
+	p := rs.pair(ev.Dir)
+	p.Kind = ev.Kind
+	p.State = state
+	p.Node = ev.Node
+	if ev.Result != nil {
+		p.Result = ev.Result
+	}
+}
+
+// Get state of job with name, adding it if new
+func (rs *RunState) job(name string) *JobState {
+	for i := range rs.Jobs {
+		if rs.Jobs[i].Name == name {
+			return &rs.Jobs[i]
+		}
+	}
+	rs.Jobs = append(rs.Jobs, JobState{Name: name})
+	return &rs.Jobs[len(rs.Jobs)-1]
+}
+
+// JobCounts returns the number of jobs of each kind in each state
+func (rs *RunState) JobCounts() map[JobKind]map[string]int {
+	counts := map[JobKind]map[string]int{}
+	for _, job := range rs.Jobs {
+		if counts[job.Kind] == nil {
+			counts[job.Kind] = map[string]int{}
+		}
+		counts[job.Kind][job.State]++
+	}
+	return counts
+}
+
+// GPUHours returns the GPU time used by all jobs up to now, one GPU per job. Jobs still running count until now
+func (rs *RunState) GPUHours(now time.Time) float64 {
+	hours := 0.0
+	for _, job := range rs.Jobs {
+		if job.Started.IsZero() {
+			continue
+		}
+		end := job.Finished
+		if end.IsZero() {
+			end = now
+		}
+		hours += end.Sub(job.Started).Hours()
+	}
+	return hours
+}
+
+// SimulatedNs returns the simulation time in ns completed by dynamic jobs, counting running jobs by their progress
+func (rs *RunState) SimulatedNs() float64 {
+	ns := 0.0
+	for _, job := range rs.Jobs {
+		if job.Kind == DynamicJob {
+			ns += job.Progress * job.Ns
+		}
+	}
+	return ns
+}
+
+// Get state of window in dir, adding it if new
+func (rs *RunState) window(dir string) *WindowState {
+	for i := range rs.Windows {
+		if rs.Windows[i].Dir == dir {
+			return &rs.Windows[i]
+		}
+	}
+	rs.Windows = append(rs.Windows, WindowState{Window: filepath.Base(dir), Dir: dir})
+	sort.Slice(rs.Windows, func(i, j int) bool { return rs.Windows[i].Window < rs.Windows[j].Window })
+	return rs.window(dir)
+}
+
+// Get state of BAR pair in dir, adding it if new
+func (rs *RunState) pair(dir string) *PairState {
+	for i := range rs.Pairs {
+		if rs.Pairs[i].Dir == dir {
+			return &rs.Pairs[i]
+		}
+	}
+	rs.Pairs = append(rs.Pairs, PairState{Pair: filepath.Base(dir), Dir: dir})
+	sort.Slice(rs.Pairs, func(i, j int) bool { return rs.Pairs[i].Pair < rs.Pairs[j].Pair })
+	return rs.pair(dir)
+}
+
+// Get state of node, adding it if new
+func (rs *RunState) node(name string) *NodeState {
+	for i := range rs.Nodes {
+		if rs.Nodes[i].Name == name {
+			return &rs.Nodes[i]
+		}
+	}
+	rs.Nodes = append(rs.Nodes, NodeState{Name: name})
+	sort.Slice(rs.Nodes, func(i, j int) bool { return rs.Nodes[i].Name < rs.Nodes[j].Name })
+	return rs.node(name)
+}
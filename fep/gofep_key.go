@@ -0,0 +1,160 @@
+package fep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Key: contains a model of Tinker key files, so setup can set the keywords it needs while leaving everything else in
+// the file as it was written
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A Tinker key file, line by line
+type keyFile struct {
+	lines []keyLine
+}
+
+// A line of a key file: a keyword with its values, a comment, both or neither. Keywords are matched as Tinker matches
+// them, ignoring case
+type keyLine struct {
+	// keyword as written, "" for a blank or comment line
+	keyword string
+	values  []string
+	// comment is the rest of the line from the first "#" that starts a word, with the space before it
+	comment string
+	// raw is the line as read, written back unchanged unless the line is edited, and line its number from 1, or 0 if
+	// the line was added
+	raw    string
+	line   int
+	edited bool
+}
+
+// Read the key file at path
+func readKeyFile(path string) (*keyFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	key := &keyFile{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		l := parseKeyLine(scanner.Text())
+		l.line = len(key.lines) + 1
+		key.lines = append(key.lines, l)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// Split a line of a key file into its keyword, values and comment
+func parseKeyLine(line string) keyLine {
+	l := keyLine{raw: line}
+	content := line
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			content = line[:i]
+			l.comment = line[len(strings.TrimRight(content, " \t")):]
+			break
+		}
+	}
+	tokens := strings.Fields(content)
+	if len(tokens) > 0 {
+		l.keyword = tokens[0]
+		l.values = tokens[1:]
+	}
+	return l
+}
+
+// Write the line, rebuilding it from its keyword, values and comment if it was edited
+func (l keyLine) String() string {
+	if !l.edited {
+		return l.raw
+	}
+	line := strings.Join(append([]string{l.keyword}, l.values...), " ")
+	if l.comment != "" && !strings.HasPrefix(l.comment, " ") && !strings.HasPrefix(l.comment, "\t") {
+		line += " "
+	}
+	return line + l.comment
+}
+
+// Check whether the line sets keyword
+func (l keyLine) is(keyword string) bool {
+	return strings.EqualFold(l.keyword, keyword)
+}
+
+// Get the values of the last line setting keyword, which is the one Tinker uses, and whether there is one
+func (k *keyFile) get(keyword string) ([]string, bool) {
+	for i := len(k.lines) - 1; i >= 0; i-- {
+		if k.lines[i].is(keyword) {
+			return k.lines[i].values, true
+		}
+	}
+	return nil, false
+}
+
+// Set the values of every line setting keyword. If there is none, a line is added, at the start of the file if first
+// is set or else at its end
+func (k *keyFile) set(keyword string, first bool, values ...string) {
+	found := false
+	for i := range k.lines {
+		if k.lines[i].is(keyword) {
+			k.lines[i].values = values
+			k.lines[i].edited = true
+			found = true
+		}
+	}
+	if found {
+		return
+	}
+	l := keyLine{keyword: keyword, values: values, edited: true}
+	if first {
+		k.lines = append([]keyLine{l}, k.lines...)
+	} else {
+		k.lines = append(k.lines, l)
+	}
+}
+
+// Add a line setting keyword at the end of the file, for keywords Tinker reads from every line that sets them
+func (k *keyFile) add(keyword string, values ...string) {
+	k.lines = append(k.lines, keyLine{keyword: keyword, values: values, edited: true})
+}
+
+// Set value number index of every line setting keyword, returning an error if there is no such line or a line has
+// too few values
+func (k *keyFile) setValue(keyword string, index int, value string) error {
+	found := false
+	for i := range k.lines {
+		if !k.lines[i].is(keyword) {
+			continue
+		}
+		if len(k.lines[i].values) <= index {
+			return errors.New("\"" + strings.TrimSpace(k.lines[i].raw) + "\" has fewer than " + fmt.Sprint(index+1) + " values")
+		}
+		values := append([]string{}, k.lines[i].values...)
+		values[index] = value
+		k.lines[i].values = values
+		k.lines[i].edited = true
+		found = true
+	}
+	if !found {
+		return errors.New("the key file has no " + keyword + " line")
+	}
+	return nil
+}
+
+// Write the key file as text
+func (k *keyFile) String() string {
+	var sb strings.Builder
+	for _, l := range k.lines {
+		sb.WriteString(l.String() + "\n")
+	}
+	return sb.String()
+}
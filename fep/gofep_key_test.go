@@ -0,0 +1,51 @@
+package fep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWindowKeyLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sourcePath := filepath.Join(dir, "lig.key")
+	err = ioutil.WriteFile(sourcePath, []byte(`parameters water.prm
+ligand -1 3
+restrain-position 1 0.0 0.0 0.0 10.0  # keep oxygen in place
+cutoff 9.0
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prm := &SetupParameters{Vdw: []string{"1.0", "0.5"}, Ele: []string{"1.0", "0.0"}}
+
+	// Lines of keywords that can be repeated are added after those of the key file, others replace them
+	keyLines := [][]string{
+		{"restrain-position", "2", "0.0", "0.0", "0.0", "5.0"},
+		{"restrain-position", "3", "0.0", "0.0", "0.0", "5.0"},
+		{"cutoff", "7.0"},
+		{"LIGAND", "4"},
+	}
+	key, err := getWindowKeyFile(sourcePath, "vdw0.5ele0.0", prm, 1, "/prm/water.prm", keyLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `parameters /prm/water.prm
+ligand -1 3
+restrain-position 1 0.0 0.0 0.0 10.0  # keep oxygen in place
+cutoff 7.0
+vdw-lambda 0.5
+ele-lambda 0.0
+restrain-position 2 0.0 0.0 0.0 5.0
+restrain-position 3 0.0 0.0 0.0 5.0
+LIGAND 4
+`
+	if got := key.String(); got != want {
+		t.Errorf("got key file\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,299 @@
+package fep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Check if individual node is free, set IsFree field for that node
+func updateNodeStatus(n *Node, b Backend, tempFilePath string, wg *sync.WaitGroup) {
+	// ssh into node, run "nvidia-smi", and capture output
+	out, err := b.Run(tempFilePath, n.Name)
+	if err != nil {
+		fmt.Print("error encountered on " + n.Name + ": ")
+		fmt.Print(err)
+		fmt.Println("\nout = " + string(out))
+		fmt.Println("The most likely cause of this error is that you did not ssh into bme-nova before running gofep, " +
+			"but it is also possible the node is down. Check node manually to verify.")
+	}
+	outString := string(out)
+
+	// Set to true by default
+	n.IsFree = true
+
+	// split nvidia-smi output into lines
+	lines := strings.Split(outString, "\n")
+
+	// Set default value of line to containing the first process entry to the last line
+	readFromLine := len(lines) - 1
+	// Try to find actual value of line containing first process entry. Ignore lines at beginning and end known to be too
+	// early/late to be this line
+	for i := 11; i < len(lines)-1; i++ {
+		if strings.Count(lines[i], "PID") > 0 {
+			readFromLine = i + 2
+		}
+	}
+	// Get GPU number of node as int to compare GPU number of process with
+	cardNum, err := strconv.Atoi(n.CardNumber)
+	if err != nil {
+		fmt.Println("Warning: failed to convert cardNumber \"" + n.CardNumber + "\" of node " + n.Name + " from string to int")
+		fmt.Println("assuming node " + n.Name + " is unavailable and continuing...")
+		n.IsFree = false
+	}
+	// Look for processes starting at line
+	for i := readFromLine; i < len(lines)-1; i++ {
+		tokens := strings.Fields(lines[i])
+		// if line has a token in the position signifying GPU number...
+		if len(tokens) > 1 {
+			// convert that token to int
+			processGPU, err := strconv.Atoi(tokens[1])
+			// if no error occurred
+			if err == nil {
+				// check process gpu num against card num
+				if processGPU == cardNum {
+					// if equal node is busy
+					n.IsFree = false
+				}
+			}
+		}
+	}
+
+	wg.Done()
+}
+
+// NodeGroup holds all nodes in the cluster along with which of them were free when status was last updated
+type NodeGroup struct {
+	FreeNodeIndices []int
+	Nodes           []Node
+	// Backend runs all scripts on nodes of the group. If nil, scripts are run with ShellBackend
+	Backend Backend
+	// Events receives progress events from the managers and status updates. May be nil
+	Events *Emitter
+	// Scheduler, if set, grants nodes one job at a time from a pool shared with other runs, in which case Nodes and
+	// FreeNodeIndices are not used. RunID names this run to the scheduler
+	Scheduler *Scheduler
+	RunID     string
+	// Hooks are run around dynamic blocks, repetitions and BAR stages. May be nil
+	Hooks *HookParameters
+
+	// build records steps as they finish while a manager runs
+	build *buildState
+	// onWindowDone, if set, is called with the window and node of a dynamic job that finished the last step of its
+	// window
+	onWindowDone func(window string, n *Node)
+}
+
+// Get backend scripts are run with
+func (ng *NodeGroup) backend() Backend {
+	if ng.Backend == nil {
+		return ShellBackend{}
+	}
+	return ng.Backend
+}
+
+// Get hooks run by the managers
+func (ng *NodeGroup) hooks() *HookParameters {
+	if ng.Hooks == nil {
+		return &HookParameters{}
+	}
+	return ng.Hooks
+}
+
+// Write a shell script that checks node status and deposit it in chosen directory
+func createTempNodeCheckScript(tempDir string) (string, error) {
+	// mkdir if not exists
+	err := os.MkdirAll(tempDir, octalPermissions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory %s: %w", tempDir, err)
+	}
+	// Write temp bash script in temp dir to check node status
+	tempFilePath := filepath.Join(tempDir, nodeCheckScriptName)
+	err = writeFile(tempFilePath, "#!/bin/bash\n"+
+		"node=$1\n"+
+		"ssh -o \"StrictHostKeyChecking no\" $node nvidia-smi\n")
+	if err != nil {
+		return "", err
+	}
+
+	return tempFilePath, nil
+}
+
+// UpdateStatus updates the IsFree field of all nodes in the group, and the list of free node indices
+func (ng *NodeGroup) UpdateStatus(directory string) error {
+
+	tempDir := filepath.Join(directory, "temp")
+	tempFilePath, err := createTempNodeCheckScript(tempDir)
+	if err != nil {
+		return err
+	}
+
+	// Remember status of each node so changes can be reported
+	wasFree := make([]bool, len(ng.Nodes))
+	for i := 0; i < len(ng.Nodes); i++ {
+		wasFree[i] = ng.Nodes[i].IsFree
+	}
+
+	// Create new wait group to determine when all goroutines have finished
+	wg := sync.WaitGroup{}
+
+	// iterate through all nodes
+	for i := 0; i < len(ng.Nodes); i++ {
+		// Add one to wait group
+		wg.Add(1)
+		// check if node is free, send node with updated "isFree" param to ch, subtracting 1 from wg in the process
+		go updateNodeStatus(&ng.Nodes[i], ng.backend(), tempFilePath, &wg)
+	}
+	// Wait for all goroutines to finish, then close channel
+	wg.Wait()
+
+	// Update free node indices
+	ng.FreeNodeIndices = make([]int, 0)
+	// iterate through all nodes in group
+	for i := 0; i < len(ng.Nodes); i++ {
+		n := &ng.Nodes[i]
+		// if node is free, add node index to free indices
+		if n.IsFree {
+			ng.FreeNodeIndices = append(ng.FreeNodeIndices, i)
+		}
+		// report nodes seen for the first time or whose status changed
+		if !n.statusKnown || n.IsFree != wasFree[i] {
+			status := "busy"
+			if n.IsFree {
+				status = "free"
+			}
+			ng.Events.Emit(Event{Type: NodeStatusChanged, Node: n.Name, Status: status})
+		}
+		n.statusKnown = true
+	}
+	return nil
+}
+
+// GetNodeGroup reads the node INI file specified in the general parameters and sorts its nodes by the node preference
+func GetNodeGroup(genPrm *GeneralParameters) (*NodeGroup, error) {
+
+	// If source prm path is not absolute already, redefine from target directory
+	nodeIniPath, err := filepath.Abs(genPrm.NodeINIPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute absolute path to node INI file location \"%s\" specified in general block of INI: %w", genPrm.NodeINIPath, err)
+	}
+
+	// Open INI file
+	file, err := os.Open(nodeIniPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open node INI at %s: %w", nodeIniPath, err)
+	}
+	defer file.Close()
+
+	// Read file line by line and save nodes
+	ng := &NodeGroup{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// get next line
+		line := scanner.Text()
+		// check that line isn't empty before cleaning
+		if len(line) > 0 {
+			// clean line of comments
+			cleanedLine := cleanLine(line)
+			// Check that line isn't empty after cleaning (it will often be if entire line was a comment)
+			if len(strings.TrimSpace(cleanedLine)) > 0 {
+				// split line into tokens by comma
+				tokens := strings.Split(cleanedLine, ",")
+				if len(tokens) < 7 {
+					return nil, errors.New("node INI entry \"" + cleanedLine + "\" in " + nodeIniPath + " does not have 7 comma separated fields")
+				}
+
+				// save parameters to a new node
+				thisNode := Node{}
+				thisNode.Name = tokens[0]
+				thisNode.CardNumber = tokens[1]
+				thisNode.CardManufacturer = tokens[2]
+				thisNode.CardGeneration = tokens[3]
+				thisNode.CardModel = tokens[4]
+				thisNode.Memory, err = strconv.Atoi(tokens[5])
+				if err != nil {
+					return nil, errors.New("failed to convert memory entry " + tokens[5] + " from string to int while reading node INI at " + nodeIniPath)
+				}
+				thisNode.PerformanceIndex, err = strconv.Atoi(tokens[6])
+				if err != nil {
+					return nil, errors.New("failed to convert performance index entry " + tokens[6] + " from string to int while reading node INI at " + nodeIniPath)
+				}
+
+				// append node to nodeGroup
+				ng.Nodes = append(ng.Nodes, thisNode)
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read node INI at %s: %w", nodeIniPath, err)
+	}
+
+	// Sort nodes before returning by desired criteria
+	switch genPrm.NodePreference {
+	case "fastest":
+		// sort by highest to lowest performance
+		sort.Slice(ng.Nodes, func(i, j int) bool { return ng.Nodes[i].PerformanceIndex > ng.Nodes[j].PerformanceIndex })
+	case "slowest":
+		// sort by lowest to highest performance
+		sort.Slice(ng.Nodes, func(i, j int) bool { return ng.Nodes[i].PerformanceIndex < ng.Nodes[j].PerformanceIndex })
+	case "memory":
+		// sort by highest to lowest memory
+		sort.Slice(ng.Nodes, func(i, j int) bool { return ng.Nodes[i].Memory > ng.Nodes[j].Memory })
+	case "random":
+		// shuffle node order
+		rand.Shuffle(len(ng.Nodes), func(i, j int) { ng.Nodes[i], ng.Nodes[j] = ng.Nodes[j], ng.Nodes[i] })
+	default:
+		// do nothing
+	}
+	return ng, nil
+}
+
+// Get the beginning of a bash script that logs into node n and sources the files its GPU needs, along with the OpenMM
+// home directory to launch Tinker from on that node. The here document it opens must be closed with "END"
+func getNodeScriptHeader(genPrm *GeneralParameters, n *Node) (string, string, error) {
+	// Start with header
+	header := "#!/bin/bash\n"
+	// Begin here document (all following command will be performed inside node)
+	header += "ssh -o \"StrictHostKeyChecking no\" " + n.Name + " << END\n"
+	// Source universally needed files
+	header += "\tsource " + genPrm.IntelSource + "\n"
+	// Source gpu dependant files
+	var openMMHome string
+	// Source CUDA files and get openMMHome variable
+	if n.CardGeneration == "Pascal" || n.CardGeneration == "Maxwell" {
+		header += "\tsource " + genPrm.Cuda8Source + "\n"
+		openMMHome = genPrm.Cuda8Home
+	} else if n.CardGeneration == "Turing" {
+		header += "\tsource " + genPrm.Cuda10Source + "\n"
+		openMMHome = genPrm.Cuda10Home
+	} else {
+		return "", "", errors.New("card generation unrecognized - unsure which files to source. Recognized generations are " +
+			"\"Maxwell\", \"Pascal\", \"Turing\". Check entry of node \"" + n.Name + "\" in node INI file")
+	}
+	// Get card number
+	header += "\texport CUDA_VISIBLE_DEVICES=" + n.CardNumber + "\n"
+
+	return header, openMMHome, nil
+}
+
+// Node is a single GPU in the cluster, as described by one line of the node INI file
+type Node struct {
+	Name             string
+	CardNumber       string
+	CardManufacturer string
+	CardGeneration   string
+	CardModel        string
+	Memory           int
+	PerformanceIndex int
+
+	IsFree bool
+	// whether IsFree has been set by a status check yet
+	statusKnown bool
+}
@@ -0,0 +1,284 @@
+package fep
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Notify: contains the notifier that tells people by webhook, email or a local command when stages end, jobs fail and
+// results are written
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Notification is a single message sent by a Notifier
+type Notification struct {
+	Subject         string `json:"subject"`
+	Text            string `json:"text"`
+	TargetDirectory string `json:"target_directory"`
+	// Event is the event that caused the notification, if any
+	Event *Event `json:"event,omitempty"`
+}
+
+// Notifier sends notifications about the events of one run in every way its parameters set
+type Notifier struct {
+	prm             NotifyParameters
+	targetDirectory string
+	client          *http.Client
+	// rootCAs verify the certificate of the SMTP server when starting TLS. If nil, those of the system are used
+	rootCAs *x509.CertPool
+
+	mu     sync.Mutex
+	starts map[string]time.Time
+}
+
+// NewNotifier creates a notifier for the run in targetDirectory. Subscribe its Handle method to the run's emitter
+func NewNotifier(prm *NotifyParameters, targetDirectory string) *Notifier {
+	return &Notifier{prm: *prm, targetDirectory: targetDirectory, client: &http.Client{Timeout: notifyTimeout},
+		starts: make(map[string]time.Time)}
+}
+
+// Enabled reports whether the notifier has anywhere to send notifications
+func (nt *Notifier) Enabled() bool {
+	return nt.prm.Webhook != "" || len(nt.prm.Email) > 0 || nt.prm.Command != ""
+}
+
+// Handle sends a notification if ev is one the notifier was set to report. Sending happens before Handle returns, so
+// a notification about a failure is not lost if the run exits straight after. Failures to send are printed
+func (nt *Notifier) Handle(ev Event) {
+	n, ok := nt.notification(ev)
+	if !ok {
+		return
+	}
+	err := nt.Send(n)
+	if err != nil {
+		fmt.Println("Failed to send notification \"" + n.Subject + "\": " + err.Error())
+	}
+}
+
+// Send sends n in every way the notifier has set, returning the errors of those that failed
+func (nt *Notifier) Send(n Notification) error {
+	if n.TargetDirectory == "" {
+		n.TargetDirectory = nt.targetDirectory
+	}
+	var errs []string
+	if nt.prm.Webhook != "" {
+		err := nt.sendWebhook(n)
+		if err != nil {
+			errs = append(errs, "webhook: "+err.Error())
+		}
+	}
+	if len(nt.prm.Email) > 0 {
+		err := nt.sendEmail(n)
+		if err != nil {
+			errs = append(errs, "email: "+err.Error())
+		}
+	}
+	if nt.prm.Command != "" {
+		err := nt.runCommand(n)
+		if err != nil {
+			errs = append(errs, "command: "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Build the notification for ev, returning false if it is not to be sent
+func (nt *Notifier) notification(ev Event) (Notification, bool) {
+	n := Notification{TargetDirectory: nt.targetDirectory, Event: &ev}
+	switch ev.Type {
+	case StageStarted:
+		// Remember start so the duration can be reported
+		nt.mu.Lock()
+		nt.starts[ev.Stage] = ev.Time
+		nt.mu.Unlock()
+		return n, false
+	case StageFinished:
+		if ev.Error != "" {
+			if !nt.notifies("failures") && !nt.notifies("stages") {
+				return n, false
+			}
+			n.Subject = "goFEP: " + ev.Stage + " failed"
+			n.Text = "Stage " + ev.Stage + " of the run in " + nt.targetDirectory + " failed: " + ev.Error
+			return n, true
+		}
+		if !nt.notifies("stages") {
+			return n, false
+		}
+		n.Subject = "goFEP: " + ev.Stage + " finished"
+		n.Text = "Stage " + ev.Stage + " of the run in " + nt.targetDirectory + " finished"
+		nt.mu.Lock()
+		start, ok := nt.starts[ev.Stage]
+		nt.mu.Unlock()
+		if ok {
+			n.Text += " after " + ev.Time.Sub(start).Round(time.Second).String()
+		}
+		return n, true
+	case JobFailed:
+		if !nt.notifies("failures") {
+			return n, false
+		}
+		n.Subject = "goFEP: job " + ev.Job + " failed"
+		n.Text = "Job " + ev.Job + " of the run in " + nt.targetDirectory
+		if ev.Node != "" {
+			n.Text += " failed on " + ev.Node + ": " + ev.Error
+		} else {
+			n.Text += " failed: " + ev.Error
+		}
+		return n, true
+	case ResultsWritten:
+		if !nt.notifies("results") || ev.Results == nil {
+			return n, false
+		}
+		n.Subject = "goFEP: results written"
+		n.Text = "Results of the run in " + nt.targetDirectory + " were written to " + ev.Dir + "\n" +
+			"Forward total:  " + formatEstimate(ev.Results.Forward) + " kcal/mol\n" +
+			"Backward total: " + formatEstimate(ev.Results.Backward) + " kcal/mol"
+		return n, true
+	}
+	return n, false
+}
+
+// Check whether the notifier was set to report what
+func (nt *Notifier) notifies(what string) bool {
+	for _, on := range nt.prm.On {
+		if on == what {
+			return true
+		}
+	}
+	return false
+}
+
+// Format a free energy with its error
+func formatEstimate(e Estimate) string {
+	return strconv.FormatFloat(e.Energy, 'f', 4, 64) + " +/- " + strconv.FormatFloat(e.Error, 'f', 4, 64)
+}
+
+// Post n to the webhook as JSON
+func (nt *Notifier) sendWebhook(n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := nt.client.Post(nt.prm.Webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(nt.prm.Webhook + " replied " + resp.Status)
+	}
+	return nil
+}
+
+// Mail n to every address through the SMTP server, using STARTTLS when the server offers it
+func (nt *Notifier) sendEmail(n Notification) error {
+	host, _, err := net.SplitHostPort(nt.prm.SMTPServer)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", nt.prm.SMTPServer, notifyTimeout)
+	if err != nil {
+		return err
+	}
+	err = conn.SetDeadline(time.Now().Add(notifyTimeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	// Encrypt and log in if possible
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host, RootCAs: nt.rootCAs})
+		if err != nil {
+			return err
+		}
+	}
+	if nt.prm.SMTPUser != "" {
+		err = c.Auth(smtp.PlainAuth("", nt.prm.SMTPUser, nt.prm.SMTPPassword, host))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Send message
+	err = c.Mail(nt.prm.SMTPFrom)
+	if err != nil {
+		return err
+	}
+	for _, to := range nt.prm.Email {
+		err = c.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	msg := "From: " + nt.prm.SMTPFrom + "\r\n" +
+		"To: " + strings.Join(nt.prm.Email, ", ") + "\r\n" +
+		"Subject: " + n.Subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		strings.Replace(n.Text, "\n", "\r\n", -1) + "\r\n"
+	_, err = w.Write([]byte(msg))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Run the command with the notification described in environment variables and given as JSON on standard input
+func (nt *Notifier) runCommand(n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", nt.prm.Command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), "GOFEP_SUBJECT="+n.Subject, "GOFEP_TEXT="+n.Text,
+		"GOFEP_TARGET_DIRECTORY="+n.TargetDirectory)
+	if n.Event != nil {
+		ev := n.Event
+		cmd.Env = append(cmd.Env, "GOFEP_EVENT="+string(ev.Type), "GOFEP_STAGE="+ev.Stage, "GOFEP_JOB="+ev.Job,
+			"GOFEP_NODE="+ev.Node, "GOFEP_ERROR="+ev.Error)
+		if ev.Results != nil {
+			cmd.Env = append(cmd.Env, resultsHookEnv(ev.Dir, ev.Results)...)
+		}
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package fep
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifierWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		bodies = append(bodies, data)
+		contentType = r.Header.Get("Content-Type")
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	// Only failures are sent
+	nt := NewNotifier(&NotifyParameters{Webhook: srv.URL, On: []string{"failures"}}, "/runs/0001")
+	nt.Handle(Event{Type: StageStarted, Stage: "dynamic"})
+	nt.Handle(Event{Type: StageFinished, Stage: "dynamic"})
+	nt.Handle(Event{Type: JobFailed, Job: "vdw1.0ele1.0 prod 1", Node: "node1", Error: "exit status 1"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("webhook got %d notifications, want 1", len(bodies))
+	}
+	if contentType != "application/json" {
+		t.Errorf("got content type %q, want application/json", contentType)
+	}
+	var n Notification
+	err := json.Unmarshal(bodies[0], &n)
+	if err != nil {
+		t.Fatalf("webhook got unreadable notification %s: %v", bodies[0], err)
+	}
+	if n.Subject != "goFEP: job vdw1.0ele1.0 prod 1 failed" || n.TargetDirectory != "/runs/0001" {
+		t.Errorf("got notification %q about %q", n.Subject, n.TargetDirectory)
+	}
+	if want := "Job vdw1.0ele1.0 prod 1 of the run in /runs/0001 failed on node1: exit status 1"; n.Text != want {
+		t.Errorf("got text %q, want %q", n.Text, want)
+	}
+	if n.Event == nil || n.Event.Type != JobFailed || n.Event.Node != "node1" {
+		t.Errorf("got event %+v, want the failed job", n.Event)
+	}
+}
+
+func TestNotifierWebhookError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	nt := NewNotifier(&NotifyParameters{Webhook: srv.URL}, "/runs/0001")
+	err := nt.Send(Notification{Subject: "goFEP: results written"})
+	if err == nil || !strings.HasPrefix(err.Error(), "webhook: ") || !strings.Contains(err.Error(), "500") {
+		t.Errorf("got error %v, want the webhook's reply", err)
+	}
+}
+
+func TestNotifierEmail(t *testing.T) {
+	cert, rootCAs := testCertificate(t)
+	tests := []struct {
+		name     string
+		startTLS bool
+		rootCAs  *x509.CertPool
+		// whether the certificate of the server fails to verify, so nothing is sent
+		untrusted bool
+	}{
+		{name: "plain"},
+		{name: "STARTTLS", startTLS: true, rootCAs: rootCAs},
+		{name: "STARTTLS untrusted", startTLS: true, untrusted: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			smtpServer := startFakeSMTPServer(t, test.startTLS, cert)
+			prm := NotifyParameters{Email: []string{"alice@example.com", "bob@example.com"},
+				SMTPServer: smtpServer.listener.Addr().String(), SMTPFrom: "gofep@example.com", SMTPUser: "gofep",
+				SMTPPassword: "secret"}
+			nt := NewNotifier(&prm, "/runs/0001")
+			nt.rootCAs = test.rootCAs
+			err := nt.Send(Notification{Subject: "goFEP: results written", Text: "Forward total\nBackward total"})
+			smtpServer.wait(t)
+
+			if test.untrusted {
+				if err == nil || !strings.HasPrefix(err.Error(), "email: ") {
+					t.Errorf("got error %v, want failure to verify the server", err)
+				}
+				if smtpServer.data != "" {
+					t.Errorf("message was sent to an unverified server")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if smtpServer.encrypted != test.startTLS {
+				t.Errorf("message sent encrypted: %v, want %v", smtpServer.encrypted, test.startTLS)
+			}
+			if smtpServer.auth != "\x00gofep\x00secret" {
+				t.Errorf("got credentials %q", smtpServer.auth)
+			}
+			if smtpServer.from != "<gofep@example.com>" {
+				t.Errorf("got sender %q", smtpServer.from)
+			}
+			if want := []string{"<alice@example.com>", "<bob@example.com>"}; !reflect.DeepEqual(smtpServer.to, want) {
+				t.Errorf("got recipients %q, want %q", smtpServer.to, want)
+			}
+			for _, want := range []string{"From: gofep@example.com\n", "To: alice@example.com, bob@example.com\n",
+				"Subject: goFEP: results written\n", "\n\nForward total\nBackward total"} {
+				if !strings.Contains(smtpServer.data, want) {
+					t.Errorf("message lacks %q:\n%s", want, smtpServer.data)
+				}
+			}
+		})
+	}
+}
+
+// A fake SMTP server accepting one session and recording the message sent in it
+type fakeSMTPServer struct {
+	listener net.Listener
+	// Whether STARTTLS is offered, with cert
+	startTLS bool
+	cert     tls.Certificate
+	done     chan struct{}
+
+	// What the session sent, and whether it was encrypted when sending it. Read only after wait
+	auth      string
+	from      string
+	to        []string
+	data      string
+	encrypted bool
+}
+
+// Start a fake SMTP server on a free local port
+func startFakeSMTPServer(t *testing.T, startTLS bool, cert tls.Certificate) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: listener, startTLS: startTLS, cert: cert, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+// Wait for the session to end and stop the server
+func (s *fakeSMTPServer) wait(t *testing.T) {
+	select {
+	case <-s.done:
+	case <-time.After(10 * time.Second):
+		t.Error("SMTP session did not end")
+	}
+	s.listener.Close()
+}
+
+// Answer the commands of one session, as much of RFC 5321 as net/smtp uses
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost fake SMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			text.PrintfLine("500 empty command")
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "EHLO":
+			text.PrintfLine("250-localhost")
+			if s.startTLS && !s.encrypted {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{s.cert}})
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			s.encrypted = true
+		case "AUTH":
+			var auth []byte
+			if len(fields) == 3 && fields[1] == "PLAIN" {
+				auth, err = base64.StdEncoding.DecodeString(fields[2])
+			}
+			if auth == nil || err != nil {
+				text.PrintfLine("501 unreadable credentials")
+				continue
+			}
+			s.auth = string(auth)
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.from = strings.TrimPrefix(line, "MAIL FROM:")
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			s.to = append(s.to, strings.TrimPrefix(line, "RCPT TO:"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 send message")
+			lines, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.data = strings.Join(lines, "\n")
+			text.PrintfLine("250 sent")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// Create a self-signed certificate for 127.0.0.1, and a pool of roots trusting it
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "goFEP test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, rootCAs
+}
@@ -0,0 +1,174 @@
+package fep
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Override: contains functions to give single windows of the setup block other input files or extra key lines than
+// the rest
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// WindowOverride changes the inputs of one window of the setup block
+type WindowOverride struct {
+	// Window is the name of the window or its index along the lambda path, from 0
+	Window string
+	// KeyLines are set in the key file of the window, each replacing the lines with the same keyword or added at the end.
+	// Lines of keywords that can be repeated are always added
+	KeyLines [][]string
+	// XYZ and Prm, if not "", replace the xyz and prm files of the general block for the window
+	XYZ string
+	Prm string
+}
+
+// Keys of the setup block that override inputs of a window, each followed by the window
+var overrideKeys = []string{"windowKey", "windowXYZ", "windowPrm"}
+
+// Keywords windowKey can't set, as setup sets them for every window
+var setupKeywords = []string{"parameters", "vdw-lambda", "ele-lambda"}
+
+// Keywords Tinker reads from every line that sets them, each line adding atoms, restraints or parameters to those of the
+// others, so windowKey adds a line for them rather than replacing those of the key file
+var repeatableKeywords = []string{"active", "inactive", "ligand", "group", "mutate", "restrain-position",
+	"restrain-distance", "restrain-angle", "restrain-torsion", "restrain-groups", "atom", "biotype", "vdw", "vdwpr",
+	"bond", "angle", "strbnd", "ureybrad", "opbend", "torsion", "pitors", "polarize"}
+
+// Check whether keyword can be repeated in a key file, ignoring case as Tinker does
+func isRepeatableKeyword(keyword string) bool {
+	for _, repeatable := range repeatableKeywords {
+		if strings.EqualFold(keyword, repeatable) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the overrides of the setup block, given on lines such as "windowKey vdw0.4ele0.0 vdw-annihilate", one for each
+// window in the order they are first given. Malformed lines are reported and skipped
+func generateWindowOverrides(b block, r *iniReport) []WindowOverride {
+	var overrides []WindowOverride
+	index := make(map[string]int)
+	for _, key := range overrideKeys {
+		values, lineNums := b.getRepeatedParams(key)
+	lines:
+		for n, value := range values {
+			if len(value) < 2 || (key != "windowKey" && len(value) != 2) {
+				usage := "<window> <path>"
+				if key == "windowKey" {
+					usage = "<window> <keyword> [values]"
+				}
+				r.error(lineNums[n], "\""+key+" "+strings.Join(value, " ")+"\" in setup block of INI file must be of the form \""+
+					key+" "+usage+"\"")
+				continue
+			}
+			if key == "windowKey" {
+				for _, keyword := range setupKeywords {
+					if strings.EqualFold(value[1], keyword) {
+						r.error(lineNums[n], "\""+key+" "+strings.Join(value, " ")+"\" in setup block of INI file sets "+keyword+
+							", which setup sets for every window. Use the lambdas of the setup block or windowPrm instead")
+						continue lines
+					}
+				}
+			}
+			i, ok := index[value[0]]
+			if !ok {
+				i = len(overrides)
+				index[value[0]] = i
+				overrides = append(overrides, WindowOverride{Window: value[0]})
+			}
+			o := &overrides[i]
+			switch key {
+			case "windowKey":
+				o.KeyLines = append(o.KeyLines, value[1:])
+			case "windowXYZ", "windowPrm":
+				path := &o.XYZ
+				if key == "windowPrm" {
+					path = &o.Prm
+				}
+				if *path != "" {
+					r.error(lineNums[n], "\""+key+"\" is given twice for window "+value[0]+" in setup block of INI file")
+					continue
+				}
+				*path = value[1]
+			}
+		}
+	}
+	return overrides
+}
+
+// Get the override of each of dynamicFolders, with its window set to the folder and its paths made absolute. Windows
+// without an override get an empty one, and overrides of the same window by name and by index are combined. Every
+// override must name a window of dynamicFolders
+func getWindowOverrides(prm *SetupParameters, dynamicFolders []string) ([]WindowOverride, error) {
+	overrides := make([]WindowOverride, len(dynamicFolders))
+	for i := range overrides {
+		overrides[i].Window = dynamicFolders[i]
+	}
+	for _, o := range prm.Overrides {
+		i := findPathWindow(dynamicFolders, o.Window)
+		if i < 0 {
+			return nil, errors.New("window \"" + o.Window + "\" overridden in setup block of INI file is not a window of the setup block. " +
+				"Windows are given by name or by index along the lambda path from 0")
+		}
+		for _, paths := range [][2]*string{{&o.XYZ, &overrides[i].XYZ}, {&o.Prm, &overrides[i].Prm}} {
+			if *paths[0] == "" {
+				continue
+			}
+			if *paths[1] != "" {
+				return nil, errors.New("window " + dynamicFolders[i] + " is given two xyz or prm files in setup block of INI file")
+			}
+			path, err := filepath.Abs(*paths[0])
+			if err != nil {
+				return nil, fmt.Errorf("could not compute absolute path to file \"%s\" overriding window %s: %w", *paths[0], dynamicFolders[i], err)
+			}
+			if _, err = os.Stat(path); err != nil {
+				return nil, fmt.Errorf("failed to find file overriding window %s: %w", dynamicFolders[i], err)
+			}
+			*paths[1] = path
+		}
+		overrides[i].KeyLines = append(overrides[i].KeyLines, o.KeyLines...)
+	}
+	return overrides, nil
+}
+
+// Copy the prm file overriding each window that has one to a folder named after the window in the parameters folder,
+// returning the path of the prm file each window uses, absPrmPath if it has no override
+func copyWindowPrmFiles(targetDirectory string, absPrmPath string, overrides []WindowOverride) ([]string, error) {
+	prmPaths := make([]string, len(overrides))
+	for i, o := range overrides {
+		prmPaths[i] = absPrmPath
+		if o.Prm == "" {
+			continue
+		}
+		folderPath := filepath.Join(targetDirectory, "parameters", o.Window)
+		err := os.MkdirAll(folderPath, octalPermissions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create directory to store parameters file of window %s: %w", o.Window, err)
+		}
+		prmPaths[i] = filepath.Join(folderPath, filepath.Base(o.Prm))
+		err = copyFile(prmPaths[i], o.Prm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return prmPaths, nil
+}
+
+// Describe what an override changes, e.g. "xyz, 2 key line(s)", or "" if it changes nothing
+func (o WindowOverride) String() string {
+	var changes []string
+	if o.XYZ != "" {
+		changes = append(changes, "xyz")
+	}
+	if o.Prm != "" {
+		changes = append(changes, "prm")
+	}
+	if len(o.KeyLines) > 0 {
+		changes = append(changes, fmt.Sprint(len(o.KeyLines))+" key line(s)")
+	}
+	return strings.Join(changes, ", ")
+}
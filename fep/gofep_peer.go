@@ -0,0 +1,106 @@
+package fep
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Peer: contains functions to find the user running the process on the other end of a TCP connection made from the
+// same machine, so a server can check who submits a run rather than take their word for it
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Tables of TCP sockets of the machine, as given by Linux
+var procNetTCPPaths = []string{"/proc/net/tcp", "/proc/net/tcp6"}
+
+// Get the name of the user that owns the socket the request r was sent from. The socket is found among those of the
+// machine by its address and that of the server, so this only works for requests sent from the machine the server
+// runs on
+func getRequestUser(r *http.Request) (string, error) {
+	localAddr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return "", errors.New("could not find the address the request was sent to")
+	}
+	server, err := net.ResolveTCPAddr("tcp", localAddr.String())
+	if err != nil {
+		return "", err
+	}
+	client, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+
+	// The socket of the client has the client's address as its local address and the server's as its remote one
+	for _, path := range procNetTCPPaths {
+		uid, err := findSocketUID(path, client, server)
+		if err != nil {
+			return "", err
+		}
+		if uid == "" {
+			continue
+		}
+		u, err := user.LookupId(uid)
+		if err != nil {
+			return "", err
+		}
+		return u.Username, nil
+	}
+	return "", errors.New("request was not sent from the machine the server runs on")
+}
+
+// Find the socket with local address local and remote address remote in the table of TCP sockets at path, returning
+// the uid of its owner, or "" if there is no such socket
+func findSocketUID(path string, local *net.TCPAddr, remote *net.TCPAddr) (string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Lines after the header are: slot, local address, remote address, state, queues, timer, retransmits, uid, ...
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		if sameTCPAddr(fields[1], local) && sameTCPAddr(fields[2], remote) {
+			return fields[7], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// Check whether an address of a table of TCP sockets, written as hexadecimal ip:port with the ip in 32 bit words of
+// host byte order (little endian), is addr
+func sameTCPAddr(field string, addr *net.TCPAddr) bool {
+	tokens := strings.Split(field, ":")
+	if len(tokens) != 2 {
+		return false
+	}
+	port, err := strconv.ParseUint(tokens[1], 16, 16)
+	if err != nil || int(port) != addr.Port {
+		return false
+	}
+	raw, err := hex.DecodeString(tokens[0])
+	if err != nil || len(raw)%4 != 0 {
+		return false
+	}
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		for i := 0; i < 4; i++ {
+			ip[word+i] = raw[word+3-i]
+		}
+	}
+	return ip.Equal(addr.IP)
+}
@@ -0,0 +1,205 @@
+package fep
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Pipeline: contains the manager that runs dynamic and BAR together, starting BAR on each pair as soon as both its
+// windows have finished dynamic
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// PipelineManager runs dynamic on every window and BAR on every pair as one pipeline: BAR1 of a pair starts as soon as
+// the last repetition of both its windows has finished, on the node that finished it, and BAR2 straight after, so free
+// energies come in while other windows are still running. BAR folders must already be set up with BARSetup. Windows
+// and pairs that are up to date are skipped as with DynamicManager and BARManager, and hooks run as they do there,
+// except that preBAR1 and preBAR2 run just before the first pair starts. It returns a record of every job run; failed
+// jobs also leave an .err file in their directory
+func (ng *NodeGroup) PipelineManager(genPrm *GeneralParameters, setupPrm *SetupParameters, dynPrm []DynamicParameters, barPrm *BARParameters,
+	maxNodes int) ([]Job, error) {
+	start := time.Now()
+
+	// Find out which windows and pairs are up to date, and record steps as they finish
+	windows, err := getLambdaPath(genPrm.TargetDirectory, setupPrm)
+	if err != nil {
+		return nil, err
+	}
+	build, err := loadBuildState(genPrm.TargetDirectory)
+	if err != nil {
+		return nil, err
+	}
+	err = ng.checkDynamic(genPrm, windows, dynPrm, build)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		ng.build = nil
+		ng.onWindowDone = nil
+	}()
+	fmt.Println("\nChecking bar subdirectories against the build state...")
+	subDirs, err := getBARSubDirs(genPrm.TargetDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate subdirectories for bar: %w", err)
+	}
+	pairs, barJobs, err := ng.queueBAR(subDirs, barPrm, build)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		ng.queuePair(pair)
+	}
+
+	ng.Events.emitStage(StageStarted, DynamicStage, nil)
+	ng.Events.emitStage(StageStarted, BAR1Stage, nil)
+	ng.Events.emitStage(StageStarted, BAR2Stage, nil)
+	p := &pipeline{ng: ng, genPrm: genPrm, barPrm: barPrm, hookEnv: pairsHookEnv(subDirs), pending: pairs}
+
+	// Start pairs whose windows are already complete on free nodes, then the others as their windows complete
+	err = p.startReady(maxNodes)
+	var dynJobs []Job
+	if err == nil {
+		ng.onWindowDone = p.windowDone
+		dynJobs, err = ng.runDynamic(genPrm, windows, dynPrm, maxNodes)
+		ng.onWindowDone = nil
+	}
+	ng.Events.emitStage(StageFinished, DynamicStage, err)
+
+	// Pairs still waiting will never have both windows complete
+	p.mu.Lock()
+	for _, pair := range p.pending {
+		p.skipPair(pair, errors.New("not run as dynamic did not finish on both windows of the pair"))
+	}
+	p.pending = nil
+	p.mu.Unlock()
+	p.wg.Wait()
+
+	// Run hooks after the last pair
+	barErr := p.hookErr
+	if barErr == nil && p.started {
+		barErr = runHook(genPrm, "postBAR1", ng.hooks().PostBAR1, p.hookEnv...)
+	}
+	ng.Events.emitStage(StageFinished, BAR1Stage, barErr)
+	if barErr == nil && p.started {
+		barErr = runHook(genPrm, "postBAR2", ng.hooks().PostBAR2, p.hookEnv...)
+	}
+	ng.Events.emitStage(StageFinished, BAR2Stage, barErr)
+
+	jobs := append(dynJobs, barJobs...)
+	if err == nil {
+		err = barErr
+	}
+	if err != nil {
+		return jobs, err
+	}
+	fmt.Println("\nDynamic and BAR pipeline finished in " + time.Since(start).String())
+	return jobs, nil
+}
+
+// State of BAR in a pipeline
+type pipeline struct {
+	ng      *NodeGroup
+	genPrm  *GeneralParameters
+	barPrm  *BARParameters
+	hookEnv []string
+	wg      sync.WaitGroup
+
+	mu sync.Mutex
+	// pairs waiting for their windows
+	pending []barPair
+	// started is set once the first pair has started, and hookErr if the hooks before it failed
+	started bool
+	hookErr error
+}
+
+// Start the pairs whose windows are already complete on the first maxNodes free nodes
+func (p *pipeline) startReady(maxNodes int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ready := p.takeReady()
+	if len(ready) == 0 {
+		return nil
+	}
+	fmt.Println("\nStarting BAR on " + fmt.Sprint(len(ready)) + " pair(s) whose windows are already complete...")
+	maxNodes, err := p.ng.findFreeNodes(p.genPrm, maxNodes)
+	if err != nil {
+		return err
+	}
+	for i, pair := range ready {
+		var n *Node
+		if p.ng.Scheduler == nil {
+			n = &p.ng.Nodes[p.ng.FreeNodeIndices[i%maxNodes]]
+		}
+		p.start(pair, n)
+	}
+	return nil
+}
+
+// Start the pairs of window, which just finished dynamic on node n, whose other window is also complete. Called by the
+// dynamic job that finished the window
+func (p *pipeline) windowDone(window string, n *Node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pair := range p.takeReady() {
+		fmt.Println("Window " + window + " finished: starting BAR on " + pair.subDir)
+		p.start(pair, n)
+	}
+}
+
+// Take the pairs whose windows are both complete off the pending list. Caller must hold p.mu
+func (p *pipeline) takeReady() []barPair {
+	var ready []barPair
+	var waiting []barPair
+	for _, pair := range p.pending {
+		windows := strings.Split(filepath.Base(pair.subDir), "_")
+		if p.ng.build.windowComplete(windows[0]) && p.ng.build.windowComplete(windows[len(windows)-1]) {
+			ready = append(ready, pair)
+		} else {
+			waiting = append(waiting, pair)
+		}
+	}
+	p.pending = waiting
+	return ready
+}
+
+// Run BAR on pair on a copy of node n or, when a scheduler grants nodes, on the node it grants. The hooks before BAR
+// run before the first pair. Caller must hold p.mu
+func (p *pipeline) start(pair barPair, n *Node) {
+	ng := p.ng
+	if !p.started {
+		p.started = true
+		p.hookErr = runHook(p.genPrm, "preBAR1", ng.hooks().PreBAR1, p.hookEnv...)
+		if p.hookErr == nil {
+			p.hookErr = runHook(p.genPrm, "preBAR2", ng.hooks().PreBAR2, p.hookEnv...)
+		}
+	}
+	if p.hookErr != nil {
+		p.skipPair(pair, p.hookErr)
+		return
+	}
+
+	p.wg.Add(1)
+	run := func(n *Node, wg *sync.WaitGroup) {
+		ng.runBARPair(n, pair, p.genPrm, p.barPrm, wg)
+	}
+	if ng.Scheduler != nil {
+		ng.launch(pair.first(), -1, &p.wg, run)
+		return
+	}
+	// The node is copied as node status may be updated while the pair runs
+	node := *n
+	pair.first().Node = node.Name
+	go run(&node, &p.wg)
+}
+
+// Record the jobs of pair as failed with err without running them
+func (p *pipeline) skipPair(pair barPair, err error) {
+	if pair.bar1 != nil {
+		p.ng.skipJob(pair.bar1, err)
+	}
+	p.ng.skipJob(pair.bar2, err)
+}
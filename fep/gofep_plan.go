@@ -0,0 +1,307 @@
+package fep
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jgourary/goFEP/xyz"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Plan: contains functions to print what a call to dynamic, bar or auto would do without running anything
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// PrintPlan prints the windows, blocks, node assignments, scripts and resource estimates for a task ("dynamic", "bar"
+// or "auto") without creating folders or launching any jobs. Node status is queried so assignments are realistic, and
+// the build state is checked as a real run would check it, without changing it, so only steps that would run are shown
+func PrintPlan(task string, settings *Settings, ng *NodeGroup, maxNodes int) error {
+
+	genPrm := &settings.General
+	dynPrm := settings.Dynamic
+	barPrm := &settings.BAR
+
+	fmt.Println("\nDry run of \"" + task + "\" in directory: " + genPrm.TargetDirectory)
+	fmt.Println("Nothing will be created or launched. Scripts are shown exactly as they would be written.")
+
+	dynDirectory := filepath.Join(genPrm.TargetDirectory, "dynamic")
+	xyzName := filepath.Base(genPrm.XYZPath)
+	keyName := filepath.Base(genPrm.KeyPath)
+	arcName := strings.TrimSuffix(xyzName, filepath.Ext(xyzName)) + ".arc"
+
+	// Get windows along the lambda path as a real run would: auto runs setup first, so its windows are those of the
+	// setup block whether they exist yet or not; dynamic and bar take those of the setup block if it sets lambdas, or
+	// else those with a manifest
+	var windows []string
+	var err error
+	if task == "auto" {
+		windows, err = GetDynamicFolderNames(&settings.Setup)
+	} else {
+		windows, err = getLambdaPath(genPrm.TargetDirectory, LambdaPathSetup(settings))
+	}
+	if err != nil {
+		return err
+	}
+	var existing []string
+	for _, window := range windows {
+		if _, err := os.Stat(filepath.Join(dynDirectory, window)); err == nil {
+			existing = append(existing, window)
+		}
+	}
+	if len(windows) == 0 {
+		return errors.New("no windows to run on - run setup first or check the setup block of the INI file")
+	}
+
+	// Check the build state as a real run would, without saving it or removing output, to find the steps that would run.
+	// Windows setup has yet to create are not checked, as they run in full
+	printPlanHeader("Build state")
+	build, err := loadBuildState(genPrm.TargetDirectory)
+	if err != nil {
+		return err
+	}
+	build.readOnly = true
+	if (task == "dynamic" || task == "auto") && len(existing) > 0 {
+		err = build.checkDynamic(dynDirectory, existing, dynPrm)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Report windows, with the inputs setup gives them if they differ from the rest
+	overridden := make(map[string]string)
+	if task == "auto" {
+		setupWindows, _ := GetDynamicFolderNames(&settings.Setup)
+		overrides, err := getWindowOverrides(&settings.Setup, setupWindows)
+		if err != nil {
+			return err
+		}
+		for i, o := range overrides {
+			if o.String() != "" {
+				overridden[o.Window] = "overrides " + o.String()
+			}
+			if isSeeded(&settings.Setup, overrides, i) {
+				if overridden[o.Window] != "" {
+					overridden[o.Window] += ", "
+				}
+				overridden[o.Window] += "seeded from " + setupWindows[i-1] + " after " + settings.Setup.SeedBlock
+			}
+		}
+	}
+	printPlanHeader("Windows")
+	for _, window := range windows {
+		state := "exists"
+		if !contains(existing, window) {
+			state = "created by setup"
+		} else if build.resets[window] {
+			state = "exists, out of date: output would be removed"
+		}
+		if overridden[window] != "" {
+			state += ", " + overridden[window]
+		}
+		fmt.Println("  " + window + "\t(" + state + ")")
+	}
+	if task == "auto" && settings.Setup.Generated {
+		printSchedule(os.Stdout, &settings.Setup)
+	}
+
+	// Resolve nodes. Status is only queried once, whereas a real run queries it again before dynamic and before BAR
+	printPlanHeader("Nodes")
+	err = ng.UpdateStatus(genPrm.TargetDirectory)
+	if err != nil {
+		return err
+	}
+	assignable := getAssignableNodes(ng, maxNodes)
+	fmt.Println("  " + strconv.Itoa(len(ng.FreeNodeIndices)) + " of " + strconv.Itoa(len(ng.Nodes)) + " nodes currently free, " +
+		strconv.Itoa(maxNodes) + " requested")
+	if len(ng.FreeNodeIndices) < maxNodes {
+		fmt.Println("  WARNING: fewer free nodes than requested - jobs below are spread over the " + strconv.Itoa(len(assignable)) + " free node(s)")
+	}
+	if len(assignable) == 0 {
+		return errors.New("did not find enough free nodes to run on")
+	}
+	for _, n := range assignable {
+		fmt.Println("  " + n.Name + "\tcard " + n.CardNumber + "\t" + n.CardGeneration + " " + n.CardModel)
+	}
+
+	// Count size of one frame so disk usage of arc files can be estimated
+	frameBytes := int64(0)
+	xyzInfo, err := os.Stat(genPrm.XYZPath)
+	if err == nil {
+		frameBytes = xyzInfo.Size()
+	}
+
+	// Frames per window are needed for BAR2, so accumulate them while walking through the dynamic blocks
+	framesPerWindow := map[string]int{}
+	totalJobs := 0
+	totalNs := 0.0
+
+	if task == "dynamic" || task == "auto" {
+		for _, prm := range dynPrm {
+			steps, _ := strconv.Atoi(prm.NumSteps)
+			stepInterval, _ := strconv.ParseFloat(prm.StepInterval, 64)
+			saveInterval, _ := strconv.ParseFloat(prm.SaveInterval, 64)
+			// simulation time of one repetition in ns, steps are in fs and frames are saved every saveInterval ps
+			repNs := float64(steps) * stepInterval / 1e6
+			repFrames := int(float64(steps) * stepInterval / 1000 / saveInterval)
+			for _, window := range windows {
+				framesPerWindow[window] += prm.Repetitions * repFrames
+			}
+
+			printPlanHeader("Dynamic block \"" + prm.Name + "\" (order " + strconv.Itoa(prm.Order) + ")")
+			fmt.Println("  " + strconv.Itoa(prm.Repetitions) + " repetition(s) of " + prm.NumSteps + " steps x " + prm.StepInterval + " fs = " +
+				strconv.FormatFloat(repNs, 'f', -1, 64) + " ns, saving a frame every " + prm.SaveInterval + " ps (~" + strconv.Itoa(repFrames) + " frames)")
+		}
+
+		// Each window runs its repetitions in order on one node, skipping those whose log exists unless the build
+		// state check found the window out of date
+		chained := 0
+		for _, window := range windows {
+			subDir := filepath.Join(dynDirectory, window)
+			var toRun []string
+			var scripts []string
+			for i := range dynPrm {
+				prm := &dynPrm[i]
+				for repNum := 0; repNum < prm.Repetitions; repNum++ {
+					repStr := strconv.Itoa(repNum)
+					logPath := filepath.Join(subDir, prm.Name+"_"+repStr+".log")
+					if _, err := os.Stat(logPath); err == nil && !build.resets[window] {
+						continue
+					}
+					n := assignable[chained%len(assignable)]
+					script, err := getDynamicScript(filepath.Join(subDir, xyzName), filepath.Join(subDir, keyName), logPath, genPrm, prm, &n)
+					if err != nil {
+						return err
+					}
+					toRun = append(toRun, prm.Name+"_"+repStr)
+					scripts = append(scripts, script)
+					steps, _ := strconv.Atoi(prm.NumSteps)
+					stepInterval, _ := strconv.ParseFloat(prm.StepInterval, 64)
+					totalNs += float64(steps) * stepInterval / 1e6
+				}
+			}
+			if len(toRun) == 0 {
+				continue
+			}
+			n := assignable[chained%len(assignable)]
+			chained++
+			printPlanHeader("Window " + window + " on " + n.Name)
+			fmt.Println("  " + strconv.Itoa(len(toRun)) + " repetition(s) to run in turn: " + strings.Join(toRun, ", "))
+			for i := range toRun {
+				printPlanScript(filepath.Join(subDir, toRun[i]+".sh"), n.Name, scripts[i])
+			}
+			totalJobs += len(toRun)
+		}
+	} else {
+		// bar only: count frames from existing arc files
+		for _, window := range windows {
+			framesPerWindow[window], _ = xyz.CountFrames(filepath.Join(dynDirectory, window, arcName))
+		}
+	}
+
+	if task == "bar" || task == "auto" {
+		// Pair windows the same way BAR setup does
+		if len(windows) < 2 {
+			return fmt.Errorf("at least 2 windows are needed to run BAR, found %d", len(windows))
+		}
+		pairs, err := pairWindows(windows, barPrm)
+		if err != nil {
+			return err
+		}
+		printPlanHeader("BAR")
+		fmt.Println("  " + strconv.Itoa(len(pairs)) + " pair(s), " + barPrm.Temp + " K, using every " + barPrm.FrameInterval + " frame(s)")
+		barDirectory := filepath.Join(genPrm.TargetDirectory, "bar")
+		var subBarDirs []string
+		for _, pair := range pairs {
+			subBarDirs = append(subBarDirs, filepath.Join(barDirectory, pair.Name))
+		}
+		bar1Dirs, bar2Dirs, err := build.checkBAR(subBarDirs, barPrm)
+		if err != nil {
+			return err
+		}
+		for i, pair := range pairs {
+			subBarDir := subBarDirs[i]
+			if !contains(bar2Dirs, subBarDir) {
+				fmt.Println("  " + pair.Name + "\t(up to date)")
+				continue
+			}
+			n := assignable[i%len(assignable)]
+			if contains(bar1Dirs, subBarDir) {
+				arc1Path := filepath.Join(dynDirectory, pair.From, arcName)
+				arc2Path := filepath.Join(dynDirectory, pair.To, arcName)
+				bar1Script, err := getBAR1Script(subBarDir, arc1Path, arc2Path, genPrm, barPrm, &n)
+				if err != nil {
+					return err
+				}
+				printPlanScript(filepath.Join(subBarDir, "bar1.sh"), n.Name, bar1Script)
+				totalJobs++
+			}
+			barPath := filepath.Join(subBarDir, strings.TrimSuffix(arcName, "arc")+"bar")
+			frameCount := strconv.Itoa(framesPerWindow[pair.From])
+			bar2Script, err := getBAR2Script(barPath, frameCount, genPrm, barPrm, &n)
+			if err != nil {
+				return err
+			}
+			printPlanScript(filepath.Join(subBarDir, "bar2.sh"), n.Name, bar2Script)
+			totalJobs++
+		}
+	}
+
+	// Summarize resource estimates
+	printPlanHeader("Estimates")
+	totalFrames := 0
+	for _, window := range windows {
+		totalFrames += framesPerWindow[window]
+	}
+	fmt.Println("  Jobs:                " + strconv.Itoa(totalJobs))
+	fmt.Println("  Simulated time:      " + strconv.FormatFloat(totalNs, 'f', 3, 64) + " ns")
+	fmt.Println("  Frames in arc files: ~" + strconv.Itoa(totalFrames) + " (" + strconv.Itoa(len(windows)) + " windows)")
+	fmt.Println("  Disk usage of arcs:  ~" + formatBytes(int64(totalFrames)*frameBytes))
+	fmt.Println("  GPU-hours (dynamic): ~" + strconv.FormatFloat(totalNs/genPrm.NsPerDay*24, 'f', 1, 64) +
+		" at " + strconv.FormatFloat(genPrm.NsPerDay, 'f', -1, 64) + " ns/day (set \"nsPerDay\" in the general block to refine)")
+	fmt.Println()
+	return nil
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Helper functions
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Get the free nodes jobs would be spread over, capped at maxNodes
+func getAssignableNodes(ng *NodeGroup, maxNodes int) []Node {
+	var assignable []Node
+	for i, nodeIndex := range ng.FreeNodeIndices {
+		if i >= maxNodes {
+			break
+		}
+		assignable = append(assignable, ng.Nodes[nodeIndex])
+	}
+	return assignable
+}
+
+// Print section title for plan
+func printPlanHeader(title string) {
+	fmt.Println("\n=== " + title + " ===")
+}
+
+// Print a script the plan would write, along with where it would be written and the node it would run on
+func printPlanScript(scriptPath string, nodeName string, script string) {
+	fmt.Println("\n  --- " + scriptPath + " (on " + nodeName + ") ---")
+	for _, line := range strings.Split(script, "\n") {
+		fmt.Println("  | " + line)
+	}
+}
+
+// Format a number of bytes for humans
+func formatBytes(b int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(b)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return strconv.FormatFloat(size, 'f', 1, 64) + " " + units[i]
+}
@@ -0,0 +1,281 @@
+package fep
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Progress: contains functions to follow running dynamic jobs through their Tinker logs, estimating throughput and
+// time remaining
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// WindowProgress is how far dynamic has got in one window for the repetition it is running
+type WindowProgress struct {
+	Window     string
+	Block      string
+	Repetition int
+	Node       string
+	// Step is the last MD step reported in the log, out of NumSteps
+	Step     int
+	NumSteps int
+	// Fraction of the repetition complete, from 0 to 1
+	Fraction float64
+	// NsPerDay is the throughput measured since the log was first seen, 0 until it can be measured
+	NsPerDay float64
+	// ETA is the time left for this repetition, and WindowETA for every repetition left in the window at the same
+	// pace. Both are 0 until throughput can be measured
+	ETA       time.Duration
+	WindowETA time.Duration
+
+	// MD steps in the repetitions of the window after this one
+	stepsAfter int
+	// step and time at which the window was first seen running, used to measure throughput
+	firstStep int
+	firstSeen time.Time
+}
+
+// Dynamic jobs running now, at most one per window, kept by runChain for the progress monitor
+type runningJobs struct {
+	mu   sync.Mutex
+	jobs map[string]runningJob
+}
+
+// A copy of a running dynamic job, so the monitor never reads fields the job is still writing, with what is needed to
+// follow its log
+type runningJob struct {
+	job          Job
+	logPath      string
+	numSteps     int
+	stepInterval float64
+	stepsAfter   int
+}
+
+// Create an empty set of running jobs
+func newRunningJobs() *runningJobs {
+	return &runningJobs{jobs: make(map[string]runningJob)}
+}
+
+// Record that job, a repetition of dynPrm followed by stepsAfter more MD steps in its window, started on node n
+func (r *runningJobs) start(job *Job, n *Node, dynPrm *DynamicParameters, stepsAfter int) {
+	numSteps, _ := strconv.Atoi(dynPrm.NumSteps)
+	stepInterval, _ := strconv.ParseFloat(dynPrm.StepInterval, 64)
+	rj := runningJob{job: *job, logPath: filepath.Join(job.Dir, dynPrm.Name+"_"+strconv.Itoa(job.Repetition)+".log"),
+		numSteps: numSteps, stepInterval: stepInterval, stepsAfter: stepsAfter}
+	rj.job.Node = n.Name
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[job.Dir] = rj
+}
+
+// Record that the job running in the window in subDir has finished
+func (r *runningJobs) finish(subDir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.jobs, subDir)
+}
+
+// Get the running jobs sorted by window
+func (r *runningJobs) snapshot() []runningJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]runningJob, 0, len(r.jobs))
+	for _, rj := range r.jobs {
+		jobs = append(jobs, rj)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].job.Dir < jobs[j].job.Dir
+	})
+	return jobs
+}
+
+// Follows the logs of the dynamic jobs running in every window, called by runDynamic
+func (ng *NodeGroup) monitorDynamic(genPrm *GeneralParameters, running *runningJobs, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	// Nothing to do if progress is disabled
+	if genPrm.ProgressInterval <= 0 {
+		return
+	}
+
+	// Progress of each window, started again whenever the window moves on to its next repetition
+	progress := make(map[string]*WindowProgress)
+
+	ticker := time.NewTicker(genPrm.ProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			var windows []WindowProgress
+			for _, rj := range running.snapshot() {
+				job := &rj.job
+				if rj.numSteps <= 0 {
+					continue
+				}
+				w := progress[job.Dir]
+				if w == nil || w.Block != job.Block || w.Repetition != job.Repetition {
+					w = &WindowProgress{Window: filepath.Base(job.Dir), Block: job.Block, Repetition: job.Repetition, Node: job.Node,
+						NumSteps: rj.numSteps, stepsAfter: rj.stepsAfter, firstStep: -1}
+					progress[job.Dir] = w
+				}
+				data, err := ng.readLogTail(genPrm, job.Node, rj.logPath)
+				if err == nil {
+					step, ok := parseDynamicLogStep(data)
+					if ok {
+						w.update(step, rj.stepInterval, time.Now())
+						ev := Event{Type: JobProgress, Job: job.Name(), Kind: job.Kind, Dir: job.Dir, Block: job.Block, Repetition: job.Repetition,
+							Ns: job.Ns, Node: job.Node, Progress: w.Fraction, NsPerDay: w.NsPerDay, ETASeconds: w.ETA.Seconds()}
+						ng.Events.Emit(ev)
+					}
+				}
+				windows = append(windows, *w)
+			}
+			if len(windows) > 0 {
+				printProgressTable(os.Stdout, windows)
+			}
+		}
+	}
+}
+
+// Update progress of window with the step just read from its log
+func (w *WindowProgress) update(step int, stepInterval float64, now time.Time) {
+	if step > w.NumSteps {
+		step = w.NumSteps
+	}
+	w.Step = step
+	w.Fraction = float64(step) / float64(w.NumSteps)
+
+	// Measure throughput from the first time the window was seen running
+	if w.firstStep < 0 {
+		w.firstStep = step
+		w.firstSeen = now
+		return
+	}
+	elapsed := now.Sub(w.firstSeen)
+	if elapsed <= 0 || step <= w.firstStep {
+		return
+	}
+	// steps are in fs, so ns simulated is steps * stepInterval / 1e6
+	ns := float64(step-w.firstStep) * stepInterval / 1e6
+	w.NsPerDay = ns / elapsed.Hours() * 24
+	stepsPerSecond := float64(step-w.firstStep) / elapsed.Seconds()
+	w.ETA = time.Duration(float64(w.NumSteps-step) / stepsPerSecond * float64(time.Second))
+	w.WindowETA = time.Duration(float64(w.NumSteps-step+w.stepsAfter) / stepsPerSecond * float64(time.Second))
+}
+
+// Estimate time until dynamic is finished: the slowest window must finish every repetition it has left
+func dynamicETA(windows []WindowProgress) time.Duration {
+	var eta time.Duration
+	for _, w := range windows {
+		if w.WindowETA > eta {
+			eta = w.WindowETA
+		}
+	}
+	return eta
+}
+
+// Print a table of the progress of every window
+func printProgressTable(out io.Writer, windows []WindowProgress) {
+	fmt.Fprintln(out, "\nProgress of dynamic at "+time.Now().Format("15:04:05")+" (ETA "+formatETA(dynamicETA(windows))+")")
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  Window\tBlock\tRep\tNode\tStep\t%\tns/day\tETA\tWindow ETA")
+	for _, w := range windows {
+		nsPerDay := "-"
+		if w.NsPerDay > 0 {
+			nsPerDay = strconv.FormatFloat(w.NsPerDay, 'f', 1, 64)
+		}
+		fmt.Fprintln(tw, "  "+w.Window+"\t"+w.Block+"\t"+strconv.Itoa(w.Repetition+1)+"\t"+w.Node+"\t"+
+			strconv.Itoa(w.Step)+"/"+strconv.Itoa(w.NumSteps)+"\t"+strconv.FormatFloat(100*w.Fraction, 'f', 1, 64)+"\t"+
+			nsPerDay+"\t"+formatETA(w.ETA)+"\t"+formatETA(w.WindowETA))
+	}
+	tw.Flush()
+}
+
+// Format a duration for a progress table, rounded to the second, or "-" if unknown
+func formatETA(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Second).String()
+}
+
+// Get the end of a log written on node n, either from the shared file system or over ssh depending on settings
+func (ng *NodeGroup) readLogTail(genPrm *GeneralParameters, nodeName string, logPath string) (string, error) {
+	if genPrm.LogAccess == "ssh" {
+		scriptPath, err := createTempLogTailScript(filepath.Join(genPrm.TargetDirectory, "temp"))
+		if err != nil {
+			return "", err
+		}
+		out, err := ng.backend().Run(scriptPath, nodeName, logPath)
+		return string(out), err
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	// Only read the end of long logs
+	offset := info.Size() - progressLogTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	data := make([]byte, info.Size()-offset)
+	_, err = file.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Write a shell script that prints the end of a log on a node and deposit it in chosen directory
+func createTempLogTailScript(tempDir string) (string, error) {
+	err := os.MkdirAll(tempDir, octalPermissions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory %s: %w", tempDir, err)
+	}
+	scriptPath := filepath.Join(tempDir, logTailScriptName)
+	err = writeFile(scriptPath, "#!/bin/bash\n"+
+		"node=$1\n"+
+		"log=$2\n"+
+		"ssh -o \"StrictHostKeyChecking no\" $node tail -n "+strconv.Itoa(progressLogTailLines)+" $log\n")
+	if err != nil {
+		return "", err
+	}
+	return scriptPath, nil
+}
+
+// Get the last MD step reported in a Tinker dynamic log. Step lines are those of the table under the "MD Step" header,
+// which start with the step number followed by energies, temperature and pressure
+func parseDynamicLogStep(log string) (int, bool) {
+	lines := strings.Split(log, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		fields := strings.Fields(lines[i])
+		if len(fields) < 5 {
+			continue
+		}
+		step, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		if _, err := strconv.ParseFloat(fields[1], 64); err != nil {
+			continue
+		}
+		return step, true
+	}
+	return 0, false
+}
@@ -0,0 +1,213 @@
+package fep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Estimate is a free energy in kcal/mol along with its error
+type Estimate struct {
+	Energy float64 `json:"energy"`
+	Error  float64 `json:"error"`
+}
+
+// PairResult holds the free energy change between two windows
+type PairResult struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Forward  Estimate `json:"forward"`
+	Backward Estimate `json:"backward"`
+}
+
+// Results holds the free energy change of every BAR pair along the lambda path and their totals, as well as that of
+// every extra pair, which is not part of the totals
+type Results struct {
+	Pairs    []PairResult `json:"pairs"`
+	Forward  Estimate     `json:"forward"`
+	Backward Estimate     `json:"backward"`
+	Extra    []PairResult `json:"extra,omitempty"`
+}
+
+// ReturnResults reads the BAR2 output of every pair, sums free energies along the lambda path (adding errors in
+// quadrature), writes them to results.txt in the target directory and returns them. Once written, they are sent to
+// events. The preResults and postResults hooks run around it. Hooks and events may both be nil
+func ReturnResults(genPrm *GeneralParameters, hooks *HookParameters, events *Emitter) (*Results, error) {
+	if hooks == nil {
+		hooks = &HookParameters{}
+	}
+	err := runHook(genPrm, "preResults", hooks.PreResults)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get all subdirectories in bar folder
+	subDirs, err := getBARSubDirs(genPrm.TargetDirectory)
+	if err != nil {
+		fmt.Println("Failed to find BAR subdirectories in " + genPrm.TargetDirectory + ": " + err.Error())
+	}
+
+	// iterate in order along the lambda path. Pairs set up by older versions of goFEP have no manifest and are taken
+	// from their folder names in alphabetical order
+	var manifests []*PairManifest
+	results := &Results{}
+	for i := 0; i < len(subDirs); i++ {
+		m, err := ReadPairManifest(subDirs[i])
+		if err != nil {
+			params := strings.Split(filepath.Base(subDirs[i]), "_")
+			m = &PairManifest{Name: filepath.Base(subDirs[i]), From: params[0], To: params[len(params)-1], Index: i}
+		}
+		manifests = append(manifests, m)
+	}
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].Index < manifests[j].Index
+	})
+	for _, m := range manifests {
+		forwardFEP, backwardFEP, err := getStepResult(filepath.Join(genPrm.TargetDirectory, "bar", m.Name))
+		if err != nil {
+			return nil, err
+		}
+		pair := PairResult{From: m.From, To: m.To, Forward: forwardFEP, Backward: backwardFEP}
+		if m.Extra {
+			results.Extra = append(results.Extra, pair)
+		} else {
+			results.Pairs = append(results.Pairs, pair)
+		}
+	}
+
+	// Compute total energy and square error
+	for _, pair := range results.Pairs {
+		results.Forward.Energy += pair.Forward.Energy
+		results.Forward.Error += math.Pow(pair.Forward.Error, 2)
+		results.Backward.Energy += pair.Backward.Energy
+		results.Backward.Error += math.Pow(pair.Backward.Error, 2)
+	}
+
+	// Get sqrt of sum of square errors
+	results.Forward.Error = math.Sqrt(results.Forward.Error)
+	results.Backward.Error = math.Sqrt(results.Backward.Error)
+
+	outputFile := filepath.Join(genPrm.TargetDirectory, FinalResultFileName)
+
+	// Create file to store final results
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file %s: %w", outputFile, err)
+	}
+	defer out.Close()
+
+	// Write Forward Results
+	_, err = out.WriteString("Forward FEP Results \n")
+	for _, pair := range results.Pairs {
+		_, err = out.WriteString(pair.From + " to " + pair.To + "\t" + fmt.Sprintf("%e", pair.Forward.Energy) + " +/- " + fmt.Sprintf("%e", pair.Forward.Error) + " kcal/mol \n")
+	}
+	_, err = out.WriteString("\nTotal: " + fmt.Sprintf("%e", results.Forward.Energy) + " +/- " + fmt.Sprintf("%e", results.Forward.Error) + " kcal/mol \n")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Forward FEP values to output file %s: %w", outputFile, err)
+	}
+
+	// Write Reverse Results
+	_, err = out.WriteString("\nBackward FEP Results \n")
+	for _, pair := range results.Pairs {
+		_, err = out.WriteString(pair.From + " to " + pair.To + "\t" + fmt.Sprintf("%e", pair.Backward.Energy) + " +/- " + fmt.Sprintf("%e", pair.Backward.Error) + " kcal/mol \n")
+	}
+	_, err = out.WriteString("\nTotal: " + fmt.Sprintf("%e", results.Backward.Energy) + " +/- " + fmt.Sprintf("%e", results.Backward.Error) + " kcal/mol \n")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Backward FEP values to output file %s: %w", outputFile, err)
+	}
+
+	// Write Extra Results
+	if len(results.Extra) > 0 {
+		_, err = out.WriteString("\nExtra Pairs (not part of the totals) \n")
+		for _, pair := range results.Extra {
+			_, err = out.WriteString(pair.From + " to " + pair.To + "\tForward " + fmt.Sprintf("%e", pair.Forward.Energy) + " +/- " + fmt.Sprintf("%e", pair.Forward.Error) +
+				" kcal/mol\tBackward " + fmt.Sprintf("%e", pair.Backward.Energy) + " +/- " + fmt.Sprintf("%e", pair.Backward.Error) + " kcal/mol \n")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write extra pair values to output file %s: %w", outputFile, err)
+		}
+	}
+
+	events.Emit(Event{Type: ResultsWritten, Dir: outputFile, Results: results})
+
+	err = runHook(genPrm, "postResults", hooks.PostResults, resultsHookEnv(outputFile, results)...)
+	if err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// Read forward and backward FEP free energies from the BAR2 log in subDir
+func getStepResult(subDir string) (Estimate, Estimate, error) {
+	var forwardFEPResult, backwardFEPResult Estimate
+
+	// open file
+	resultFilePath := filepath.Join(subDir, resultFileName)
+	resultFile, err := os.Open(resultFilePath)
+	if os.IsNotExist(err) {
+		return forwardFEPResult, backwardFEPResult, errors.New("failed to find a file containing BAR2 results in directory " + subDir +
+			". Such files should be named " + resultFileName)
+	} else if err != nil {
+		return forwardFEPResult, backwardFEPResult, fmt.Errorf("failed to open log file %s: %w", resultFilePath, err)
+	}
+	defer resultFile.Close()
+
+	foundForward := false
+	foundBackward := false
+
+	// read line by line
+	scanner := bufio.NewScanner(resultFile)
+	for scanner.Scan() {
+		// get next line
+		line := scanner.Text()
+
+		// Search for keywords
+		if strings.Count(line, "Free Energy via Forward FEP") > 0 {
+			forwardFEPResult = parseFEPLine(line, "Forward", resultFilePath)
+			foundForward = true
+		} else if strings.Count(line, "Free Energy via Backward FEP") > 0 {
+			backwardFEPResult = parseFEPLine(line, "Backward", resultFilePath)
+			foundBackward = true
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return forwardFEPResult, backwardFEPResult, fmt.Errorf("failed to read log file %s: %w", resultFilePath, err)
+	}
+	if !foundForward || !foundBackward {
+		return forwardFEPResult, backwardFEPResult, errors.New("missing forward or backward FEP result in " + resultFilePath)
+	}
+
+	return forwardFEPResult, backwardFEPResult, nil
+}
+
+// Get energy and error from a line of a BAR2 log such as "Free Energy via Forward FEP  -1.2345 +/- 0.0123 Kcal/mol".
+// Values that cannot be parsed are set to NaN with a warning
+func parseFEPLine(line string, direction string, resultFilePath string) Estimate {
+	tokens := strings.Fields(line)
+	estimate := Estimate{Energy: math.NaN(), Error: math.NaN()}
+	if len(tokens) < 8 {
+		fmt.Println("Warning: Failed to parse " + direction + " FEP line in file \"" + resultFilePath + "\". Setting energy to NaN")
+		return estimate
+	}
+
+	// Get FEP values
+	energy, warning := strconv.ParseFloat(tokens[5], 64)
+	if warning != nil {
+		fmt.Println("Warning: Failed to parse " + direction + " FEP energy to float in file \"" + resultFilePath + "\". Setting energy to NaN")
+	} else {
+		estimate.Energy = energy
+	}
+	plusMinus, warning := strconv.ParseFloat(tokens[7], 64)
+	if warning != nil {
+		fmt.Println("Warning: Failed to parse " + direction + " FEP energy +/- to float in file \"" + resultFilePath + "\". Setting energy +/- to NaN")
+	} else {
+		estimate.Error = plusMinus
+	}
+	return estimate
+}
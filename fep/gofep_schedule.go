@@ -0,0 +1,217 @@
+package fep
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Schedule: contains functions to generate the lambda and restraint lists of the setup block from a short description
+// of the decoupling, instead of typing them out by hand
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Keys of the setup block that generate a schedule
+var scheduleKeys = []string{"eleWindows", "vdwWindows", "eleSpacing", "vdwSpacing", "restraint"}
+
+// Check whether the setup block describes a schedule to generate rather than listing lambdas
+func hasSchedule(paramsMap map[string][]string) bool {
+	for _, key := range scheduleKeys {
+		if _, ok := paramsMap[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate the lambda and restraint lists of the setup block from its schedule. Windows start fully coupled, then
+// electrostatics are turned off over eleWindows windows, then vdW over vdwWindows windows, each spaced as eleSpacing
+// and vdwSpacing say. If restraint is set, restraints are turned on along with the first of these stages, reaching
+// restraint by its end and staying there
+func generateSchedule(paramsMap map[string][]string) (SetupParameters, error) {
+	prm := SetupParameters{Generated: true}
+
+	// Lists can't be mixed with a schedule, as it is not clear which should win
+	for _, key := range []string{"vdwLambdas", "eleLambdas", "restraints"} {
+		if _, ok := paramsMap[key]; ok {
+			return prm, errors.New("setup block of INI file sets both \"" + key + "\" and a lambda schedule (" +
+				strings.Join(scheduleKeys, ", ") + "). Please use one or the other")
+		}
+	}
+
+	// Get decoupled fraction of each window of each stage
+	eleSteps, err := getScheduleStage("ele", paramsMap)
+	if err != nil {
+		return prm, err
+	}
+	vdwSteps, err := getScheduleStage("vdw", paramsMap)
+	if err != nil {
+		return prm, err
+	}
+	if len(eleSteps)+len(vdwSteps) == 0 {
+		return prm, errors.New("lambda schedule in setup block of INI file has no windows: set \"eleWindows\" or \"vdwWindows\"")
+	}
+
+	// Get restraint to reach, if any
+	restraint := -1.0
+	if len(paramsMap["restraint"]) > 0 {
+		restraint, err = strconv.ParseFloat(paramsMap["restraint"][0], 64)
+		if err != nil || restraint < 0 {
+			return prm, errors.New("\"restraint\" in setup block of INI file must be a number of at least 0, not \"" +
+				strings.Join(paramsMap["restraint"], " ") + "\"")
+		}
+	}
+
+	// Window i has ele, vdw and restraint set from how far through each stage it is
+	addWindow := func(vdw float64, ele float64, ramp float64) {
+		prm.Vdw = append(prm.Vdw, formatLambda(vdw))
+		prm.Ele = append(prm.Ele, formatLambda(ele))
+		if restraint >= 0 {
+			prm.Rst = append(prm.Rst, formatLambda(restraint*ramp))
+		}
+	}
+	addWindow(1, 1, 0)
+	for _, f := range eleSteps {
+		addWindow(1, 1-f, f)
+	}
+	for _, f := range vdwSteps {
+		ramp := 1.0
+		if len(eleSteps) == 0 {
+			ramp = f
+		}
+		addWindow(1-f, 0, ramp)
+	}
+
+	// Windows too close together for the lambdas written would share a folder and overwrite each other
+	_, err = GetDynamicFolderNames(&prm)
+	if err != nil {
+		return prm, fmt.Errorf("lambda schedule in setup block of INI file has windows too close together: %w", err)
+	}
+	return prm, nil
+}
+
+// Get how far decoupled (0 to 1) each window of the stage turning off kind ("ele" or "vdw") is, from the number of
+// windows and spacing in paramsMap. The last window is always fully decoupled
+func getScheduleStage(kind string, paramsMap map[string][]string) ([]float64, error) {
+	windowsKey := kind + "Windows"
+	spacingKey := kind + "Spacing"
+
+	// Get number of windows, which custom spacing can give instead
+	numWindows := -1
+	if len(paramsMap[windowsKey]) > 0 {
+		var err error
+		numWindows, err = strconv.Atoi(paramsMap[windowsKey][0])
+		if err != nil || numWindows < 0 {
+			return nil, errors.New("\"" + windowsKey + "\" in setup block of INI file must be a whole number of at least 0, not \"" +
+				paramsMap[windowsKey][0] + "\"")
+		}
+	}
+
+	spacing := paramsMap[spacingKey]
+	if len(spacing) == 0 {
+		spacing = []string{"linear"}
+	}
+	if spacing[0] == "custom" {
+		return getCustomStage(kind, spacing[1:], numWindows)
+	}
+	if numWindows <= 0 {
+		return nil, nil
+	}
+
+	// Get fraction decoupled at each window from fraction t of the stage done
+	var fraction func(t float64) float64
+	switch spacing[0] {
+	case "linear":
+		fraction = func(t float64) float64 { return t }
+	case "endpoints":
+		// cosine spacing is densest near both ends, where free energy changes fastest
+		fraction = func(t float64) float64 { return (1 - math.Cos(math.Pi*t)) / 2 }
+	case "geometric":
+		if len(spacing) < 2 {
+			return nil, errors.New("\"" + spacingKey + " geometric\" in setup block of INI file needs a ratio, e.g. \"" +
+				spacingKey + " geometric 0.8\"")
+		}
+		ratio, err := strconv.ParseFloat(spacing[1], 64)
+		if err != nil || ratio <= 0 {
+			return nil, errors.New("ratio of \"" + spacingKey + " geometric\" in setup block of INI file must be a number above 0, not \"" +
+				spacing[1] + "\"")
+		}
+		// each step is ratio times the one before it, so steps shrink towards the end of the stage if ratio < 1
+		n := float64(numWindows)
+		fraction = func(t float64) float64 {
+			if ratio == 1 {
+				return t
+			}
+			return (math.Pow(ratio, t*n) - 1) / (math.Pow(ratio, n) - 1)
+		}
+	default:
+		return nil, errors.New("\"" + spacingKey + "\" in setup block of INI file must be \"linear\", \"geometric <ratio>\", " +
+			"\"endpoints\" or \"custom <lambdas>\", not \"" + strings.Join(spacing, " ") + "\"")
+	}
+
+	steps := make([]float64, numWindows)
+	for i := range steps {
+		steps[i] = fraction(float64(i+1) / float64(numWindows))
+	}
+	steps[numWindows-1] = 1
+	return steps, nil
+}
+
+// Get how far decoupled each window of a stage with custom spacing is from its lambdas, which must fall from below 1
+// to 0. If numWindows is not -1 it must match the number of lambdas
+func getCustomStage(kind string, lambdas []string, numWindows int) ([]float64, error) {
+	spacingKey := kind + "Spacing"
+	if numWindows >= 0 && numWindows != len(lambdas) {
+		return nil, errors.New("\"" + spacingKey + " custom\" in setup block of INI file lists " + strconv.Itoa(len(lambdas)) +
+			" lambdas but \"" + kind + "Windows\" is " + strconv.Itoa(numWindows))
+	}
+	steps := make([]float64, len(lambdas))
+	last := 1.0
+	for i, lambda := range lambdas {
+		value, err := strconv.ParseFloat(lambda, 64)
+		if err != nil || value >= last || value < 0 {
+			return nil, errors.New("lambdas of \"" + spacingKey + " custom\" in setup block of INI file must fall from below 1 to 0, " +
+				"but found \"" + lambda + "\"")
+		}
+		last = value
+		steps[i] = 1 - value
+	}
+	if len(lambdas) > 0 && last != 0 {
+		return nil, errors.New("lambdas of \"" + spacingKey + " custom\" in setup block of INI file must end at 0")
+	}
+	return steps, nil
+}
+
+// Format a lambda or restraint to at most 4 decimals, keeping at least one as in hand written lists (e.g. 1.0, 0.25)
+func formatLambda(value float64) string {
+	s := strconv.FormatFloat(value, 'f', 4, 64)
+	s = strings.TrimRight(s, "0")
+	if strings.HasSuffix(s, ".") {
+		s += "0"
+	}
+	return s
+}
+
+// Print the lambdas and restraint of every window of a generated schedule, so it can be checked before running it
+func printSchedule(out io.Writer, prm *SetupParameters) {
+	folders, _ := GetDynamicFolderNames(prm)
+	fmt.Fprintln(out, "  Lambda schedule generated from the setup block:")
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "    Window\tvdw\tele"
+	if len(prm.Rst) > 0 {
+		header += "\trestraint"
+	}
+	fmt.Fprintln(tw, header)
+	for i := range prm.Vdw {
+		line := "    " + folders[i] + "\t" + prm.Vdw[i] + "\t" + prm.Ele[i]
+		if len(prm.Rst) > 0 {
+			line += "\t" + prm.Rst[i]
+		}
+		fmt.Fprintln(tw, line)
+	}
+	tw.Flush()
+}
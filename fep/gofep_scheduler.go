@@ -0,0 +1,431 @@
+package fep
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Scheduler: contains the scheduler that shares one pool of nodes between several runs by fair share, priority and
+// per-user caps, granting nodes one job at a time, and the functions the managers use to place jobs on nodes with or
+// without it
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Scheduler grants nodes of a shared pool to jobs of several runs, one job per node at a time. Nodes that are busy with
+// anything else, as seen by nvidia-smi, are never granted. When several jobs wait for a node, the scheduler serves:
+//
+//  1. jobs of the highest priority, a job gaining one level of priority for every PriorityAging it has waited
+//  2. then jobs of the user with the least fair-share usage: GPU-hours used, forgotten with a half-life of
+//     UsageHalfLife, and counting jobs running now up to now
+//  3. then jobs of the user, then of the run, with the fewest jobs running, so runs of equal standing interleave
+//  4. then the job that has waited longest
+//
+// Jobs of users holding as many nodes as their cap wait until one of their jobs is done
+type Scheduler struct {
+	pool      *NodeGroup
+	directory string
+	interval  time.Duration
+	prm       SchedulerParameters
+
+	mu      sync.Mutex
+	leases  map[string]lease
+	runs    map[string]*scheduledRun
+	users   map[string]*UserUsage
+	waiting []*nodeRequest
+	wake    chan struct{}
+}
+
+// A node granted to a job of run
+type lease struct {
+	run     string
+	started time.Time
+}
+
+// A run known to the scheduler
+type scheduledRun struct {
+	user     string
+	priority int
+	running  int
+	gpuHours float64
+}
+
+// UserUsage is how much of the pool a user has used
+type UserUsage struct {
+	User string `json:"user"`
+	// Running is the number of nodes held by jobs of the user, out of MaxNodes (0 for no cap)
+	Running  int `json:"running"`
+	MaxNodes int `json:"max_nodes"`
+	// GPUHours is all GPU time used by jobs of the user that are done
+	GPUHours float64 `json:"gpu_hours"`
+	// FairShare is the GPU-hours the scheduler weighs the user by: past usage decayed with the usage half-life, plus
+	// jobs running now
+	FairShare float64 `json:"fair_share"`
+	// Decayed is the decayed past usage as of Updated
+	Decayed float64   `json:"decayed"`
+	Updated time.Time `json:"updated"`
+}
+
+// A job of run waiting for a node
+type nodeRequest struct {
+	run    string
+	queued time.Time
+	node   chan Node
+}
+
+// NewScheduler creates a scheduler sharing the nodes of pool by the rules in prm. Node status checks write their script
+// to the temp folder in directory, and are repeated every interval while jobs wait. The usage of each user is kept in
+// directory so it carries over to the next scheduler. Call Start to begin granting nodes
+func NewScheduler(pool *NodeGroup, directory string, interval time.Duration, prm SchedulerParameters) *Scheduler {
+	s := &Scheduler{
+		pool:      pool,
+		directory: directory,
+		interval:  interval,
+		prm:       prm,
+		leases:    map[string]lease{},
+		runs:      map[string]*scheduledRun{},
+		users:     map[string]*UserUsage{},
+		wake:      make(chan struct{}, 1),
+	}
+	s.loadUsage()
+	return s
+}
+
+// Start grants nodes to waiting jobs until stop is closed
+func (s *Scheduler) Start(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-s.wake:
+			case <-ticker.C:
+			}
+			s.dispatch()
+		}
+	}()
+}
+
+// AddRun tells the scheduler which user run belongs to and its priority (higher goes first). Runs not added are taken
+// to belong to a user named after them, with priority 0
+func (s *Scheduler) AddRun(run string, user string, priority int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.run(run)
+	r.user = user
+	r.priority = priority
+}
+
+// Acquire blocks until a node is granted to a job of run, and returns a copy of it. Release it once the job is done
+func (s *Scheduler) Acquire(run string) *Node {
+	req := &nodeRequest{run: run, queued: time.Now(), node: make(chan Node, 1)}
+	s.mu.Lock()
+	s.run(run)
+	s.waiting = append(s.waiting, req)
+	s.mu.Unlock()
+	s.signal()
+
+	n := <-req.node
+	return &n
+}
+
+// Release returns node n granted to a job of run to the pool, charging the time it was held to the run and its user
+func (s *Scheduler) Release(run string, n *Node) {
+	s.mu.Lock()
+	key := n.Name + ":" + n.CardNumber
+	l, ok := s.leases[key]
+	if ok {
+		delete(s.leases, key)
+		now := time.Now()
+		hours := now.Sub(l.started).Hours()
+		r := s.run(run)
+		r.running--
+		r.gpuHours += hours
+		u := s.user(r.user)
+		u.Running--
+		s.decay(u, now)
+		u.Decayed += hours
+		u.GPUHours += hours
+	}
+	s.mu.Unlock()
+	s.saveUsage()
+	s.signal()
+}
+
+// Running returns the number of jobs each run has running
+func (s *Scheduler) Running() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	running := map[string]int{}
+	for id, r := range s.runs {
+		if r.running > 0 {
+			running[id] = r.running
+		}
+	}
+	return running
+}
+
+// GPUHours returns the GPU-hours used by jobs of run, counting jobs running now up to now
+func (s *Scheduler) GPUHours(run string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.runs[run]
+	if !ok {
+		return 0
+	}
+	hours := r.gpuHours
+	now := time.Now()
+	for _, l := range s.leases {
+		if l.run == run {
+			hours += now.Sub(l.started).Hours()
+		}
+	}
+	return hours
+}
+
+// Usage returns the usage of every user the scheduler knows, sorted by name
+func (s *Scheduler) Usage() []UserUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var usage []UserUsage
+	for name, u := range s.users {
+		s.decay(u, now)
+		copied := *u
+		copied.MaxNodes = s.maxNodes(name)
+		copied.FairShare = s.fairShare(name, now)
+		usage = append(usage, copied)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].User < usage[j].User })
+	return usage
+}
+
+// Wake the dispatch loop without blocking
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Check which nodes are free and grant them to waiting jobs, called by the loop started by Start
+func (s *Scheduler) dispatch() {
+	s.mu.Lock()
+	numWaiting := len(s.waiting)
+	s.mu.Unlock()
+	if numWaiting == 0 {
+		return
+	}
+
+	// Only the dispatch loop touches the pool, so its status can be updated without holding the lock
+	err := s.pool.UpdateStatus(s.directory)
+	if err != nil {
+		fmt.Println("Warning: scheduler failed to update node status: " + err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, i := range s.pool.FreeNodeIndices {
+		n := s.pool.Nodes[i]
+		key := n.Name + ":" + n.CardNumber
+		if _, leased := s.leases[key]; leased {
+			continue
+		}
+		next := s.next(now)
+		if next < 0 {
+			return
+		}
+		req := s.waiting[next]
+		s.waiting = append(s.waiting[:next], s.waiting[next+1:]...)
+		s.leases[key] = lease{run: req.run, started: now}
+		r := s.run(req.run)
+		r.running++
+		s.user(r.user).Running++
+		req.node <- n
+	}
+}
+
+// Get index of the waiting request to serve next by the rules of Scheduler, or -1 if all waiting jobs belong to users
+// at their cap
+func (s *Scheduler) next(now time.Time) int {
+	best := -1
+	var bestPriority int
+	var bestShare float64
+	for i, req := range s.waiting {
+		r := s.runs[req.run]
+		if maxNodes := s.maxNodes(r.user); maxNodes > 0 && s.user(r.user).Running >= maxNodes {
+			continue
+		}
+		priority := r.priority
+		if s.prm.PriorityAging > 0 {
+			priority += int(now.Sub(req.queued) / s.prm.PriorityAging)
+		}
+		share := s.fairShare(r.user, now)
+		if best >= 0 {
+			bestRun := s.runs[s.waiting[best].run]
+			if priority < bestPriority || (priority == bestPriority && share > bestShare) {
+				continue
+			}
+			if priority == bestPriority && share == bestShare {
+				running, bestRunning := s.user(r.user).Running, s.user(bestRun.user).Running
+				if running > bestRunning || (running == bestRunning && r.running >= bestRun.running) {
+					continue
+				}
+			}
+		}
+		best, bestPriority, bestShare = i, priority, share
+	}
+	return best
+}
+
+// Get cap on nodes held by jobs of user, 0 for no cap
+func (s *Scheduler) maxNodes(user string) int {
+	if maxNodes, ok := s.prm.UserMaxNodes[user]; ok {
+		return maxNodes
+	}
+	return s.prm.MaxNodesPerUser
+}
+
+// Get fair-share usage of user at now: decayed past usage plus the jobs it runs now
+func (s *Scheduler) fairShare(user string, now time.Time) float64 {
+	u := s.user(user)
+	s.decay(u, now)
+	share := u.Decayed
+	for _, l := range s.leases {
+		if s.runs[l.run].user == user {
+			share += now.Sub(l.started).Hours()
+		}
+	}
+	return share
+}
+
+// Decay past usage of u up to now
+func (s *Scheduler) decay(u *UserUsage, now time.Time) {
+	if s.prm.UsageHalfLife > 0 && !u.Updated.IsZero() && now.After(u.Updated) {
+		u.Decayed *= math.Pow(0.5, float64(now.Sub(u.Updated))/float64(s.prm.UsageHalfLife))
+	}
+	u.Updated = now
+}
+
+// Get run with id, adding it if new
+func (s *Scheduler) run(id string) *scheduledRun {
+	r, ok := s.runs[id]
+	if !ok {
+		r = &scheduledRun{user: id}
+		s.runs[id] = r
+	}
+	return r
+}
+
+// Get usage of user, adding it if new
+func (s *Scheduler) user(name string) *UserUsage {
+	u, ok := s.users[name]
+	if !ok {
+		u = &UserUsage{User: name}
+		s.users[name] = u
+	}
+	return u
+}
+
+// Write usage of every user to directory
+func (s *Scheduler) saveUsage() {
+	s.mu.Lock()
+	usage := make([]UserUsage, 0, len(s.users))
+	for _, u := range s.users {
+		copied := *u
+		copied.Running = 0
+		usage = append(usage, copied)
+	}
+	s.mu.Unlock()
+
+	data, err := json.MarshalIndent(usage, "", "  ")
+	if err == nil {
+		err = writeFile(filepath.Join(s.directory, schedulerUsageFileName), string(data)+"\n")
+	}
+	if err != nil {
+		fmt.Println("Warning: failed to save usage of scheduler: " + err.Error())
+	}
+}
+
+// Read usage of every user saved by an earlier scheduler in directory, if any
+func (s *Scheduler) loadUsage() {
+	data, err := ioutil.ReadFile(filepath.Join(s.directory, schedulerUsageFileName))
+	if err != nil {
+		return
+	}
+	var usage []UserUsage
+	if json.Unmarshal(data, &usage) != nil {
+		fmt.Println("Warning: ignoring unreadable usage in " + filepath.Join(s.directory, schedulerUsageFileName))
+		return
+	}
+	for i := range usage {
+		usage[i].Running = 0
+		s.users[usage[i].User] = &usage[i]
+	}
+}
+
+// Check which nodes are free and cap maxNodes to their number, returning the capped value. When a scheduler grants
+// nodes instead, nothing is checked and maxNodes is returned as is
+func (ng *NodeGroup) findFreeNodes(genPrm *GeneralParameters, maxNodes int) (int, error) {
+	if ng.Scheduler != nil {
+		return maxNodes, nil
+	}
+
+	fmt.Print("\nLooking for " + strconv.Itoa(maxNodes) + " available nodes...")
+	t1 := time.Now()
+	err := ng.UpdateStatus(genPrm.TargetDirectory)
+	if err != nil {
+		return 0, err
+	}
+	t2 := time.Now()
+	fmt.Print("found " + strconv.Itoa(len(ng.FreeNodeIndices)) + " available nodes in " + t2.Sub(t1).String())
+	if len(ng.FreeNodeIndices) == 0 {
+		return 0, errors.New("did not find enough free nodes to run on")
+	}
+
+	// Never cycle through more nodes than were found to be free
+	if maxNodes > len(ng.FreeNodeIndices) || maxNodes < 1 {
+		maxNodes = len(ng.FreeNodeIndices)
+	}
+	return maxNodes, nil
+}
+
+// Assign the i-th job queued to a free node by cycling through the first maxNodes free nodes, returning the node's
+// index. When a scheduler grants nodes instead, the job is left without a node and -1 is returned
+func (ng *NodeGroup) assignNode(job *Job, i int, maxNodes int) int {
+	if ng.Scheduler != nil {
+		return -1
+	}
+	nodeIndex := ng.FreeNodeIndices[i%maxNodes]
+	job.Node = ng.Nodes[nodeIndex].Name
+	return nodeIndex
+}
+
+// Launch run for job in a goroutine on node nodeIndex or, when a scheduler grants nodes, on the node it grants once it
+// does. run must call Done on the wait group it is given, which in turn calls Done on wg
+func (ng *NodeGroup) launch(job *Job, nodeIndex int, wg *sync.WaitGroup, run func(n *Node, wg *sync.WaitGroup)) {
+	if ng.Scheduler == nil {
+		go run(&ng.Nodes[nodeIndex], wg)
+		return
+	}
+	go func() {
+		defer wg.Done()
+		n := ng.Scheduler.Acquire(ng.RunID)
+		job.Node = n.Name
+		jobWG := sync.WaitGroup{}
+		jobWG.Add(1)
+		run(n, &jobWG)
+		ng.Scheduler.Release(ng.RunID, n)
+	}()
+}
@@ -0,0 +1,180 @@
+package fep
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// A run added to the scheduler in a test, with the jobs it already has running
+type testRun struct {
+	id       string
+	user     string
+	priority int
+	running  int
+}
+
+// A job of run waiting for a node in a test, queued waited ago
+type testRequest struct {
+	run    string
+	waited time.Duration
+}
+
+func TestSchedulerGrantOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		prm     SchedulerParameters
+		runs    []testRun
+		usage   map[string]float64
+		waiting []testRequest
+		nodes   int
+		// runs granted a node, in order
+		want []string
+	}{
+		{
+			name:    "highest priority first",
+			runs:    []testRun{{id: "a", user: "alice"}, {id: "b", user: "bob", priority: 2}},
+			waiting: []testRequest{{run: "a"}, {run: "a"}, {run: "b"}},
+			nodes:   3,
+			want:    []string{"b", "a", "a"},
+		},
+		{
+			name:    "least fair-share usage first",
+			runs:    []testRun{{id: "a", user: "alice"}, {id: "b", user: "bob"}},
+			usage:   map[string]float64{"alice": 10, "bob": 1},
+			waiting: []testRequest{{run: "a"}, {run: "b"}, {run: "a"}},
+			nodes:   2,
+			want:    []string{"b", "a"},
+		},
+		{
+			name:    "priority before fair share",
+			runs:    []testRun{{id: "a", user: "alice", priority: 1}, {id: "b", user: "bob"}},
+			usage:   map[string]float64{"alice": 100},
+			waiting: []testRequest{{run: "b"}, {run: "a"}},
+			nodes:   2,
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "users then runs interleave",
+			runs:    []testRun{{id: "a1", user: "alice"}, {id: "a2", user: "alice"}, {id: "b", user: "bob"}},
+			waiting: []testRequest{{run: "a1"}, {run: "a1"}, {run: "a2"}, {run: "a2"}, {run: "b"}, {run: "b"}},
+			nodes:   6,
+			want:    []string{"a1", "b", "a2", "b", "a1", "a2"},
+		},
+		{
+			name:    "jobs already running count",
+			runs:    []testRun{{id: "a", user: "alice"}, {id: "b", user: "bob", running: 2}},
+			waiting: []testRequest{{run: "b"}, {run: "a"}, {run: "a"}, {run: "b"}},
+			nodes:   3,
+			want:    []string{"a", "a", "b"},
+		},
+		{
+			name:    "cap per user",
+			prm:     SchedulerParameters{MaxNodesPerUser: 1},
+			runs:    []testRun{{id: "a", user: "alice"}, {id: "b", user: "bob"}},
+			waiting: []testRequest{{run: "a"}, {run: "a"}, {run: "b"}},
+			nodes:   3,
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "cap of one user replaces default",
+			prm:     SchedulerParameters{MaxNodesPerUser: 1, UserMaxNodes: map[string]int{"alice": 2}},
+			runs:    []testRun{{id: "a", user: "alice"}, {id: "b", user: "bob"}},
+			waiting: []testRequest{{run: "a"}, {run: "a"}, {run: "a"}, {run: "b"}, {run: "b"}},
+			nodes:   5,
+			want:    []string{"a", "b", "a"},
+		},
+		{
+			name:    "cap counts jobs already running",
+			prm:     SchedulerParameters{MaxNodesPerUser: 1},
+			runs:    []testRun{{id: "a", user: "alice", running: 1}, {id: "b", user: "bob"}},
+			waiting: []testRequest{{run: "a"}, {run: "b"}},
+			nodes:   2,
+			want:    []string{"b"},
+		},
+		{
+			name:    "waiting jobs gain priority",
+			prm:     SchedulerParameters{PriorityAging: time.Hour},
+			runs:    []testRun{{id: "a", user: "alice", priority: 2}, {id: "b", user: "bob"}},
+			waiting: []testRequest{{run: "a"}, {run: "b", waited: 3*time.Hour + time.Minute}},
+			nodes:   2,
+			want:    []string{"b", "a"},
+		},
+		{
+			name:    "aging short of a level",
+			prm:     SchedulerParameters{PriorityAging: time.Hour},
+			runs:    []testRun{{id: "a", user: "alice", priority: 2}, {id: "b", user: "bob"}},
+			waiting: []testRequest{{run: "b", waited: 119 * time.Minute}, {run: "a"}},
+			nodes:   2,
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "aging disabled",
+			runs:    []testRun{{id: "a", user: "alice", priority: 2}, {id: "b", user: "bob"}},
+			waiting: []testRequest{{run: "b", waited: 100 * time.Hour}, {run: "a"}},
+			nodes:   2,
+			want:    []string{"a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gofep")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			pool := &NodeGroup{Backend: NewSimulatedBackend()}
+			for i := 0; i < test.nodes; i++ {
+				pool.Nodes = append(pool.Nodes, Node{Name: "node" + strconv.Itoa(i), CardNumber: "0"})
+			}
+			s := NewScheduler(pool, dir, time.Minute, test.prm)
+
+			// Add runs, holding nodes outside the pool for jobs already running, and usage
+			now := time.Now()
+			for _, run := range test.runs {
+				s.AddRun(run.id, run.user, run.priority)
+				for i := 0; i < run.running; i++ {
+					s.leases["busy-"+run.id+":"+strconv.Itoa(i)] = lease{run: run.id, started: now}
+					s.runs[run.id].running++
+					s.user(run.user).Running++
+				}
+			}
+			for user, hours := range test.usage {
+				s.user(user).Decayed = hours
+			}
+			var requests []*nodeRequest
+			for _, waiting := range test.waiting {
+				req := &nodeRequest{run: waiting.run, queued: now.Add(-waiting.waited), node: make(chan Node, 1)}
+				requests = append(requests, req)
+				s.waiting = append(s.waiting, req)
+			}
+
+			// Nodes are granted in the order of the pool, so the run granted the i-th node was served i-th
+			s.dispatch()
+			got := make([]string, len(test.want))
+			granted := 0
+			for _, req := range requests {
+				select {
+				case n := <-req.node:
+					i, err := strconv.Atoi(n.Name[len("node"):])
+					if err != nil || i >= len(got) {
+						t.Fatalf("run %s was granted unexpected node %s", req.run, n.Name)
+					}
+					got[i] = req.run
+					granted++
+				default:
+				}
+			}
+			if granted != len(test.want) || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %d grants in order %q, want %q", granted, got, test.want)
+			}
+			if len(s.waiting) != len(test.waiting)-granted {
+				t.Errorf("%d jobs still waiting, want %d", len(s.waiting), len(test.waiting)-granted)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package fep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jgourary/goFEP/xyz"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Seed: contains functions to start each window from the last frame of the seed block of the window before it along
+// the lambda path, rather than every window from the input xyz file, so windows far from it need less equilibration
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Seed of a window as checked against the build state: the window it is seeded from, the block whose last frame seeds
+// it, and the stamp of that block in that window
+type seedStep struct {
+	from  string
+	block string
+	stamp string
+}
+
+// A seed that a window waits for before it starts. ready is closed once the seed is written, or err set if it can't be
+type windowSeed struct {
+	subDir string
+	seedStep
+	ready chan struct{}
+	err   error
+}
+
+// Check whether window i of the setup block is seeded from the window before it: with sequential seeding, every
+// window but the first and those given their own xyz file is
+func isSeeded(prm *SetupParameters, overrides []WindowOverride, i int) bool {
+	return prm.Seeding == "sequential" && i > 0 && overrides[i].XYZ == ""
+}
+
+// Get the stamp of the seed of the window in subDir from the stamps at the end of each block of the windows checked
+// before it, or "" if the window is not seeded. The seed is recorded as expected, so it is built with its stamp once
+// written
+func (b *buildState) checkSeed(subDir string, blockEnds map[string]map[string]string) (string, error) {
+	m, err := ReadWindowManifest(subDir)
+	if err != nil || m.SeededFrom == "" {
+		return "", nil
+	}
+	ends, ok := blockEnds[m.SeededFrom]
+	if !ok {
+		return "", errors.New("window " + m.Name + " is seeded from window " + m.SeededFrom + ", which is not set up: run setup again")
+	}
+	stamp, ok := ends[m.SeedBlock]
+	if !ok {
+		return "", errors.New("window " + m.Name + " is seeded from block " + m.SeedBlock + ", which is not a dynamic block: run setup again")
+	}
+	step := seedStep{from: m.SeededFrom, block: m.SeedBlock, stamp: stamp}
+	b.mu.Lock()
+	b.seeds[m.Name] = step
+	b.mu.Unlock()
+	b.expect("seed/"+m.Name, stamp)
+	return stamp, nil
+}
+
+// Get the seeds the chains wait for: those of windows that start from their first step and whose seed is not up to
+// date. Seeds whose block has already finished in the window they come from are written straight away
+func (ng *NodeGroup) getWindowSeeds(dynDirectory string, dynPrm []DynamicParameters, chains []dynamicChain) []*windowSeed {
+	if ng.build == nil {
+		return nil
+	}
+
+	// Find windows whose seed block still runs
+	running := make(map[string]bool)
+	for _, chain := range chains {
+		for i := range chain.jobs {
+			running[filepath.Base(chain.subDir)+"/"+dynPrm[chain.blocks[i]].Name] = true
+		}
+	}
+
+	var seeds []*windowSeed
+	for _, chain := range chains {
+		window := filepath.Base(chain.subDir)
+		ng.build.mu.Lock()
+		step, ok := ng.build.seeds[window]
+		ng.build.mu.Unlock()
+		first := chain.jobs[0]
+		if !ok || first.Block != dynPrm[0].Name || first.Repetition != 0 || ng.build.get("seed/"+window) == step.stamp {
+			continue
+		}
+		seed := &windowSeed{subDir: chain.subDir, seedStep: step, ready: make(chan struct{})}
+		seeds = append(seeds, seed)
+		if !running[step.from+"/"+step.block] {
+			ng.writeSeed(seed, filepath.Join(dynDirectory, step.from), dynPrm)
+		}
+	}
+	return seeds
+}
+
+// Write the seeds of the windows seeded from the window in subDir after its block prm, or fail them with err if the
+// block failed
+func (ng *NodeGroup) seedFrom(seeds []*windowSeed, subDir string, prm *DynamicParameters, dynPrm []DynamicParameters, err error) {
+	for _, seed := range seeds {
+		if seed.from != filepath.Base(subDir) || seed.block != prm.Name {
+			continue
+		}
+		if err != nil {
+			seed.err = errors.New("not run as window " + seed.from + " it is seeded from did not finish " + prm.Name)
+			close(seed.ready)
+			continue
+		}
+		ng.writeSeed(seed, subDir, dynPrm)
+	}
+}
+
+// Write the last frame of the seed block of the window in fromDir as the xyz file of the seeded window, then mark the
+// seed ready
+func (ng *NodeGroup) writeSeed(seed *windowSeed, fromDir string, dynPrm []DynamicParameters) {
+	defer close(seed.ready)
+	window := filepath.Base(seed.subDir)
+	for _, prm := range dynPrm {
+		if prm.Name != seed.block {
+			continue
+		}
+		frame, err := getSeedFrame(fromDir, &prm)
+		if err == nil {
+			var xyzPath string
+			xyzPath, _, err = getDynamicFilePaths(seed.subDir)
+			if err == nil {
+				err = writeFile(xyzPath, frame)
+			}
+		}
+		if err != nil {
+			seed.err = fmt.Errorf("failed to seed window %s from window %s: %w", window, seed.from, err)
+			fmt.Println(seed.err)
+			return
+		}
+		fmt.Println("Seeded window " + window + " from the last frame of " + prm.Name + " in window " + seed.from)
+		ng.build.done("seed/" + window)
+		return
+	}
+	seed.err = errors.New("failed to seed window " + window + ": " + seed.block + " is not a dynamic block")
+}
+
+// Get the last frame of block prm in the window in subDir from its arc file, which later blocks may have added to.
+// The frame is found from the frame number in the log of the last repetition of the block
+func getSeedFrame(subDir string, prm *DynamicParameters) (string, error) {
+	xyzPath, _, err := getDynamicFilePaths(subDir)
+	if err != nil {
+		return "", err
+	}
+	logPath := filepath.Join(subDir, prm.Name+"_"+strconv.Itoa(prm.Repetitions-1)+".log")
+	frameNum, err := getLastFrameNumber(logPath)
+	if err != nil {
+		return "", err
+	}
+	frame, err := xyz.ReadFrame(strings.TrimSuffix(xyzPath, filepath.Ext(xyzPath))+".arc", frameNum)
+	if err != nil {
+		return "", err
+	}
+	return frame.String(), nil
+}
+
+// Get the number of the last frame a dynamic log reports saving
+func getLastFrameNumber(logPath string) (int, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open log file %s: %w", logPath, err)
+	}
+	defer file.Close()
+	frameNum := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		tokens := strings.Fields(scanner.Text())
+		if len(tokens) == 3 && tokens[0] == "Frame" && tokens[1] == "Number" {
+			frameNum, _ = strconv.Atoi(tokens[2])
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read log file %s: %w", logPath, err)
+	}
+	if frameNum == 0 {
+		return 0, errors.New("found no saved frame in log file " + logPath)
+	}
+	return frameNum, nil
+}
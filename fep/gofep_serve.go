@@ -0,0 +1,212 @@
+package fep
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Serve: contains an HTTP server exposing the state of a run as JSON (/status) and as Prometheus metrics (/metrics)
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// StatusServer serves the state of a run, kept up to date by subscribing its Apply method to the run's emitter
+type StatusServer struct {
+	mu    sync.Mutex
+	state *RunState
+}
+
+// NewStatusServer creates a status server starting from the state rebuilt from past events, e.g. from the run journal
+func NewStatusServer(events []Event) *StatusServer {
+	return &StatusServer{state: BuildRunState(events)}
+}
+
+// Apply updates the served state with one event
+func (s *StatusServer) Apply(ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Apply(ev)
+}
+
+// ServeHTTP serves /status as JSON and /metrics in the Prometheus text format
+func (s *StatusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/", "/status":
+		s.serveStatus(w)
+	case "/metrics":
+		s.serveMetrics(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Status of a run as served on /status
+type runStatus struct {
+	*RunState
+	Windows     []windowStatus             `json:"windows"`
+	JobCounts   map[JobKind]map[string]int `json:"job_counts"`
+	GPUHours    float64                    `json:"gpu_hours"`
+	SimulatedNs float64                    `json:"simulated_ns"`
+	// Results sums free energies of the BAR pairs finished so far
+	Results *Results `json:"results"`
+}
+
+// Window state as served on /status
+type windowStatus struct {
+	WindowState
+	ETASeconds float64 `json:"eta_seconds"`
+}
+
+// Write state of run as JSON
+func (s *StatusServer) serveStatus(w http.ResponseWriter) {
+	status := runStatus{
+		RunState:    s.state,
+		Windows:     make([]windowStatus, len(s.state.Windows)),
+		JobCounts:   s.state.JobCounts(),
+		GPUHours:    s.state.GPUHours(time.Now()),
+		SimulatedNs: s.state.SimulatedNs(),
+		Results:     partialResults(s.state),
+	}
+	for i, window := range s.state.Windows {
+		status.Windows[i] = windowStatus{WindowState: window, ETASeconds: window.ETA.Seconds()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Write metrics of run in the Prometheus text exposition format
+func (s *StatusServer) serveMetrics(w http.ResponseWriter) {
+	var b strings.Builder
+	rs := s.state
+
+	writeMetricHeader(&b, "gofep_jobs", "gauge", "Number of jobs by kind and state")
+	counts := rs.JobCounts()
+	for _, kind := range []JobKind{DynamicJob, BAR1Job, BAR2Job} {
+		for _, state := range []string{StateQueued, StateRunning, StateFinished, StateFailed} {
+			writeMetric(&b, "gofep_jobs", map[string]string{"kind": string(kind), "state": state}, float64(counts[kind][state]))
+		}
+	}
+
+	writeMetricHeader(&b, "gofep_gpu_hours_total", "counter", "GPU-hours used by jobs, one GPU per job")
+	writeMetric(&b, "gofep_gpu_hours_total", nil, rs.GPUHours(time.Now()))
+
+	writeMetricHeader(&b, "gofep_simulated_ns_total", "counter", "Simulation time completed by dynamic jobs in ns")
+	writeMetric(&b, "gofep_simulated_ns_total", nil, rs.SimulatedNs())
+
+	writeMetricHeader(&b, "gofep_stage_running", "gauge", "Whether a stage is running (1) or not (0)")
+	for _, stage := range []string{SetupStage, DynamicStage, BARSetupStage, BAR1Stage, BAR2Stage} {
+		running := 0.0
+		if rs.Stage == stage && rs.StageRunning {
+			running = 1
+		}
+		writeMetric(&b, "gofep_stage_running", map[string]string{"stage": stage}, running)
+	}
+
+	// Per node metrics, with throughput summed over the dynamic jobs running on each node
+	nodeThroughput := map[string]float64{}
+	nodeNs := map[string]float64{}
+	for _, job := range rs.Jobs {
+		if job.Kind != DynamicJob {
+			continue
+		}
+		nodeNs[job.Node] += job.Progress * job.Ns
+		if job.State == StateRunning {
+			nodeThroughput[job.Node] += job.NsPerDay
+		}
+	}
+	writeMetricHeader(&b, "gofep_node_free", "gauge", "Whether a node was free (1) or busy (0) when last checked")
+	for _, n := range rs.Nodes {
+		free := 0.0
+		if n.Status == "free" {
+			free = 1
+		}
+		writeMetric(&b, "gofep_node_free", map[string]string{"node": n.Name}, free)
+	}
+	writeMetricHeader(&b, "gofep_node_running_jobs", "gauge", "Number of goFEP jobs running on a node")
+	for _, n := range rs.Nodes {
+		writeMetric(&b, "gofep_node_running_jobs", map[string]string{"node": n.Name}, float64(n.Running))
+	}
+	writeMetricHeader(&b, "gofep_node_throughput_ns_per_day", "gauge", "Throughput of dynamic jobs running on a node in ns/day")
+	for _, n := range rs.Nodes {
+		writeMetric(&b, "gofep_node_throughput_ns_per_day", map[string]string{"node": n.Name}, nodeThroughput[n.Name])
+	}
+	writeMetricHeader(&b, "gofep_node_simulated_ns_total", "counter", "Simulation time completed by dynamic jobs on a node in ns")
+	for _, n := range rs.Nodes {
+		writeMetric(&b, "gofep_node_simulated_ns_total", map[string]string{"node": n.Name}, nodeNs[n.Name])
+	}
+
+	writeMetricHeader(&b, "gofep_window_progress", "gauge", "Fraction of the current dynamic repetition complete in a window")
+	for _, window := range rs.Windows {
+		writeMetric(&b, "gofep_window_progress", map[string]string{"window": window.Window, "block": window.Block,
+			"repetition": strconv.Itoa(window.Repetition + 1)}, window.Progress)
+	}
+
+	writeMetricHeader(&b, "gofep_pair_free_energy_kcal_per_mol", "gauge", "Free energy of a finished BAR pair in kcal/mol")
+	for _, pair := range rs.Pairs {
+		if pair.Result == nil {
+			continue
+		}
+		writeMetric(&b, "gofep_pair_free_energy_kcal_per_mol", map[string]string{"pair": pair.Pair, "direction": "forward"}, pair.Result.Forward.Energy)
+		writeMetric(&b, "gofep_pair_free_energy_kcal_per_mol", map[string]string{"pair": pair.Pair, "direction": "backward"}, pair.Result.Backward.Energy)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, b.String())
+}
+
+// Sum free energies of the BAR pairs finished so far, adding errors in quadrature like ReturnResults
+func partialResults(rs *RunState) *Results {
+	results := &Results{}
+	for _, pair := range rs.Pairs {
+		if pair.Result == nil {
+			continue
+		}
+		results.Pairs = append(results.Pairs, *pair.Result)
+		results.Forward.Energy += pair.Result.Forward.Energy
+		results.Forward.Error += math.Pow(pair.Result.Forward.Error, 2)
+		results.Backward.Energy += pair.Result.Backward.Energy
+		results.Backward.Error += math.Pow(pair.Result.Backward.Error, 2)
+	}
+	results.Forward.Error = math.Sqrt(results.Forward.Error)
+	results.Backward.Error = math.Sqrt(results.Backward.Error)
+	return results
+}
+
+// Write HELP and TYPE lines of a metric
+func writeMetricHeader(b *strings.Builder, name string, metricType string, help string) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+// Write one sample of a metric with its labels, sorted by name
+func writeMetric(b *strings.Builder, name string, labels map[string]string, value float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = key + "=" + strconv.Quote(labels[key])
+		}
+		b.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	b.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
@@ -0,0 +1,603 @@
+package fep
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Server: contains a REST server that accepts FEP runs from several users, runs them side by side on one shared pool of
+// nodes through a Scheduler and reports their status and results
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Run is one FEP run submitted to a Server
+type Run struct {
+	ID   string `json:"id"`
+	User string `json:"user"`
+	// Priority orders runs waiting for nodes, higher first
+	Priority int `json:"priority"`
+	// State is one of StateQueued, StateRunning, StateFinished or StateFailed
+	State string `json:"state"`
+	// Directory is the target directory of the run on the server
+	Directory string    `json:"directory"`
+	Submitted time.Time `json:"submitted"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Error     string    `json:"error,omitempty"`
+	// FailedJobs counts jobs that failed over the whole run
+	FailedJobs int `json:"failed_jobs"`
+	// JobsRunning is the number of nodes granted to jobs of the run right now, and GPUHours all GPU time they used
+	JobsRunning int      `json:"jobs_running"`
+	GPUHours    float64  `json:"gpu_hours"`
+	Results     *Results `json:"results,omitempty"`
+
+	settings *Settings
+	status   *StatusServer
+}
+
+// Server accepts runs over HTTP and runs each from setup to results, with every job getting its node from one
+// scheduler. Submitted files and run directories are kept in the runs folder of the server's target directory:
+//
+//	POST /runs                  submit a run as a multipart form with fields "user", "priority" (optional, default 0),
+//	                            "settings" (the settings INI) and "inputs" (the xyz, key and prm files it uses)
+//	GET  /runs                  list all runs
+//	GET  /runs/{id}             get one run
+//	GET  /runs/{id}/status      get the state of its windows, jobs and nodes, as served by StatusServer
+//	GET  /runs/{id}/metrics     get its Prometheus metrics, as served by StatusServer
+//	GET  /runs/{id}/results     get its free energies once finished
+//	GET  /users                 get GPU usage, fair share and cap of every user
+type Server struct {
+	directory   string
+	nodeINIPath string
+	// environment holds the parameters of the server's general block that set up programs on the nodes, which every
+	// run uses in place of its own
+	environment map[string]string
+	// maxPriority is the highest priority a run may be submitted with
+	maxPriority int
+	backend     Backend
+	scheduler   *Scheduler
+	stop        chan struct{}
+
+	mu   sync.Mutex
+	runs []*Run
+}
+
+// NewServer creates a server whose pool of nodes is read from the node INI in the general parameters of settings and
+// shared by the rules of its scheduler parameters, running scripts with backend. Runs submitted to an earlier server
+// in the same target directory are listed again; those it did not finish are marked failed. The scheduler starts
+// right away and stops with Close
+func NewServer(settings *Settings, backend Backend) (*Server, error) {
+	genPrm := &settings.General
+	nodeINIPath, err := filepath.Abs(genPrm.NodeINIPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute absolute path to node INI %s: %w", genPrm.NodeINIPath, err)
+	}
+	pool, err := GetNodeGroup(genPrm)
+	if err != nil {
+		return nil, err
+	}
+	pool.Backend = backend
+
+	s := &Server{
+		directory:   genPrm.TargetDirectory,
+		nodeINIPath: nodeINIPath,
+		environment: map[string]string{"intelSource": genPrm.IntelSource, "cuda8Source": genPrm.Cuda8Source,
+			"cuda10Source": genPrm.Cuda10Source, "cuda8Home": genPrm.Cuda8Home, "cuda10Home": genPrm.Cuda10Home},
+		maxPriority: settings.Scheduler.MaxPriority,
+		backend:     backend,
+		scheduler:   NewScheduler(pool, genPrm.TargetDirectory, schedulerCheckInterval, settings.Scheduler),
+		stop:        make(chan struct{}),
+	}
+	err = s.loadRuns()
+	if err != nil {
+		return nil, err
+	}
+	s.scheduler.Start(s.stop)
+	return s, nil
+}
+
+// Close stops granting nodes to jobs
+func (s *Server) Close() {
+	close(s.stop)
+}
+
+// ServeHTTP routes requests to the runs API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	if path == "users" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, s.scheduler.Usage())
+		return
+	}
+	if parts[0] != serverRunsFolderName {
+		writeJSONError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+		return
+	}
+
+	// List or submit runs
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, s.listRuns())
+		case http.MethodPost:
+			run, err := s.submit(r)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusCreated, s.copyRun(run))
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed on /runs")
+		}
+		return
+	}
+
+	// Get one run
+	run := s.getRun(parts[1])
+	if run == nil {
+		writeJSONError(w, http.StatusNotFound, "no run with id "+parts[1])
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed on "+r.URL.Path)
+		return
+	}
+	copied := s.copyRun(run)
+	if len(parts) == 2 {
+		writeJSON(w, http.StatusOK, copied)
+		return
+	}
+	switch parts[2] {
+	case "status", "metrics":
+		if copied.status == nil {
+			writeJSONError(w, http.StatusNotFound, "status of run "+run.ID+" is only kept by the server that ran it")
+			return
+		}
+		http.StripPrefix("/"+serverRunsFolderName+"/"+run.ID, copied.status).ServeHTTP(w, r)
+	case "results":
+		if copied.Results == nil {
+			writeJSONError(w, http.StatusNotFound, "run "+run.ID+" has no results: it is "+copied.State)
+			return
+		}
+		writeJSON(w, http.StatusOK, copied.Results)
+	default:
+		writeJSONError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+	}
+}
+
+// Save a submitted run and start it
+func (s *Server) submit(r *http.Request) (*Run, error) {
+	err := r.ParseMultipartForm(serverUploadMemory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read submission: %w", err)
+	}
+	// The scheduler shares nodes between users by their usage, so the user of a run is the one running the program
+	// that sent it rather than whichever user the submission names
+	user, err := getRequestUser(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not check which user sent the submission, runs must be submitted from the machine the server runs on: %w", err)
+	}
+	if named := strings.TrimSpace(r.FormValue("user")); named != "" && named != user {
+		return nil, errors.New("submission names user " + named + " but was sent by user " + user)
+	}
+	priority := 0
+	if value := r.FormValue("priority"); value != "" {
+		priority, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("priority of submission must be a whole number")
+		}
+	}
+	if priority > s.maxPriority {
+		return nil, errors.New("priority of submission may be at most " + strconv.Itoa(s.maxPriority) + ", the maxPriority of the server")
+	}
+	settingsFiles := r.MultipartForm.File["settings"]
+	if len(settingsFiles) != 1 {
+		return nil, errors.New("submission must include exactly one settings INI")
+	}
+
+	// Give the run a folder with its inputs and its target directory
+	s.mu.Lock()
+	id, err := s.createRunFolder()
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	runDir := filepath.Join(s.directory, serverRunsFolderName, id)
+	run := &Run{ID: id, User: user, Priority: priority, State: StateQueued, Directory: filepath.Join(runDir, "run"), Submitted: time.Now()}
+	s.runs = append(s.runs, run)
+	s.mu.Unlock()
+
+	settings, err := s.saveSubmission(r, runDir, run.Directory)
+	if err != nil {
+		s.finish(run, nil, err)
+		return nil, err
+	}
+	// Commands would run as the user of the server rather than the user of the run
+	if settings.Hooks.any() || settings.Notify.Command != "" {
+		err = errors.New("runs submitted to a server may not set hooks or a notify command")
+		s.finish(run, nil, err)
+		return nil, err
+	}
+	err = s.backend.CheckEnvironment(&settings.General)
+	if err != nil {
+		s.finish(run, nil, err)
+		return nil, err
+	}
+	s.mu.Lock()
+	run.settings = settings
+	run.status = NewStatusServer(nil)
+	s.mu.Unlock()
+	s.save(run)
+
+	s.scheduler.AddRun(run.ID, run.User, run.Priority)
+	go s.execute(run)
+	return run, nil
+}
+
+// Create the folder of a new run, numbered one past the highest numbered folder in the runs folder so that folders of
+// runs whose records could not be read are never reused, and return the id of the run. Fails rather than writing into
+// a folder that already exists
+func (s *Server) createRunFolder() (string, error) {
+	runsDir := filepath.Join(s.directory, serverRunsFolderName)
+	err := os.MkdirAll(runsDir, octalPermissions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create runs directory %s: %w", runsDir, err)
+	}
+	fileInfo, err := ioutil.ReadDir(runsDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read runs directory %s: %w", runsDir, err)
+	}
+	highest := 0
+	for _, info := range fileInfo {
+		if n, err := strconv.Atoi(info.Name()); err == nil && n > highest {
+			highest = n
+		}
+	}
+	id := fmt.Sprintf("%04d", highest+1)
+	err = os.Mkdir(filepath.Join(runsDir, id), octalPermissions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create run directory %s: %w", filepath.Join(runsDir, id), err)
+	}
+	return id, nil
+}
+
+// Write the files of a submission to runDir and read its settings, pointing them at the uploaded inputs, the target
+// directory made for the run and the server's node INI. The environment of the server replaces that of the
+// submission, as scripts sourcing or running files of the submitter's choosing would run as the user of the server
+func (s *Server) saveSubmission(r *http.Request, runDir string, targetDirectory string) (*Settings, error) {
+	inputsDir := filepath.Join(runDir, "inputs")
+	for _, dir := range []string{inputsDir, targetDirectory} {
+		err := os.MkdirAll(dir, octalPermissions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	// Save inputs under their base names
+	inputs := map[string]string{}
+	for _, header := range r.MultipartForm.File["inputs"] {
+		name := filepath.Base(header.Filename)
+		if _, ok := inputs[name]; ok {
+			return nil, errors.New("two input files named " + name + " were uploaded: give them different names")
+		}
+		inputs[name] = filepath.Join(inputsDir, name)
+		err := saveUpload(header, inputs[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Point settings at the files on the server
+	settingsFile, err := r.MultipartForm.File["settings"][0].Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded settings INI: %w", err)
+	}
+	defer settingsFile.Close()
+	data, err := ioutil.ReadAll(settingsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded settings INI: %w", err)
+	}
+	text, err := setOverridePaths(string(data), inputs)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{"targetDirectory": targetDirectory, "nodeINI": s.nodeINIPath}
+	for key, value := range s.environment {
+		values[key] = value
+	}
+	// Inputs must have been uploaded, as the run could otherwise read any file the user of the server can
+	for _, key := range []string{"xyz", "key", "prm"} {
+		value := getINIValue(string(data), key)
+		path, ok := inputs[filepath.Base(value)]
+		if !ok {
+			return nil, errors.New(key + " file \"" + value + "\" of the settings INI was not uploaded with the submission")
+		}
+		values[key] = path
+	}
+	iniPath := filepath.Join(runDir, "settings.ini")
+	err = writeFile(iniPath, setINIValues(text, values))
+	if err != nil {
+		return nil, err
+	}
+	return GetParams(iniPath)
+}
+
+// Run a submitted run from setup to results
+func (s *Server) execute(run *Run) {
+	s.mu.Lock()
+	run.State = StateRunning
+	run.Started = time.Now()
+	s.mu.Unlock()
+	s.save(run)
+
+	results, err := s.runSettings(run)
+	s.finish(run, results, err)
+}
+
+// Set up, run dynamic and BAR and collect free energies with the settings of run, getting nodes from the scheduler
+func (s *Server) runSettings(run *Run) (*Results, error) {
+	settings := run.settings
+	genPrm := &settings.General
+
+	// Record events in the run journal and in the status served for the run
+	events := NewEmitter()
+	defer events.Close()
+	journal, err := OpenJournal(genPrm.TargetDirectory)
+	if err != nil {
+		return nil, err
+	}
+	defer journal.Close()
+	events.Subscribe(JSONLinesHandler(journal))
+	events.Subscribe(run.status.Apply)
+	notifier := NewNotifier(&settings.Notify, genPrm.TargetDirectory)
+	if notifier.Enabled() {
+		events.Subscribe(notifier.Handle)
+	}
+
+	ng := &NodeGroup{Backend: s.backend, Events: events, Scheduler: s.scheduler, RunID: run.ID, Hooks: &settings.Hooks}
+	err = DynamicSetup(genPrm, &settings.Setup, &settings.Hooks, events)
+	if err != nil {
+		return nil, err
+	}
+	err = BARSetup(genPrm, &settings.Setup, &settings.BAR, events)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := ng.PipelineManager(genPrm, &settings.Setup, settings.Dynamic, &settings.BAR, -1)
+	s.countFailed(run, jobs)
+	if err != nil {
+		return nil, err
+	}
+	return ReturnResults(genPrm, &settings.Hooks, events)
+}
+
+// Add failed jobs to the count of run
+func (s *Server) countFailed(run *Run, jobs []Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.FailedJobs += CountFailed(jobs)
+}
+
+// Record the outcome of run
+func (s *Server) finish(run *Run, results *Results, err error) {
+	s.mu.Lock()
+	run.Finished = time.Now()
+	run.Results = results
+	if err != nil {
+		run.State = StateFailed
+		run.Error = err.Error()
+		fmt.Println("Run " + run.ID + " of " + run.User + " failed: " + run.Error)
+	} else {
+		run.State = StateFinished
+		fmt.Println("Run " + run.ID + " of " + run.User + " finished in " + run.Finished.Sub(run.Started).String())
+	}
+	s.mu.Unlock()
+	s.save(run)
+}
+
+// Get run with id, or nil if there is none
+func (s *Server) getRun(id string) *Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs {
+		if run.ID == id {
+			return run
+		}
+	}
+	return nil
+}
+
+// Get a copy of run safe to read without the lock, with its running jobs and GPU usage filled in
+func (s *Server) copyRun(run *Run) Run {
+	running := s.scheduler.Running()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *run
+	copied.JobsRunning = running[run.ID]
+	if hours := s.scheduler.GPUHours(run.ID); hours > 0 {
+		copied.GPUHours = hours
+	}
+	return copied
+}
+
+// Get copies of all runs
+func (s *Server) listRuns() []Run {
+	s.mu.Lock()
+	runs := make([]*Run, len(s.runs))
+	copy(runs, s.runs)
+	s.mu.Unlock()
+
+	list := make([]Run, len(runs))
+	for i, run := range runs {
+		list[i] = s.copyRun(run)
+	}
+	return list
+}
+
+// Write the record of run to its folder so it outlives the server
+func (s *Server) save(run *Run) {
+	copied := s.copyRun(run)
+	data, err := json.MarshalIndent(copied, "", "  ")
+	if err != nil {
+		fmt.Println("Warning: failed to encode record of run " + run.ID + ": " + err.Error())
+		return
+	}
+	err = writeFile(filepath.Join(s.directory, serverRunsFolderName, run.ID, serverRunFileName), string(data)+"\n")
+	if err != nil {
+		fmt.Println("Warning: failed to save record of run " + run.ID + ": " + err.Error())
+	}
+}
+
+// Read records of runs submitted to earlier servers, marking those left unfinished as failed
+func (s *Server) loadRuns() error {
+	runsDir := filepath.Join(s.directory, serverRunsFolderName)
+	fileInfo, err := ioutil.ReadDir(runsDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read runs directory %s: %w", runsDir, err)
+	}
+	for _, info := range fileInfo {
+		data, err := ioutil.ReadFile(filepath.Join(runsDir, info.Name(), serverRunFileName))
+		if err != nil {
+			continue
+		}
+		run := &Run{}
+		if json.Unmarshal(data, run) != nil {
+			continue
+		}
+		run.JobsRunning = 0
+		if run.State == StateQueued || run.State == StateRunning {
+			run.State = StateFailed
+			run.Error = "server stopped before the run finished"
+		}
+		s.runs = append(s.runs, run)
+	}
+	return nil
+}
+
+// Copy an uploaded file to path
+func saveUpload(header *multipart.FileHeader, path string) error {
+	src, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read uploaded file %s: %w", filepath.Base(path), err)
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Get value of parameter key of the general block in the text of a settings INI, or "" if it is not set
+func getINIValue(text string, key string) string {
+	for _, b := range parseINI(text, &iniReport{}) {
+		if b.blockType == "general" {
+			if values := b.generateParamsMap()[key]; len(values) > 0 {
+				return values[0]
+			}
+		}
+	}
+	return ""
+}
+
+// Set parameters of the general block in the text of a settings INI, replacing the lines of those already set and
+// adding the others at the start of the block
+func setINIValues(text string, values map[string]string) string {
+	lines := strings.Split(text, "\n")
+	var general *block
+	blocks := parseINI(text, &iniReport{})
+	for i := range blocks {
+		if blocks[i].blockType == "general" {
+			general = &blocks[i]
+			break
+		}
+	}
+	if general == nil {
+		return text
+	}
+
+	done := map[string]bool{}
+	for _, p := range general.params {
+		if value, ok := values[p.key]; ok {
+			lines[p.line-1] = "    " + p.key + " " + quoteINIValue(value)
+			// Blank further lines of a list spanning lines
+			for n := p.line; n < p.endLine; n++ {
+				lines[n] = ""
+			}
+			done[p.key] = true
+		}
+	}
+
+	var added []string
+	for key, value := range values {
+		if !done[key] {
+			added = append(added, "    "+key+" "+quoteINIValue(value))
+		}
+	}
+	sort.Strings(added)
+	if len(added) == 0 {
+		return strings.Join(lines, "\n")
+	}
+	lines = append(lines[:general.open], append(added, lines[general.open:]...)...)
+	return strings.Join(lines, "\n")
+}
+
+// Point the windowXYZ and windowPrm lines of the setup block in the text of a settings INI at the uploaded inputs, by
+// their base names. Files that were not uploaded are refused, as the run could otherwise read any file the user of the
+// server can
+func setOverridePaths(text string, inputs map[string]string) (string, error) {
+	lines := strings.Split(text, "\n")
+	for _, b := range parseINI(text, &iniReport{}) {
+		if b.blockType != "setup" {
+			continue
+		}
+		for _, p := range b.params {
+			if (p.key != "windowXYZ" && p.key != "windowPrm") || len(p.values) != 2 {
+				continue
+			}
+			path, ok := inputs[filepath.Base(p.values[1])]
+			if !ok {
+				return "", errors.New(p.key + " file \"" + p.values[1] + "\" of window " + p.values[0] +
+					" in the settings INI was not uploaded with the submission")
+			}
+			lines[p.line-1] = "    " + p.key + " " + quoteINIValue(p.values[0]) + " " + quoteINIValue(path)
+			for n := p.line; n < p.endLine; n++ {
+				lines[n] = ""
+			}
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Write v as indented JSON with status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+// Write an error message as JSON with status code
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
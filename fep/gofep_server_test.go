@@ -0,0 +1,35 @@
+package fep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetOverridePaths(t *testing.T) {
+	text := `[general]
+xyz /home/alice/lig.xyz
+
+[setup]
+vdwLambdas [1.0 0.5 0.0]
+windowXYZ 1 /home/alice/alt.xyz
+windowKey 1 restrain-position 1 2
+windowPrm vdw0.0ele0.0 "/home/alice/my params/alt.prm"
+`
+	inputs := map[string]string{"alt.xyz": "/srv/runs/0001/inputs/alt.xyz", "alt.prm": "/srv/runs/0001/inputs/alt.prm"}
+	got, err := setOverridePaths(text, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(strings.Replace(text, "windowXYZ 1 /home/alice/alt.xyz", "    windowXYZ 1 /srv/runs/0001/inputs/alt.xyz", 1),
+		`windowPrm vdw0.0ele0.0 "/home/alice/my params/alt.prm"`, "    windowPrm vdw0.0ele0.0 /srv/runs/0001/inputs/alt.prm", 1)
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Files that were not uploaded are refused
+	delete(inputs, "alt.prm")
+	_, err = setOverridePaths(text, inputs)
+	if err == nil || !strings.Contains(err.Error(), "was not uploaded") {
+		t.Errorf("got error %v, want refusal of the prm file that was not uploaded", err)
+	}
+}
@@ -0,0 +1,406 @@
+package fep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jgourary/goFEP/xyz"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Validate: contains functions to check the xyz, key and prm files of a run against each other before anything is
+// set up or launched, reporting every problem found at once
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// InputIssue is a problem found in an input file by ValidateInputs
+type InputIssue struct {
+	// Path is the file the issue is in, or "" if it is in the settings INI file
+	Path string
+	// Line is the line of the file the issue is on, from 1, or 0 if it is not on one line
+	Line    int
+	Message string
+	// Warning is set for issues that don't stop goFEP or Tinker from running, but are likely mistakes
+	Warning bool
+}
+
+// String returns the issue as "path:line: message", with "warning: " before the message of a warning
+func (i InputIssue) String() string {
+	s := i.Path
+	if s == "" {
+		s = "INI file"
+	}
+	if i.Line > 0 {
+		s += ":" + strconv.Itoa(i.Line)
+	}
+	s += ": "
+	if i.Warning {
+		s += "warning: "
+	}
+	return s + i.Message
+}
+
+// Collects issues, each once, along with the files read so each is only checked once
+type validator struct {
+	issues []InputIssue
+	seen   map[string]bool
+	frames map[string]*xyz.Frame
+	types  map[string]map[int]bool
+}
+
+// ValidateInputs checks the xyz, key and prm files of the general block, and those of every window of the setup block,
+// against each other: that the xyz file is well formed, with bonds listed by both atoms they join and a valid box,
+// that every atom type it uses is defined, that atoms and groups the key file refers to exist, and that the key file
+// has the ligand and lambda keywords FEP needs. It returns every issue found, errors first, or nil if there are none
+func ValidateInputs(settings *Settings) []InputIssue {
+	v := &validator{seen: make(map[string]bool), frames: make(map[string]*xyz.Frame), types: make(map[string]map[int]bool)}
+	genPrm := &settings.General
+	setupPrm := &settings.Setup
+
+	// Lambda keywords are set by setup, so need not be in the source key file, but are likely missing by mistake
+	source, err := readKeyFile(genPrm.KeyPath)
+	if err != nil {
+		v.add(InputIssue{Path: genPrm.KeyPath, Message: err.Error()})
+		return v.issues
+	}
+	for _, keyword := range []string{"vdw-lambda", "ele-lambda"} {
+		if _, ok := source.get(keyword); !ok {
+			v.add(InputIssue{Path: genPrm.KeyPath, Message: "has no " + keyword + " line, so setup adds one to the key file of each window",
+				Warning: true})
+		}
+	}
+
+	// Without a setup block, check the input files as they are
+	if len(setupPrm.Vdw) == 0 {
+		v.checkWindow("", genPrm.XYZPath, genPrm.KeyPath, genPrm.PrmPath, source, nil, settings.Dynamic)
+		return v.sorted()
+	}
+
+	// Otherwise check each window with the files and key file setup would give it
+	windows, err := GetDynamicFolderNames(setupPrm)
+	if err != nil {
+		v.add(InputIssue{Message: err.Error()})
+		return v.issues
+	}
+	overrides, err := getWindowOverrides(setupPrm, windows)
+	if err != nil {
+		v.add(InputIssue{Message: err.Error()})
+		return v.issues
+	}
+	for i, window := range windows {
+		xyzPath, prmPath := genPrm.XYZPath, genPrm.PrmPath
+		if overrides[i].XYZ != "" {
+			xyzPath = overrides[i].XYZ
+		}
+		if overrides[i].Prm != "" {
+			prmPath = overrides[i].Prm
+		}
+		key, err := getWindowKeyFile(genPrm.KeyPath, window, setupPrm, i, prmPath, overrides[i].KeyLines)
+		if err != nil {
+			v.add(InputIssue{Path: genPrm.KeyPath, Message: err.Error()})
+			continue
+		}
+		v.checkWindow(window, xyzPath, genPrm.KeyPath, prmPath, key, overrides[i].KeyLines, settings.Dynamic)
+	}
+	return v.sorted()
+}
+
+// Add an issue, unless it was found before
+func (v *validator) add(issue InputIssue) {
+	if v.seen[issue.String()] {
+		return
+	}
+	v.seen[issue.String()] = true
+	v.issues = append(v.issues, issue)
+}
+
+// Get the issues found, errors before warnings and otherwise in the order they were found
+func (v *validator) sorted() []InputIssue {
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		return !v.issues[i].Warning && v.issues[j].Warning
+	})
+	return v.issues
+}
+
+// Check the inputs of one window ("" without a setup block): its xyz file, the atom types it uses and its key file,
+// whose lines set by windowKey are keyLines
+func (v *validator) checkWindow(window string, xyzPath string, keyPath string, prmPath string, key *keyFile, keyLines [][]string,
+	dynPrm []DynamicParameters) {
+
+	frame := v.checkXYZ(xyzPath)
+	types := v.checkPrm(prmPath)
+	if frame == nil {
+		return
+	}
+
+	// Atom types may be defined in the key file as well as in the prm file
+	keyTypes := make(map[int]bool)
+	for _, l := range key.lines {
+		if l.is("atom") && len(l.values) > 0 {
+			if t, err := strconv.Atoi(l.values[0]); err == nil {
+				keyTypes[t] = true
+			}
+		}
+	}
+	if types != nil {
+		v.checkTypes(frame, xyzPath, prmPath, types, keyTypes)
+	}
+	v.checkKey(window, frame, keyPath, key, keyLines, types, keyTypes, dynPrm)
+}
+
+// Read the xyz file at xyzPath and check its atoms, bonds and box, returning nil if it can't be read
+func (v *validator) checkXYZ(xyzPath string) *xyz.Frame {
+	if frame, ok := v.frames[xyzPath]; ok {
+		return frame
+	}
+	frame, err := xyz.ReadFile(xyzPath)
+	v.frames[xyzPath] = frame
+	if err != nil {
+		issue := InputIssue{Path: xyzPath, Message: err.Error()}
+		var xyzErr *xyz.Error
+		if errors.As(err, &xyzErr) {
+			issue.Line = xyzErr.Line
+			issue.Message = xyzErr.Err.Error()
+		}
+		v.add(issue)
+		return nil
+	}
+
+	// Lines of atoms follow the first line and the box line, if any
+	firstAtomLine := 2
+	if frame.Box != nil {
+		firstAtomLine = 3
+		box := frame.Box
+		if box.A <= 0 || box.B <= 0 || box.C <= 0 {
+			v.add(InputIssue{Path: xyzPath, Line: 2, Message: "box lengths must be positive"})
+		}
+		for _, angle := range []float64{box.Alpha, box.Beta, box.Gamma} {
+			if angle <= 0 || angle >= 180 {
+				v.add(InputIssue{Path: xyzPath, Line: 2, Message: "box angles must be between 0 and 180 degrees"})
+				break
+			}
+		}
+	}
+
+	// Atom numbers must be unique for bonds to be meaningful, and Tinker renumbers atoms not numbered in order
+	index := make(map[int]int)
+	renumbered := false
+	for i, atom := range frame.Atoms {
+		if j, ok := index[atom.Number]; ok {
+			v.add(InputIssue{Path: xyzPath, Line: firstAtomLine + i, Message: "atom number " + strconv.Itoa(atom.Number) +
+				" is also used on line " + strconv.Itoa(firstAtomLine+j)})
+			continue
+		}
+		index[atom.Number] = i
+		if atom.Number != i+1 && !renumbered {
+			renumbered = true
+			v.add(InputIssue{Path: xyzPath, Line: firstAtomLine + i, Message: "atoms are not numbered from 1 in order, so Tinker " +
+				"renumbers them and atom numbers in the key file refer to their position instead", Warning: true})
+		}
+	}
+
+	// Every bond must join two different atoms, each listing the other
+	for i, atom := range frame.Atoms {
+		for _, bond := range atom.Bonds {
+			j, ok := index[bond]
+			switch {
+			case !ok:
+				v.add(InputIssue{Path: xyzPath, Line: firstAtomLine + i, Message: "atom " + strconv.Itoa(atom.Number) +
+					" is bonded to atom " + strconv.Itoa(bond) + ", which does not exist"})
+			case bond == atom.Number:
+				v.add(InputIssue{Path: xyzPath, Line: firstAtomLine + i, Message: "atom " + strconv.Itoa(atom.Number) + " is bonded to itself"})
+			case !containsInt(frame.Atoms[j].Bonds, atom.Number):
+				v.add(InputIssue{Path: xyzPath, Line: firstAtomLine + i, Message: "atom " + strconv.Itoa(atom.Number) + " is bonded to atom " +
+					strconv.Itoa(bond) + ", but atom " + strconv.Itoa(bond) + " is not bonded to it"})
+			}
+		}
+	}
+	return frame
+}
+
+// Read the atom types defined in the prm file at prmPath, returning nil if it can't be read
+func (v *validator) checkPrm(prmPath string) map[int]bool {
+	if types, ok := v.types[prmPath]; ok {
+		return types
+	}
+	v.types[prmPath] = nil
+	file, err := os.Open(prmPath)
+	if err != nil {
+		v.add(InputIssue{Path: prmPath, Message: fmt.Errorf("failed to open prm file: %w", err).Error()})
+		return nil
+	}
+	defer file.Close()
+
+	// Atom types are defined on lines such as: atom 1 1 O "Water O" 8 15.995 2
+	types := make(map[int]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		tokens := strings.Fields(scanner.Text())
+		if len(tokens) > 1 && strings.EqualFold(tokens[0], "atom") {
+			if t, err := strconv.Atoi(tokens[1]); err == nil {
+				types[t] = true
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		v.add(InputIssue{Path: prmPath, Message: fmt.Errorf("failed to read prm file: %w", err).Error()})
+		return nil
+	}
+	if len(types) == 0 {
+		v.add(InputIssue{Path: prmPath, Message: "defines no atom types, so is likely not a Tinker prm file"})
+		return nil
+	}
+	v.types[prmPath] = types
+	return types
+}
+
+// Check that every atom type used in the xyz file is defined in the prm or key file, reporting each missing type once
+func (v *validator) checkTypes(frame *xyz.Frame, xyzPath string, prmPath string, types map[int]bool, keyTypes map[int]bool) {
+	firstAtomLine := 2
+	if frame.Box != nil {
+		firstAtomLine = 3
+	}
+	missing := make(map[int][]int)
+	var order []int
+	for i, atom := range frame.Atoms {
+		if types[atom.Type] || keyTypes[atom.Type] {
+			continue
+		}
+		if _, ok := missing[atom.Type]; !ok {
+			order = append(order, atom.Type)
+		}
+		missing[atom.Type] = append(missing[atom.Type], i)
+	}
+	for _, t := range order {
+		i := missing[t][0]
+		message := "atom type " + strconv.Itoa(t) + " of atom " + strconv.Itoa(frame.Atoms[i].Number)
+		if len(missing[t]) > 1 {
+			message += " (and " + strconv.Itoa(len(missing[t])-1) + " other atom(s))"
+		}
+		v.add(InputIssue{Path: xyzPath, Line: firstAtomLine + i, Message: message + " is not defined in prm file " + prmPath})
+	}
+}
+
+// Check that the atoms, atom types and groups the key file of a window refers to exist, that it marks ligand atoms for
+// the lambdas to act on, and that a periodic box is given for ensembles that change the volume
+func (v *validator) checkKey(window string, frame *xyz.Frame, keyPath string, key *keyFile, keyLines [][]string,
+	types map[int]bool, keyTypes map[int]bool, dynPrm []DynamicParameters) {
+
+	// Get where a line comes from: the source key file, or a windowKey line of the setup block
+	issue := func(l keyLine, message string) InputIssue {
+		for _, keyLine := range keyLines {
+			if l.edited && l.is(keyLine[0]) && strings.Join(l.values, " ") == strings.Join(keyLine[1:], " ") {
+				return InputIssue{Message: "windowKey \"" + strings.Join(keyLine, " ") + "\" of window " + window + ": " + message}
+			}
+		}
+		return InputIssue{Path: keyPath, Line: l.line, Message: message}
+	}
+	checkAtoms := func(l keyLine, values []string) {
+		atoms, err := parseAtomList(values)
+		if err != nil {
+			v.add(issue(l, err.Error()))
+			return
+		}
+		for _, atom := range atoms {
+			if atom < 1 || atom > len(frame.Atoms) {
+				v.add(issue(l, l.keyword+" refers to atom "+strconv.Itoa(atom)+", but the xyz file has "+strconv.Itoa(len(frame.Atoms))+" atoms"))
+				return
+			}
+		}
+	}
+
+	mutated := false
+	groups := make(map[int]bool)
+	for _, l := range key.lines {
+		switch {
+		case l.is("ligand"):
+			mutated = true
+			checkAtoms(l, l.values)
+		case l.is("mutate"):
+			// mutate <atom> <type at lambda 0> <type at lambda 1>
+			mutated = true
+			if len(l.values) < 3 {
+				v.add(issue(l, "mutate must give an atom and its atom types at lambda 0 and 1"))
+				continue
+			}
+			checkAtoms(l, l.values[:1])
+			for _, value := range l.values[1:3] {
+				t, err := strconv.Atoi(value)
+				if err != nil || (types != nil && !types[t] && !keyTypes[t]) {
+					v.add(issue(l, "mutate refers to atom type "+value+", which is not defined"))
+				}
+			}
+		case l.is("group"):
+			// group <number> <atoms>
+			if len(l.values) < 2 {
+				v.add(issue(l, "group must give its number and its atoms"))
+				continue
+			}
+			g, err := strconv.Atoi(l.values[0])
+			if err != nil || g < 1 {
+				v.add(issue(l, "group number "+l.values[0]+" must be a positive integer"))
+				continue
+			}
+			groups[g] = true
+			checkAtoms(l, l.values[1:])
+		}
+	}
+	if !mutated {
+		v.add(InputIssue{Path: keyPath, Message: "has no ligand or mutate line, so the lambdas of the setup block change nothing"})
+	}
+
+	// restrain-groups <group> <group> <force> [distances] refers to groups defined above
+	for _, l := range key.lines {
+		if !l.is("restrain-groups") {
+			continue
+		}
+		if len(l.values) < 3 {
+			v.add(issue(l, "restrain-groups must give two groups and a force constant"))
+			continue
+		}
+		for _, value := range l.values[:2] {
+			if g, err := strconv.Atoi(value); err != nil || !groups[g] {
+				v.add(issue(l, "restrain-groups refers to group "+value+", which no group line defines"))
+			}
+		}
+	}
+
+	// Ensembles 3 (NPH) and 4 (NPT) change the volume, so need a periodic box from the xyz or key file
+	if _, ok := key.get("a-axis"); frame.Box == nil && !ok {
+		for _, prm := range dynPrm {
+			if prm.Ensemble == "3" || prm.Ensemble == "4" {
+				v.add(InputIssue{Path: keyPath, Message: "dynamic block " + prm.Name + " uses ensemble " + prm.Ensemble +
+					", which needs a periodic box, but neither the xyz file nor the key file (a-axis) gives one"})
+			}
+		}
+	}
+}
+
+// Parse a list of atoms as Tinker reads them: numbers, where a negative number starts a range ending at the next one
+func parseAtomList(values []string) ([]int, error) {
+	var atoms []int
+	for i := 0; i < len(values); i++ {
+		atom, err := strconv.Atoi(values[i])
+		if err != nil {
+			return nil, errors.New("atom " + values[i] + " is not an integer")
+		}
+		if atom >= 0 {
+			atoms = append(atoms, atom)
+			continue
+		}
+		if i+1 == len(values) {
+			return nil, errors.New("range of atoms starting at " + values[i] + " has no end")
+		}
+		end, err := strconv.Atoi(values[i+1])
+		if err != nil || end < -atom {
+			return nil, errors.New("range of atoms from " + strconv.Itoa(-atom) + " to " + values[i+1] + " is invalid")
+		}
+		atoms = append(atoms, -atom, end)
+		i++
+	}
+	return atoms, nil
+}
@@ -0,0 +1,242 @@
+package fep
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Window: contains functions to name dynamic windows after their lambdas and describe them in a manifest
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// WindowManifest describes a dynamic window. Setup writes it to window.json in the window's folder
+type WindowManifest struct {
+	Name string `json:"name"`
+	// Index is the position of the window along the lambda path of the setup block, from 0
+	Index int    `json:"index"`
+	Vdw   string `json:"vdw"`
+	Ele   string `json:"ele"`
+	// Restraint is only set if the setup block sets restraints
+	Restraint string `json:"restraint,omitempty"`
+	// Input files the window was set up from
+	XYZ InputFile `json:"xyz"`
+	Key InputFile `json:"key"`
+	Prm InputFile `json:"prm"`
+	// KeyLines are the lines the setup block sets in the key file of this window only
+	KeyLines []string `json:"keyLines,omitempty"`
+	// SeededFrom is set if the window starts from the last frame of block SeedBlock of that window, rather than XYZ
+	SeededFrom string `json:"seededFrom,omitempty"`
+	SeedBlock  string `json:"seedBlock,omitempty"`
+}
+
+// InputFile is an input file a window was set up from, with its checksum at the time
+type InputFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// ReadWindowManifest reads the manifest of the window in subDir
+func ReadWindowManifest(subDir string) (*WindowManifest, error) {
+	path := filepath.Join(subDir, windowManifestFileName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read window manifest %s: %w", path, err)
+	}
+	m := &WindowManifest{}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse window manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Get name of the window with lambdas vdw and ele and restraint rst, which may be "". Lambdas are written in full, so
+// windows with different lambdas never share a name
+func getWindowName(vdw string, ele string, rst string) (string, error) {
+	vdwName, err := canonicalLambda(vdw)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert vdwLambdas string \"%s\" to float: %w", vdw, err)
+	}
+	eleName, err := canonicalLambda(ele)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert eleLambdas string \"%s\" to float: %w", ele, err)
+	}
+	name := "vdw" + vdwName + "ele" + eleName
+	if rst != "" {
+		rstName, err := canonicalLambda(rst)
+		if err != nil {
+			return "", fmt.Errorf("failed to convert restraints string \"%s\" to float: %w", rst, err)
+		}
+		name += "rst" + rstName
+	}
+	return name, nil
+}
+
+// Write the number in s the same way whatever way it was written, e.g. 0.50 and .5 both as 0.5 and 1 as 1.0
+func canonicalLambda(s string) (string, error) {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", err
+	}
+	canonical := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.Contains(canonical, ".") {
+		canonical += ".0"
+	}
+	return canonical, nil
+}
+
+// Write the manifest of every window in dynamicFolders, set up from the setup parameters and input files in genPrm,
+// or those of its override
+func createWindowManifests(directory string, dynamicFolders []string, prm *SetupParameters, genPrm *GeneralParameters, overrides []WindowOverride) error {
+
+	// Get input files, most of which are the same for every window
+	inputs := make(map[string]InputFile)
+	getInput := func(path string) (InputFile, error) {
+		if input, ok := inputs[path]; ok {
+			return input, nil
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return InputFile{}, fmt.Errorf("could not compute absolute path to input file %s: %w", path, err)
+		}
+		checksum, err := fileChecksum(absPath)
+		if err != nil {
+			return InputFile{}, err
+		}
+		inputs[path] = InputFile{Path: absPath, SHA256: checksum}
+		return inputs[path], nil
+	}
+
+	for i, folder := range dynamicFolders {
+		m := WindowManifest{Name: folder, Index: i}
+		paths := []string{genPrm.XYZPath, genPrm.KeyPath, genPrm.PrmPath}
+		if overrides[i].XYZ != "" {
+			paths[0] = overrides[i].XYZ
+		}
+		if overrides[i].Prm != "" {
+			paths[2] = overrides[i].Prm
+		}
+		for j, input := range []*InputFile{&m.XYZ, &m.Key, &m.Prm} {
+			var err error
+			*input, err = getInput(paths[j])
+			if err != nil {
+				return err
+			}
+		}
+		for _, line := range overrides[i].KeyLines {
+			m.KeyLines = append(m.KeyLines, strings.Join(line, " "))
+		}
+		if isSeeded(prm, overrides, i) {
+			m.SeededFrom = dynamicFolders[i-1]
+			m.SeedBlock = prm.SeedBlock
+		}
+		m.Vdw, _ = canonicalLambda(prm.Vdw[i])
+		m.Ele, _ = canonicalLambda(prm.Ele[i])
+		if len(prm.Rst) > 0 {
+			m.Restraint, _ = canonicalLambda(prm.Rst[i])
+		}
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = writeFile(filepath.Join(directory, "dynamic", folder, windowManifestFileName), string(data)+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename folders in the dynamic directory set up by versions of goFEP that named windows after lambdas rounded to
+// percent (e.g. vdw050ele000) to the lossless name of the window with the same lambdas in their key file, if it is
+// among dynamicFolders. Steps recorded in the build state move with them, so finished dynamic is not run again
+func renameLegacyWindows(directory string, dynamicFolders []string, keyName string, withRestraints bool) error {
+	dynDirectory := filepath.Join(directory, "dynamic")
+	fileInfo, err := ioutil.ReadDir(dynDirectory)
+	if err != nil {
+		// nothing to rename the first time
+		return nil
+	}
+	var build *buildState
+	for _, info := range fileInfo {
+		oldDir := filepath.Join(dynDirectory, info.Name())
+		if !info.IsDir() || contains(dynamicFolders, info.Name()) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(oldDir, windowManifestFileName)); err == nil {
+			continue
+		}
+
+		// Get lossless name from lambdas in key file
+		vdw, ele, rst, err := getKeyLambdas(filepath.Join(oldDir, keyName))
+		if err != nil || vdw == "" || ele == "" || (withRestraints && rst == "") {
+			continue
+		}
+		if !withRestraints {
+			rst = ""
+		}
+		name, err := getWindowName(vdw, ele, rst)
+		if err != nil || !contains(dynamicFolders, name) {
+			continue
+		}
+		newDir := filepath.Join(dynDirectory, name)
+		if _, err := os.Stat(newDir); err == nil {
+			continue
+		}
+
+		fmt.Println("Renaming window " + info.Name() + " set up by an older version of goFEP to " + name)
+		if build == nil {
+			build, err = loadBuildState(directory)
+			if err != nil {
+				return err
+			}
+		}
+		err = os.Rename(oldDir, newDir)
+		if err != nil {
+			return fmt.Errorf("failed to rename window %s to %s: %w", oldDir, newDir, err)
+		}
+		err = build.renameWindow(info.Name(), name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the vdw and ele lambdas and the restraint force of the restrain-groups line set in a key file, each "" if not set
+func getKeyLambdas(keyPath string) (string, string, string, error) {
+	key, err := readKeyFile(keyPath)
+	if err != nil {
+		return "", "", "", err
+	}
+	var vdw, ele, rst string
+	if values, ok := key.get("vdw-lambda"); ok && len(values) > 0 {
+		vdw = values[0]
+	}
+	if values, ok := key.get("ele-lambda"); ok && len(values) > 0 {
+		ele = values[0]
+	}
+	if values, ok := key.get("restrain-groups"); ok && len(values) > 2 {
+		rst = values[2]
+	}
+	return vdw, ele, rst, nil
+}
+
+// Check that no two windows share a folder name, which would only happen if they have the same lambdas
+func checkWindowNames(dynamicFolders []string) error {
+	seen := make(map[string]int)
+	for i, folder := range dynamicFolders {
+		if j, ok := seen[folder]; ok {
+			return errors.New("windows " + strconv.Itoa(j+1) + " and " + strconv.Itoa(i+1) + " of the setup block have the same " +
+				"lambdas and would share the folder " + folder + ". Please remove one of them")
+		}
+		seen[folder] = i
+	}
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/jgourary/goFEP
+
+go 1.13
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jgourary/goFEP/fep"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Daemon: contains functions to run goFEP in the background and to check on it from a later shell
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Remove a flag (e.g. "--detach") from the argument list, reporting whether it was present
+func popFlag(args []string, flag string) ([]string, bool) {
+	found := false
+	remaining := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == flag {
+			found = true
+		} else {
+			remaining = append(remaining, arg)
+		}
+	}
+	return remaining, found
+}
+
+// Remove a flag that takes a value (e.g. "--events path" or "--events=path") from the argument list, returning its
+// value, or "" if the flag was not present
+func popFlagValue(args []string, flag string) ([]string, string) {
+	value := ""
+	remaining := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == flag && i+1 < len(args) {
+			value = args[i+1]
+			i++
+		} else if strings.HasPrefix(args[i], flag+"=") {
+			value = strings.TrimPrefix(args[i], flag+"=")
+		} else {
+			remaining = append(remaining, args[i])
+		}
+	}
+	return remaining, value
+}
+
+// Relaunch the current call as a background process in its own session, writing all output to a timestamped log file
+// in the target directory and recording its PID in a PID file next to it. flags are passed on to the background process
+func detachProcess(genPrm *fep.GeneralParameters, iniPath string, args []string, flags []string) {
+
+	// Refuse to start a second background run in the same directory
+	info, err := readPIDFile(genPrm.TargetDirectory)
+	if err == nil && isDaemonRunning(info) {
+		err = errors.New("a background goFEP run (PID " + strconv.Itoa(info.pid) + ") is already active in " + genPrm.TargetDirectory +
+			". Use \"status\" or \"attach\" to follow it")
+		log.Fatal(err)
+	}
+
+	// Get path to the binary currently running so the background process runs the same version
+	exePath, err := os.Executable()
+	if err != nil {
+		fmt.Println("Failed to determine path to goFEP binary")
+		log.Fatal(err)
+	}
+
+	// Create log file to capture output
+	start := time.Now()
+	logPath := filepath.Join(genPrm.TargetDirectory, daemonLogPrefix+start.Format("20060102_150405")+".log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, octalPermissions)
+	if err != nil {
+		fmt.Println("Failed to create log file: " + logPath)
+		log.Fatal(err)
+	}
+	defer logFile.Close()
+
+	// Use absolute path to INI so background process does not depend on the working directory
+	childArgs := append(append([]string{iniPath}, args[2:]...), flags...)
+	command := "gofep " + strings.Join(childArgs, " ")
+	_, err = logFile.WriteString("goFEP started in background at " + start.Format(time.RFC1123) + ": " + command + "\n")
+	if err != nil {
+		fmt.Println("Failed to write to log file: " + logPath)
+		log.Fatal(err)
+	}
+
+	// Launch process in a new session so it does not die with the terminal. It supervises the run, removing the PID
+	// file once the run exits
+	cmd := exec.Command(exePath, childArgs...)
+	cmd.Dir = genPrm.TargetDirectory
+	cmd.Env = append(os.Environ(), daemonSuperviseEnv+"=1")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	if err != nil {
+		fmt.Println("Failed to launch goFEP in background")
+		log.Fatal(err)
+	}
+
+	// Record PID and log location so later calls to status and attach can find them
+	pid := cmd.Process.Pid
+	err = writePIDFile(genPrm.TargetDirectory, daemonInfo{pid: pid, logPath: logPath, started: start, command: command,
+		identity: getProcessIdentity(pid)})
+	if err != nil {
+		fmt.Println("Failed to write PID file to " + genPrm.TargetDirectory)
+		log.Fatal(err)
+	}
+	err = cmd.Process.Release()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("\ngoFEP is now running in the background with PID " + strconv.Itoa(pid))
+	fmt.Println("Output is being written to: " + logPath)
+	fmt.Println("Check on it with \"gofep " + iniPath + " status\" or follow it with \"gofep " + iniPath + " attach\"")
+	fmt.Println()
+}
+
+// Run the call made by detachProcess as a child process and wait for it to finish, then remove the PID file of the run
+// from the target directory, which detachProcess made the working directory, and exit as the child did. Every way the
+// run can end, log.Fatal included, leaves no PID file behind
+func superviseDetached() {
+	exePath, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	targetDirectory, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var env []string
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, daemonSuperviseEnv+"=") {
+			env = append(env, variable)
+		}
+	}
+
+	// The run is stopped along with the supervisor, whose PID is the one in the PID file
+	cmd := exec.Command(exePath, os.Args[1:]...)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	err = cmd.Run()
+
+	// Remove PID file, unless it has since been replaced by another run
+	info, readErr := readPIDFile(targetDirectory)
+	if readErr == nil && info.pid == os.Getpid() {
+		os.Remove(filepath.Join(targetDirectory, daemonPIDFileName))
+	}
+	fmt.Println("goFEP background run finished at " + time.Now().Format(time.RFC1123))
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	} else if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Print whether the background run in the target directory is still active, followed by the end of its log. Once the
+// run has finished, the log of the latest background run is printed instead
+func printDaemonStatus(genPrm *fep.GeneralParameters) {
+	info, err := readPIDFile(genPrm.TargetDirectory)
+	state := "running"
+	if err != nil || !isDaemonRunning(info) {
+		logPath := latestDaemonLog(genPrm.TargetDirectory)
+		if logPath == "" {
+			fmt.Println("\nNo background goFEP run found in " + genPrm.TargetDirectory)
+			fmt.Println()
+			return
+		}
+		if err != nil || info.logPath != logPath {
+			info = daemonInfo{logPath: logPath}
+		}
+		state = "finished"
+	}
+
+	fmt.Println()
+	if info.pid > 0 {
+		fmt.Println("PID:     " + strconv.Itoa(info.pid))
+	}
+	fmt.Println("State:   " + state)
+	if !info.started.IsZero() {
+		fmt.Println("Started: " + info.started.Format(time.RFC1123) + " (" + time.Since(info.started).Round(time.Second).String() + " ago)")
+		fmt.Println("Command: " + info.command)
+	}
+	fmt.Println("Log:     " + info.logPath)
+	fmt.Println()
+
+	// Show the most recent output
+	lines, err := tailLines(info.logPath, 15)
+	if err != nil {
+		fmt.Println("Failed to read log file: " + info.logPath)
+		log.Fatal(err)
+	}
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
+
+// Follow the log of the background run until the run finishes. Interrupting attach does not affect the run since it
+// lives in its own session
+func attachDaemon(genPrm *fep.GeneralParameters) {
+	info, err := readPIDFile(genPrm.TargetDirectory)
+	if err != nil || !isDaemonRunning(info) {
+		fmt.Println("\nNo background goFEP run active in " + genPrm.TargetDirectory + ". Use \"status\" to see the log of the last one")
+		fmt.Println()
+		return
+	}
+
+	logFile, err := os.Open(info.logPath)
+	if err != nil {
+		fmt.Println("Failed to open log file: " + info.logPath)
+		log.Fatal(err)
+	}
+	defer logFile.Close()
+
+	fmt.Println("\nAttached to goFEP run with PID " + strconv.Itoa(info.pid) + " (Ctrl-C to detach)\n")
+
+	// Copy new output to the terminal as it is written, checking whether the run is still alive between reads
+	for {
+		running := isDaemonRunning(info)
+		_, err = io.Copy(os.Stdout, logFile)
+		if err != nil {
+			fmt.Println("Failed to read log file: " + info.logPath)
+			log.Fatal(err)
+		}
+		if !running {
+			fmt.Println("\nBackground goFEP run with PID " + strconv.Itoa(info.pid) + " has finished")
+			fmt.Println()
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Helper functions
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Contents of the PID file left in the target directory by a background run. identity tells the process apart from
+// later processes given the same PID
+type daemonInfo struct {
+	pid      int
+	logPath  string
+	started  time.Time
+	command  string
+	identity string
+}
+
+// Write PID file describing a background run to directory
+func writePIDFile(directory string, info daemonInfo) error {
+	pidPath := filepath.Join(directory, daemonPIDFileName)
+	contents := "pid " + strconv.Itoa(info.pid) + "\n" +
+		"log " + info.logPath + "\n" +
+		"started " + info.started.Format(time.RFC3339) + "\n" +
+		"command " + info.command + "\n"
+	if info.identity != "" {
+		contents += "identity " + info.identity + "\n"
+	}
+	return ioutil.WriteFile(pidPath, []byte(contents), octalPermissions)
+}
+
+// Read PID file describing a background run from directory
+func readPIDFile(directory string) (daemonInfo, error) {
+	var info daemonInfo
+	pidPath := filepath.Join(directory, daemonPIDFileName)
+	file, err := os.Open(pidPath)
+	if err != nil {
+		return info, err
+	}
+	defer file.Close()
+
+	// Each line is a key followed by its value
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		tokens := strings.SplitN(scanner.Text(), " ", 2)
+		if len(tokens) < 2 {
+			continue
+		}
+		switch tokens[0] {
+		case "pid":
+			info.pid, err = strconv.Atoi(tokens[1])
+			if err != nil {
+				return info, errors.New("invalid pid \"" + tokens[1] + "\" in PID file " + pidPath)
+			}
+		case "log":
+			info.logPath = tokens[1]
+		case "started":
+			info.started, _ = time.Parse(time.RFC3339, tokens[1])
+		case "command":
+			info.command = tokens[1]
+		case "identity":
+			info.identity = tokens[1]
+		}
+	}
+	if info.pid == 0 {
+		return info, errors.New("no pid found in PID file " + pidPath)
+	}
+	return info, scanner.Err()
+}
+
+// Check whether a process with the given PID is alive
+func isProcessRunning(pid int) bool {
+	// Signal 0 performs error checking only - EPERM means the process exists but belongs to someone else
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// Check whether the background run described by a PID file is alive: its PID must be alive and, if the PID file
+// records the identity of the process, still belong to the same process rather than one started later, after a reboot
+// or once the PID was reused
+func isDaemonRunning(info daemonInfo) bool {
+	if !isProcessRunning(info.pid) {
+		return false
+	}
+	return info.identity == "" || getProcessIdentity(info.pid) == info.identity
+}
+
+// Get a string identifying the process with the given PID across PID reuse and reboots: the boot it was started in and
+// its start time in clock ticks since then, as given by /proc. Returns "" if /proc can't tell
+func getProcessIdentity(pid int) string {
+	bootID, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return ""
+	}
+	// Fields after the name of the program, which is in parentheses and may hold spaces, start with the state
+	// (field 3), so the start time (field 22) is the 20th of them
+	end := strings.LastIndex(string(stat), ")")
+	if end < 0 {
+		return ""
+	}
+	fields := strings.Fields(string(stat)[end+1:])
+	if len(fields) < 20 {
+		return ""
+	}
+	return strings.TrimSpace(string(bootID)) + "/" + fields[19]
+}
+
+// Get the path to the log of the latest background run in directory, or "" if there is none
+func latestDaemonLog(directory string) string {
+	logPaths, err := filepath.Glob(filepath.Join(directory, daemonLogPrefix+"*.log"))
+	if err != nil || len(logPaths) == 0 {
+		return ""
+	}
+	// Log names hold their start time, so they sort in the order the runs started
+	sort.Strings(logPaths)
+	return logPaths[len(logPaths)-1]
+}
+
+// Return up to the last n lines of a file
+func tailLines(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -5,10 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/jgourary/goFEP/fep"
 )
 
 const goFEPversion string = "1.1"
@@ -17,17 +22,32 @@ const goFEPArch string = "amd64"
 const goFEPcompileDate string = "February 26, 2020"
 const octalPermissions os.FileMode = 0777
 
-// gofep_results.go constants
-const resultFileName string = "bar2.log"
-const finalResultFileName string = "results.txt"
-const nodeCheckScriptName string = "run_nvidia_smi.sh"
+// gofep_daemon.go constants
+const daemonPIDFileName string = "gofep.pid"
+const daemonLogPrefix string = "gofep_"
+const daemonSuperviseEnv string = "GOFEP_SUPERVISE"
+
+// gofep_watch.go constants
+const watchRefreshInterval time.Duration = time.Second
+const defaultServerAddress string = "127.0.0.1:8765"
 
 // Main function - entry point for command line interface
 func main() {
 	var err error
 
-	// Get cmd line arguments without program name
-	args := os.Args
+	// A background run started with --detach is run and cleaned up after by a supervising process
+	if os.Getenv(daemonSuperviseEnv) != "" {
+		superviseDetached()
+		return
+	}
+
+	// Get cmd line arguments, separating out any flags
+	args, detach := popFlag(os.Args, "--detach")
+	args, dryRun := popFlag(args, "--dry-run")
+	args, simulate := popFlag(args, "--simulate")
+	args, eventsPath := popFlagValue(args, "--events")
+	args, serveAddr := popFlagValue(args, "--serve")
+	args, priority := popFlagValue(args, "--priority")
 	argsLen := len(args)
 
 	switch argsLen {
@@ -47,55 +67,196 @@ func main() {
 			fmt.Println("Failed to compute absolute path to INI file at " + iniPath)
 			log.Fatal(err)
 		}
-		// Get parameter sets from ini file
-		genPrm, setupPrm, dynPrm, barPrm := getParams(iniPath)
+		// Resolve path of file to write progress events to, if requested
+		if eventsPath != "" {
+			eventsPath, err = filepath.Abs(eventsPath)
+			if err != nil {
+				fmt.Println("Failed to compute absolute path to events file at " + eventsPath)
+				log.Fatal(err)
+			}
+		}
+
+		// Get parameter sets from ini file, of which a server only needs the general block
+		getParams := fep.GetParams
+		if args[2] == "server" {
+			getParams = fep.GetServerParams
+		}
+		settings, err := getParams(iniPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, warning := range settings.Warnings {
+			fmt.Println(warning)
+		}
+		genPrm := &settings.General
+
+		// Submitting sends the settings to a server, so nothing is needed in the target directory here
+		if args[2] == "submit" {
+			serverAddr := defaultServerAddress
+			if argsLen > 3 {
+				serverAddr = args[3]
+			}
+			err = submitRun(settings, iniPath, serverAddr, getUserName(), priority)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
 		// Set application working directory to target directory (relevant for interpreting relative paths in genPrm)
-		err := os.Chdir(genPrm.targetDirectory)
+		err = os.Chdir(genPrm.TargetDirectory)
 		if err != nil {
-			fmt.Println("Failed to move working directory to: " + genPrm.targetDirectory)
+			fmt.Println("Failed to move working directory to: " + genPrm.TargetDirectory)
 			log.Fatal(err)
 		}
 
+		// Choose how scripts are run: on the cluster, or faked locally
+		var backend fep.Backend = fep.ShellBackend{}
+		if simulate {
+			backend = fep.NewSimulatedBackend()
+		}
+
+		// Check files needed on cluster nodes before doing anything that runs on them
+		if args[2] == "dynamic" || args[2] == "bar" || args[2] == "auto" || args[2] == "server" {
+			err = backend.CheckEnvironment(genPrm)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// If requested, relaunch this call as a background process with the same flags and return immediately
+		if detach {
+			var flags []string
+			if dryRun {
+				flags = append(flags, "--dry-run")
+			}
+			if simulate {
+				flags = append(flags, "--simulate")
+			}
+			if eventsPath != "" {
+				flags = append(flags, "--events", eventsPath)
+			}
+			if serveAddr != "" {
+				flags = append(flags, "--serve", serveAddr)
+			}
+			detachProcess(genPrm, iniPath, args, flags)
+			return
+		}
+
+		// Record progress events of tasks that run something in the run journal, and in the events file if requested
+		var events *fep.Emitter
+		if !dryRun && (args[2] == "setup" || args[2] == "dynamic" || args[2] == "bar" || args[2] == "auto") {
+			events = openEvents(genPrm.TargetDirectory, eventsPath, &settings.Notify)
+			if serveAddr != "" {
+				serveStatus(genPrm.TargetDirectory, serveAddr, events)
+			}
+		}
+
 		// initialize vars
 		var numNodes int
 
 		// Args[2] = call
 		switch args[2] {
 
+		case "status":
+			// report on background run, if any
+			printDaemonStatus(genPrm)
+
+		case "attach":
+			// follow output of background run
+			attachDaemon(genPrm)
+
+		case "watch":
+			// show dashboard of run
+			watchRun(genPrm)
+
+		case "notify":
+			// send a test notification in every way set in the notify block
+			notifier := fep.NewNotifier(&settings.Notify, genPrm.TargetDirectory)
+			if !notifier.Enabled() {
+				log.Fatal("no webhook, email or command set in a \"notify\" block of " + iniPath)
+			}
+			err = notifier.Send(fep.Notification{Subject: "goFEP: test notification",
+				Text: "This is a test notification for the run in " + genPrm.TargetDirectory})
+			if err != nil {
+				log.Fatal("Failed to send test notification: " + err.Error())
+			}
+			fmt.Println("Sent test notification")
+
+		case "server":
+			// accept runs from all users and share the nodes in the node INI between them
+			serverAddr := defaultServerAddress
+			if argsLen > 3 {
+				serverAddr = args[3]
+			}
+			srv, err := fep.NewServer(settings, backend)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println("goFEP server listening on " + serverAddr + ", keeping runs in " + filepath.Join(genPrm.TargetDirectory, "runs"))
+			log.Fatal(http.ListenAndServe(serverAddr, srv))
+
+		case "validate":
+			// check input files against each other before anything is set up or run
+			issues := fep.ValidateInputs(settings)
+			numErrors := 0
+			for _, issue := range issues {
+				fmt.Println(issue)
+				if !issue.Warning {
+					numErrors++
+				}
+			}
+			if numErrors > 0 {
+				log.Fatal(errors.New("found " + strconv.Itoa(numErrors) + " error(s) and " + strconv.Itoa(len(issues)-numErrors) +
+					" warning(s) in the input files"))
+			}
+			fmt.Println("Input files are valid (" + strconv.Itoa(len(issues)) + " warning(s))")
+
 		case "setup":
 			// run dynamic setup
-			DynamicSetup(genPrm, setupPrm)
+			err = fep.DynamicSetup(genPrm, &settings.Setup, &settings.Hooks, events)
+			if err != nil {
+				log.Fatal(err)
+			}
 
 		case "dynamic":
 
 			// Check that enough arguments are provided
-			if argsLen < 4 {
+			if argsLen < 5 {
 				err = errors.New("too few arguments have been provided to run goFEP dynamic. 4 arguments are required.\n " +
 					"If more assistance is needed with this issue, launch goFEP with no arguments to access built-in help function")
 				log.Fatal(err)
 			}
 
 			// Get number of nodes to run on from 4th argument
-			numNodes, err = strconv.Atoi(os.Args[4])
+			numNodes, err = strconv.Atoi(args[4])
 			if err != nil {
-				err = errors.New("Invalid argument \"" + os.Args[4] + "\" for number of nodes to run on")
+				err = errors.New("Invalid argument \"" + args[4] + "\" for number of nodes to run on")
 				log.Fatal(err)
 			}
 			// If num nodes set to -1 (auto), set it to number of files to run
 			if numNodes == -1 {
-				numNodes = len(setupPrm.vdw)
+				numNodes = len(settings.Setup.Vdw)
 			}
+
 			// Get nodes from node INI
-			ng := getNodeGroup(&genPrm)
+			ng := getNodeGroup(settings, backend, events)
 
+			// Print plan instead of running, if requested
+			if dryRun {
+				err = fep.PrintPlan("dynamic", settings, ng, numNodes)
+				if err != nil {
+					log.Fatal(err)
+				}
+				break
+			}
 
 			// args[3] = call type
 			switch args[3] {
 			// run dynamic
-			case "all":
-				ng.DynamicManager(&genPrm, dynPrm, numNodes)
-			case "new":
-				ng.DynamicManager(&genPrm, dynPrm, numNodes)
+			case "all", "new":
+				jobs, err := ng.DynamicManager(genPrm, fep.LambdaPathSetup(settings), settings.Dynamic, numNodes)
+				reportJobs(jobs, err)
 			default:
 				err = errors.New("invalid argument \"" + args[3] + "\". Valid arguments following \"dynamic\" are: \"new\", \"all\".\n " +
 					"If more assistance is needed with this issue, launch goFEP with no arguments to access built-in help function")
@@ -109,24 +270,29 @@ func main() {
 					"If more assistance is needed with this issue, launch goFEP with no arguments to access built-in help function")
 				log.Fatal(err)
 			}
-			numNodes, err = strconv.Atoi(os.Args[3])
+			numNodes, err = strconv.Atoi(args[3])
 			if err != nil {
-				err = errors.New("Invalid argument \"" + os.Args[3] + "\" for number of nodes to run on")
+				err = errors.New("Invalid argument \"" + args[3] + "\" for number of nodes to run on")
 				log.Fatal(err)
 			}
 			// If num nodes set to -1 (auto), set it to number of files to run (bar has 1 fewer file than dynamic, hence -1)
 			if numNodes == -1 {
-				numNodes = len(setupPrm.vdw)-1
+				numNodes = len(settings.Setup.Vdw) - 1
 			}
 
-			// Setup BAR folders
-			BARSetup(&genPrm)
 			// Get nodes from node INI
-			ng := getNodeGroup(&genPrm)
-			// Run BAR
-			ng.BARManager(&genPrm, &barPrm, numNodes)
-			// Get results
-			returnResults(&genPrm)
+			ng := getNodeGroup(settings, backend, events)
+
+			// Print plan instead of running, if requested
+			if dryRun {
+				err = fep.PrintPlan("bar", settings, ng, numNodes)
+				if err != nil {
+					log.Fatal(err)
+				}
+				break
+			}
+
+			runBAR(ng, settings, numNodes)
 
 		case "auto":
 
@@ -138,57 +304,170 @@ func main() {
 			}
 
 			// Get number of nodes to run on
-			numNodes, err = strconv.Atoi(os.Args[3])
+			numNodes, err = strconv.Atoi(args[3])
 			if err != nil {
-				err = errors.New("Invalid argument \"" + os.Args[3] + "\" for number of nodes to run on")
+				err = errors.New("Invalid argument \"" + args[3] + "\" for number of nodes to run on")
 				log.Fatal(err)
 			}
 
-			// Get nodes from node INI
-			ng := getNodeGroup(&genPrm)
-			// If num nodes set to -1 (auto), set it to number of files to run (bar has 1 fewer file than dynamic, hence -1)
+			// If num nodes set to -1 (auto), set it to number of files to run
 			if numNodes == -1 {
-				numNodes = len(setupPrm.vdw)
+				numNodes = len(settings.Setup.Vdw)
 			}
-			// Setup for dynamic
-			DynamicSetup(genPrm, setupPrm)
-			// Run dynamic
-			ng.DynamicManager(&genPrm, dynPrm, numNodes)
 
-			// If num nodes set to -1 (auto), set it to number of files to run (bar has 1 fewer file than dynamic, hence -1)
-			if numNodes == -1 {
-				numNodes = len(setupPrm.vdw)-1
+			// Get nodes from node INI
+			ng := getNodeGroup(settings, backend, events)
+
+			// Print plan instead of running, if requested
+			if dryRun {
+				err = fep.PrintPlan("auto", settings, ng, numNodes)
+				if err != nil {
+					log.Fatal(err)
+				}
+				break
+			}
+
+			// Setup for dynamic
+			err = fep.DynamicSetup(genPrm, &settings.Setup, &settings.Hooks, events)
+			if err != nil {
+				log.Fatal(err)
 			}
 			// Setup for BAR
-			BARSetup(&genPrm)
-			// Run BAR
-			ng.BARManager(&genPrm, &barPrm, numNodes)
+			err = fep.BARSetup(genPrm, &settings.Setup, &settings.BAR, events)
+			if err != nil {
+				log.Fatal(err)
+			}
+			// Run dynamic, and BAR on each pair as soon as its windows finish
+			jobs, err := ng.PipelineManager(genPrm, &settings.Setup, settings.Dynamic, &settings.BAR, numNodes)
+			reportJobs(jobs, err)
 			// Get results
-			returnResults(&genPrm)
+			_, err = fep.ReturnResults(genPrm, &settings.Hooks, events)
+			if err != nil {
+				log.Fatal(err)
+			}
 		default:
-			err = errors.New("invalid parameter " + args[2] + ". Valid parameters in this position are: \"setup\", \"dynamic\", \"bar\", \"auto\".\n " +
+			err = errors.New("invalid parameter " + args[2] + ". Valid parameters in this position are: \"validate\", \"setup\", \"dynamic\", \"bar\", \"auto\", \"status\", \"attach\", \"watch\", \"server\", \"submit\", \"notify\".\n " +
 				"If more assistance is needed with this issue, launch goFEP with no arguments to access built-in help function")
 			log.Fatal(err)
 		}
 	}
 }
 
+// Get name of the user running goFEP, as runs are submitted under it
+func getUserName() string {
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	current, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	return current.Username
+}
+
+// Read nodes from the node INI and set the backend they run scripts with, where they send events and the hooks run
+// around them, exiting on failure
+func getNodeGroup(settings *fep.Settings, backend fep.Backend, events *fep.Emitter) *fep.NodeGroup {
+	ng, err := fep.GetNodeGroup(&settings.General)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ng.Backend = backend
+	ng.Events = events
+	ng.Hooks = &settings.Hooks
+	return ng
+}
+
+// Create an emitter writing events as JSON lines to the run journal in the target directory and, unless eventsPath is
+// empty, to the file at eventsPath. Both are appended to if they exist. Notifications are sent as set in notifyPrm
+func openEvents(targetDirectory string, eventsPath string, notifyPrm *fep.NotifyParameters) *fep.Emitter {
+	events := fep.NewEmitter()
+	journal, err := fep.OpenJournal(targetDirectory)
+	if err != nil {
+		log.Fatal(err)
+	}
+	events.Subscribe(fep.JSONLinesHandler(journal))
+
+	if eventsPath != "" {
+		file, err := os.OpenFile(eventsPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, octalPermissions)
+		if err != nil {
+			fmt.Println("Failed to open events file at " + eventsPath)
+			log.Fatal(err)
+		}
+		events.Subscribe(fep.JSONLinesHandler(file))
+	}
+
+	notifier := fep.NewNotifier(notifyPrm, targetDirectory)
+	if notifier.Enabled() {
+		events.Subscribe(notifier.Handle)
+	}
+	return events
+}
+
+// Serve status and metrics of the run over HTTP at addr, starting from the run journal and following events as they
+// are emitted. A server that fails to start only prints a warning, as the run can go on without it
+func serveStatus(targetDirectory string, addr string, events *fep.Emitter) {
+	past, _ := fep.ReadJournal(targetDirectory)
+	srv := fep.NewStatusServer(past)
+	events.Subscribe(srv.Apply)
+	go func() {
+		err := http.ListenAndServe(addr, srv)
+		if err != nil {
+			fmt.Println("Warning: failed to serve run status at " + addr + ": " + err.Error())
+		}
+	}()
+	fmt.Println("Serving run status on " + addr + " at /status (JSON) and /metrics (Prometheus)")
+}
+
+// Set up BAR folders, run BAR on them and write results, exiting on failure
+func runBAR(ng *fep.NodeGroup, settings *fep.Settings, numNodes int) {
+	// Setup BAR folders along the lambda path of the setup block if there is one, or else of the window manifests
+	err := fep.BARSetup(&settings.General, fep.LambdaPathSetup(settings), &settings.BAR, ng.Events)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Run BAR
+	jobs, err := ng.BARManager(&settings.General, &settings.BAR, numNodes)
+	reportJobs(jobs, err)
+	// Get results
+	_, err = fep.ReturnResults(&settings.General, &settings.Hooks, ng.Events)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Report how many jobs failed, exiting if the manager that ran them could not continue
+func reportJobs(jobs []fep.Job, err error) {
+	failed := fep.CountFailed(jobs)
+	if failed > 0 {
+		fmt.Println("\nWarning: " + strconv.Itoa(failed) + " of " + strconv.Itoa(len(jobs)) + " job(s) failed - see .err files in their directories")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func help() {
 	fmt.Println()
 	fmt.Println("goFEP Beta v" + goFEPversion)
-	fmt.Println("Compiled " + goFEPcompileDate + " for " + goFEPPlatform + "-" + goFEPArch )
+	fmt.Println("Compiled " + goFEPcompileDate + " for " + goFEPPlatform + "-" + goFEPArch)
 	fmt.Println("Justin Gourary | jtgourary@utexas.edu")
 	fmt.Println("Univ. of Texas at Austin | Dept. of Biomedical Eng.")
 	fmt.Println("Pengyu Ren Lab")
 	fmt.Println()
 	fmt.Println("IMPORTANT NOTE: goFEP must ALWAYS be run from bme-nova")
 	fmt.Println("i.e. \"ssh bme-nova\" THEN \"gofep path/to/xxx.ini xxx xxx ##\"")
+	fmt.Println("Add \"--detach\" to any task to keep it running in the background after you log out")
+	fmt.Println("Add \"--dry-run\" to dynamic, bar or auto to print what would be run without running it")
+	fmt.Println("Add \"--simulate\" to any task to fake nodes and Tinker locally, e.g. to test settings or learn goFEP")
+	fmt.Println("Add \"--events path/to/events.jsonl\" to any task to write progress events to a file as JSON lines")
+	fmt.Println("Add \"--serve :9090\" to setup, dynamic, bar or auto to serve run status as JSON and Prometheus metrics over HTTP")
 	fmt.Println()
 	fmt.Println("The first argument in a call to goFEP should always be a path to a configuration file")
 	fmt.Println("A sample configuration file with explanatory comments can be found at /home/jtg2769/software/gofep/sampleInput/settings.ini")
 	fmt.Println()
 	fmt.Println("Second argument should always be a task to perform")
-	fmt.Println("Valid tasks are: \"setup\", \"dynamic\", \"bar\",\"auto\"")
+	fmt.Println("Valid tasks are: \"validate\", \"setup\", \"dynamic\", \"bar\",\"auto\", \"status\", \"attach\", \"watch\", \"server\", \"submit\", \"notify\"")
 	fmt.Println("Intended usage is to either run setup, dynamic, and bar in sequence, or, if you're feeling lucky today, to run auto, which does all three sequentially")
 	fmt.Println()
 	fmt.Println("Make a selection to learn more about these tasks and how to run them:")
@@ -196,6 +475,11 @@ func help() {
 	fmt.Println("(2) dynamic")
 	fmt.Println("(3) bar")
 	fmt.Println("(4) auto")
+	fmt.Println("(5) status / attach")
+	fmt.Println("(6) watch")
+	fmt.Println("(7) server / submit")
+	fmt.Println("(8) notify")
+	fmt.Println("(9) validate")
 	fmt.Println()
 
 	reader := bufio.NewReader(os.Stdin)
@@ -214,6 +498,16 @@ func help() {
 		fmt.Println()
 		fmt.Println("* setup creates files to run tinker dynamic_omm on in directory specified in config file")
 		fmt.Println()
+		fmt.Println("* the setup block either lists vdwLambdas, eleLambdas and restraints, or generates them from eleWindows,")
+		fmt.Println("  vdwWindows, eleSpacing and vdwSpacing (linear, geometric <ratio>, endpoints or custom <lambdas>) and")
+		fmt.Println("  restraint, printing the schedule it generated")
+		fmt.Println()
+		fmt.Println("* windowKey <window> <keyword> [values], windowXYZ <window> <path> and windowPrm <window> <path> in the")
+		fmt.Println("  setup block give one window, by name or index, extra key lines or its own xyz or prm file")
+		fmt.Println()
+		fmt.Println("* seeding sequential [block] in the setup block starts each window from the last frame of block (the first")
+		fmt.Println("  dynamic block by default) of the window before it, rather than every window from the input xyz file")
+		fmt.Println()
 		fmt.Println("* further arguments are (1) the path to a configuration ini file")
 		fmt.Println()
 		fmt.Println("* usage: \"gofep /path/to/config.ini setup\"")
@@ -226,10 +520,12 @@ func help() {
 		fmt.Println()
 		fmt.Println("* Valid selections for call type are: \"new\" and \"all\"")
 		fmt.Println()
-		fmt.Println("* \"new\" runs dynamic_omm on only those xyz files in the directory that don't yet have a corresponding arc file")
+		fmt.Println("* each window runs the dynamic blocks in order, and their repetitions in turn, without waiting for other windows")
+		fmt.Println("* both run dynamic_omm only on repetitions that are out of date: not run yet, failed, or run from xyz, key or prm")
+		fmt.Println("  files or block parameters that have since changed (in which case the window starts again from scratch)")
 		fmt.Println("* this is useful if for example you would like to add an intermediate vdw/ele combination between two existing combinations")
-		fmt.Println()
-		fmt.Println("* \"all\" runs dynamic_omm on all xyz files in the directory")
+		fmt.Println("* what each step was run from is kept in gofep_build.json in the target directory; bar likewise only reruns pairs")
+		fmt.Println("  whose windows or parameters changed")
 		fmt.Println()
 		fmt.Println("* usage: \"gofep /path/to/config.ini dynamic new 20\"")
 		fmt.Println()
@@ -245,16 +541,99 @@ func help() {
 		fmt.Println()
 		fmt.Println("* auto is equivalent to running the following tasks in sequence:")
 		fmt.Println("  setup -> dynamic (with call type \"new\") -> bar")
+		fmt.Println("  except that bar1 of each pair starts as soon as both its windows have finished dynamic, on the node that")
+		fmt.Println("  finished the last of them, and bar2 straight after, while other windows are still running")
 		fmt.Println()
 		fmt.Println("* further arguments are the (1) path to a config file (2) max number of nodes to use (a positive integer or to have it set automatically -1)")
 		fmt.Println()
 		fmt.Println("* usage: \"gofep /path/to/config.ini auto -1\"")
 		fmt.Println()
+		fmt.Println("* add \"--dry-run\" to dynamic, bar or auto to print windows, node assignments, every script and estimates of")
+		fmt.Println("  frames, disk usage and GPU-hours without setting up or launching anything")
+		fmt.Println()
+		fmt.Println("* an optional hooks block in the configuration file runs shell commands in the target directory before and")
+		fmt.Println("  after setup (preSetup, postSetup), each dynamic block (preDynamic, postDynamic), each repetition of each")
+		fmt.Println("  window (preRepetition, postRepetition), bar1 (preBAR1, postBAR1), bar2 (preBAR2, postBAR2) and results")
+		fmt.Println("  (preResults, postResults), describing the block, window, pairs and paths in GOFEP_* environment variables")
+		fmt.Println("* a failing hook fails its window, or stops the run for other hooks")
+		fmt.Println()
 		fmt.Println("* Restart help to learn more about each of the above tasks")
 		fmt.Println()
+	case 5:
+		fmt.Println()
+		fmt.Println("* any task can be run in the background by adding \"--detach\" to the end of the call")
+		fmt.Println("* output is written to a timestamped log file in the target directory along with a PID file (" + daemonPIDFileName + ")")
+		fmt.Println()
+		fmt.Println("* status reports whether the background run is still going and prints the end of its log")
+		fmt.Println("* attach follows the log of the background run until it finishes. Pressing Ctrl-C stops following without affecting the run")
+		fmt.Println()
+		fmt.Println("* further arguments are (1) the path to a configuration ini file")
+		fmt.Println()
+		fmt.Println("* usage: \"gofep /path/to/config.ini auto -1 --detach\" then \"gofep /path/to/config.ini status\" or \"gofep /path/to/config.ini attach\"")
+		fmt.Println()
+	case 6:
+		fmt.Println()
+		fmt.Println("* watch opens a full-screen dashboard of the run in the target directory: lambda windows with their state, node,")
+		fmt.Println("  progress and ETA, BAR pairs with their free energies, node status and a log of recent events")
+		fmt.Println("* it only reads the run journal (" + fep.JournalFileName + ") in the target directory, so it can be opened and closed")
+		fmt.Println("  with Ctrl-C at any time without affecting the run")
+		fmt.Println()
+		fmt.Println("* further arguments are (1) the path to a configuration ini file")
+		fmt.Println()
+		fmt.Println("* usage: \"gofep /path/to/config.ini watch\"")
+		fmt.Println()
+	case 7:
+		fmt.Println()
+		fmt.Println("* server accepts runs from every user of the cluster over a local REST API and runs them side by side,")
+		fmt.Println("  giving each job its own GPU from the nodes in the node INI so runs no longer fight over nodes")
+		fmt.Println("* only the general block of the server's configuration file is needed, without xyz, key and prm: its target")
+		fmt.Println("  directory is where runs are kept (in a \"runs\" folder), its node INI is the pool shared by all runs and its")
+		fmt.Println("  intel and CUDA sources and homes are used by every run")
+		fmt.Println("* further arguments are (1) the path to the server's configuration ini file (2) optionally, the address to")
+		fmt.Println("  listen on (default " + defaultServerAddress + ")")
+		fmt.Println()
+		fmt.Println("* submit sends the configuration file of a run and the xyz, key and prm files it uses to a server, which runs")
+		fmt.Println("  setup, dynamic and bar on them as auto would")
+		fmt.Println("* further arguments are (1) the path to the run's configuration ini file (2) optionally, the address of the")
+		fmt.Println("  server (default " + defaultServerAddress + ")")
+		fmt.Println("* add \"--priority N\" to submit to let the jobs of the run go before those of lower priority, up to the")
+		fmt.Println("  server's maxPriority (default 0). Runs must be submitted from the server's machine, which checks their user")
+		fmt.Println()
+		fmt.Println("* jobs waiting for nodes are served by priority, then to the user who used the fewest GPU-hours lately, so")
+		fmt.Println("  runs of different users interleave. An optional scheduler block in the server's configuration file sets")
+		fmt.Println("  caps on nodes per user (maxNodesPerUser, userMaxNodes alice:8 bob:2), how fast past GPU-hours are")
+		fmt.Println("  forgotten (usageHalfLife, in hours) and how fast waiting jobs gain priority (priorityAging, in hours)")
+		fmt.Println()
+		fmt.Println("* usage: \"gofep /path/to/server.ini server --detach\" then \"gofep /path/to/config.ini submit\"")
+		fmt.Println()
+	case 8:
+		fmt.Println()
+		fmt.Println("* an optional notify block in the configuration file sends notifications when setup, dynamic and bar stages")
+		fmt.Println("  end, when a job fails and when results are written (with the total free energy and its error)")
+		fmt.Println("* notifications are posted as JSON to a webhook (webhook URL), mailed (email addresses, smtpServer host:port,")
+		fmt.Println("  smtpFrom, optionally smtpUser and smtpPassword or $GOFEP_SMTP_PASSWORD) and/or passed to a shell command")
+		fmt.Println("  (command ...) in GOFEP_* environment variables and as JSON on standard input")
+		fmt.Println("* \"on\" limits notifications to some of \"stages\", \"failures\" and \"results\" (default all three)")
+		fmt.Println()
+		fmt.Println("* notify sends a test notification in every way set, to check they work before starting a run")
+		fmt.Println("* further arguments are (1) the path to a configuration ini file")
+		fmt.Println()
+		fmt.Println("* usage: \"gofep /path/to/config.ini notify\"")
+		fmt.Println()
+	case 9:
+		fmt.Println()
+		fmt.Println("* validate checks the xyz, key and prm files in the config file against each other before any GPU time is spent:")
+		fmt.Println("  atom numbers, bonds (listed by both atoms) and box of the xyz file, atom types missing from the prm file, atoms")
+		fmt.Println("  and groups of ligand, mutate, group and restrain-groups lines of the key file, and ligand and lambda keywords")
+		fmt.Println("* each window of the setup block is checked with the files and key lines it would be set up with")
+		fmt.Println("* every problem found is printed as file:line: message; validate fails if any is an error rather than a warning")
+		fmt.Println("* further arguments are (1) the path to a configuration ini file")
+		fmt.Println()
+		fmt.Println("* usage: \"gofep /path/to/config.ini validate\"")
+		fmt.Println()
 	default:
 		fmt.Println()
 		fmt.Println("* Invalid selection")
 		fmt.Println()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jgourary/goFEP/fep"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Submit: contains the client that sends a run to a goFEP server
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Send the settings INI at iniPath and the xyz, key and prm files it uses, including those overriding single windows, to
+// the goFEP server at serverURL as a run of user with priority (the server's default if empty), and print where to
+// follow it
+func submitRun(settings *fep.Settings, iniPath string, serverURL string, user string, priority string) error {
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		serverURL = "http://" + serverURL
+	}
+	serverURL = strings.TrimSuffix(serverURL, "/")
+
+	// Build form with user, settings and inputs
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	err := form.WriteField("user", user)
+	if err != nil {
+		return err
+	}
+	if priority != "" {
+		err = form.WriteField("priority", priority)
+		if err != nil {
+			return err
+		}
+	}
+	err = addFormFile(form, "settings", iniPath)
+	if err != nil {
+		return err
+	}
+	genPrm := &settings.General
+	inputs := []string{genPrm.XYZPath, genPrm.KeyPath, genPrm.PrmPath}
+	for _, o := range settings.Setup.Overrides {
+		inputs = append(inputs, o.XYZ, o.Prm)
+	}
+	sent := map[string]bool{}
+	for _, path := range inputs {
+		if path == "" {
+			continue
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("could not compute absolute path to %s: %w", path, err)
+		}
+		if sent[absPath] {
+			continue
+		}
+		sent[absPath] = true
+		err = addFormFile(form, "inputs", path)
+		if err != nil {
+			return err
+		}
+	}
+	err = form.Close()
+	if err != nil {
+		return err
+	}
+
+	// Send form
+	resp, err := http.Post(serverURL+"/runs", form.FormDataContentType(), &body)
+	if err != nil {
+		return fmt.Errorf("failed to reach goFEP server at %s: %w", serverURL, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read reply of goFEP server: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		var reply map[string]string
+		if json.Unmarshal(data, &reply) == nil && reply["error"] != "" {
+			return errors.New("goFEP server refused run: " + reply["error"])
+		}
+		return errors.New("goFEP server refused run: " + resp.Status)
+	}
+	var run fep.Run
+	err = json.Unmarshal(data, &run)
+	if err != nil {
+		return fmt.Errorf("failed to read reply of goFEP server: %w", err)
+	}
+
+	fmt.Println("Submitted run " + run.ID + " as " + run.User + " with priority " + strconv.Itoa(run.Priority) + " to " + serverURL)
+	fmt.Println("Its files are in " + run.Directory + " on the server")
+	fmt.Println("Follow it with:")
+	fmt.Println("  curl " + serverURL + "/runs/" + run.ID)
+	fmt.Println("  curl " + serverURL + "/runs/" + run.ID + "/status")
+	fmt.Println("  curl " + serverURL + "/runs/" + run.ID + "/results")
+	fmt.Println("  curl " + serverURL + "/users")
+	return nil
+}
+
+// Add the file at path to form under field
+func addFormFile(form *multipart.Writer, field string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s to submit: %w", path, err)
+	}
+	defer file.Close()
+	part, err := form.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s to submit: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jgourary/goFEP/fep"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Watch: contains a full-screen terminal dashboard of a run, drawn from the run journal with plain ANSI escape codes
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ANSI escape codes used by the dashboard
+const (
+	ansiAltScreenOn  string = "\033[?1049h"
+	ansiAltScreenOff string = "\033[?1049l"
+	ansiHideCursor   string = "\033[?25l"
+	ansiShowCursor   string = "\033[?25h"
+	ansiHome         string = "\033[H"
+	ansiClearLine    string = "\033[K"
+	ansiClearDown    string = "\033[J"
+	ansiBold         string = "\033[1m"
+	ansiReset        string = "\033[0m"
+	ansiRed          string = "\033[31m"
+	ansiGreen        string = "\033[32m"
+	ansiYellow       string = "\033[33m"
+	ansiCyan         string = "\033[36m"
+)
+
+// Show a dashboard of the run in the target directory, redrawn every second until Ctrl-C. Only the run journal is read,
+// so the dashboard can be opened and closed at any time without affecting the run
+func watchRun(genPrm *fep.GeneralParameters) {
+
+	// Restore terminal on Ctrl-C or termination
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	fmt.Print(ansiAltScreenOn + ansiHideCursor)
+	defer fmt.Print(ansiShowCursor + ansiAltScreenOff)
+
+	ticker := time.NewTicker(watchRefreshInterval)
+	defer ticker.Stop()
+	for {
+		width, height := getTerminalSize()
+		fmt.Print(renderDashboard(genPrm.TargetDirectory, width, height))
+		select {
+		case <-signals:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Draw one frame of the dashboard, cut to fit a terminal of width x height
+func renderDashboard(targetDirectory string, width int, height int) string {
+	var lines []string
+
+	// Header
+	title := ansiBold + "goFEP watch" + ansiReset + "  " + targetDirectory
+	events, err := fep.ReadJournal(targetDirectory)
+	if err != nil {
+		lines = append(lines, title, "", "Waiting for a run journal ("+fep.JournalFileName+") to appear in the target directory...",
+			"", "Press Ctrl-C to exit")
+		return drawLines(lines, width, height)
+	}
+	rs := fep.BuildRunState(events)
+	stage := "none"
+	if rs.Stage != "" {
+		stage = rs.Stage
+		if rs.StageRunning {
+			stage += " (running)"
+		} else if rs.StageError != "" {
+			stage += " (" + ansiRed + "failed: " + rs.StageError + ansiReset + ")"
+		} else {
+			stage += " (finished)"
+		}
+	}
+	lines = append(lines, title,
+		"Stage: "+stage+"   Failed jobs: "+strconv.Itoa(rs.Failed)+"   Last event: "+formatAgo(rs.Updated)+"   Ctrl-C to exit", "")
+
+	// Lambda windows
+	lines = append(lines, ansiBold+"Windows"+ansiReset)
+	table := [][]string{{"Window", "State", "Block", "Rep", "Node", "Progress", "ns/day", "ETA"}}
+	for _, w := range rs.Windows {
+		nsPerDay := "-"
+		if w.NsPerDay > 0 {
+			nsPerDay = strconv.FormatFloat(w.NsPerDay, 'f', 1, 64)
+		}
+		eta := "-"
+		if w.ETA > 0 {
+			eta = w.ETA.Round(time.Second).String()
+		}
+		table = append(table, []string{w.Window, colorState(w.State), w.Block, strconv.Itoa(w.Repetition + 1), w.Node,
+			progressBar(w.Progress, 20), nsPerDay, eta})
+	}
+	lines = append(lines, formatTable(table)...)
+	lines = append(lines, "")
+
+	// BAR pairs
+	if len(rs.Pairs) > 0 {
+		lines = append(lines, ansiBold+"BAR pairs"+ansiReset)
+		table = [][]string{{"Pair", "Step", "State", "Node", "dG forward (kcal/mol)", "dG backward (kcal/mol)"}}
+		for _, p := range rs.Pairs {
+			forward, backward := "-", "-"
+			if p.Result != nil {
+				forward = formatEstimate(p.Result.Forward)
+				backward = formatEstimate(p.Result.Backward)
+			}
+			table = append(table, []string{p.Pair, string(p.Kind), colorState(p.State), p.Node, forward, backward})
+		}
+		lines = append(lines, formatTable(table)...)
+		lines = append(lines, "")
+	}
+
+	// Nodes
+	lines = append(lines, ansiBold+"Nodes"+ansiReset)
+	table = [][]string{{"Node", "Status", "goFEP jobs running"}}
+	for _, n := range rs.Nodes {
+		status := n.Status
+		if status == "" {
+			status = "unknown"
+		}
+		table = append(table, []string{n.Name, status, strconv.Itoa(n.Running)})
+	}
+	lines = append(lines, formatTable(table)...)
+	lines = append(lines, "")
+
+	// Event log fills the rest of the screen with the most recent events
+	lines = append(lines, ansiBold+"Events"+ansiReset)
+	room := height - len(lines)
+	if room < 1 {
+		room = 1
+	}
+	recent := rs.Recent
+	if len(recent) > room {
+		recent = recent[len(recent)-room:]
+	}
+	for _, ev := range recent {
+		lines = append(lines, describeEvent(ev))
+	}
+
+	return drawLines(lines, width, height)
+}
+
+// Join lines into a frame that overwrites the previous one, cutting lines to width and the frame to height
+func drawLines(lines []string, width int, height int) string {
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	var buf bytes.Buffer
+	buf.WriteString(ansiHome)
+	for i, line := range lines {
+		buf.WriteString(truncateVisible(line, width) + ansiReset + ansiClearLine)
+		if i < len(lines)-1 {
+			buf.WriteString("\n")
+		}
+	}
+	buf.WriteString(ansiClearDown)
+	return buf.String()
+}
+
+// Align columns of a table, the first row being its header. Widths ignore ANSI escape codes in cells
+func formatTable(rows [][]string) []string {
+	var widths []int
+	for _, row := range rows {
+		for j, cell := range row {
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if visibleLength(cell) > widths[j] {
+				widths[j] = visibleLength(cell)
+			}
+		}
+	}
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		line := " "
+		for j, cell := range row {
+			line += " " + cell
+			if j < len(row)-1 {
+				line += strings.Repeat(" ", widths[j]-visibleLength(cell)+1)
+			}
+		}
+		if i == 0 {
+			line = ansiCyan + line + ansiReset
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+// Count characters of s that are shown, not counting ANSI escape codes
+func visibleLength(s string) int {
+	return len([]rune(stripANSI(s)))
+}
+
+// Remove ANSI escape codes from s
+func stripANSI(s string) string {
+	var buf strings.Builder
+	inEscape := false
+	for _, r := range s {
+		if r == '\033' {
+			inEscape = true
+		}
+		if inEscape {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				inEscape = false
+			}
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// Color a job state
+func colorState(state string) string {
+	switch state {
+	case fep.StateRunning:
+		return ansiYellow + state + ansiReset
+	case fep.StateFinished:
+		return ansiGreen + state + ansiReset
+	case fep.StateFailed:
+		return ansiRed + state + ansiReset
+	}
+	return state
+}
+
+// Draw a progress bar of width characters followed by a percentage
+func progressBar(fraction float64, width int) string {
+	filled := int(math.Round(fraction * float64(width)))
+	if filled > width {
+		filled = width
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "] " + strconv.FormatFloat(100*fraction, 'f', 0, 64) + "%"
+}
+
+// Format a free energy and its error
+func formatEstimate(e fep.Estimate) string {
+	return strconv.FormatFloat(e.Energy, 'f', 3, 64) + " +/- " + strconv.FormatFloat(e.Error, 'f', 3, 64)
+}
+
+// Format how long ago t was
+func formatAgo(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
+
+// Describe an event in one line for the event log
+func describeEvent(ev fep.Event) string {
+	line := ev.Time.Local().Format("15:04:05") + "  "
+	switch ev.Type {
+	case fep.StageStarted:
+		line += "started " + ev.Stage
+	case fep.StageFinished:
+		line += "finished " + ev.Stage
+	case fep.NodeStatusChanged:
+		line += ev.Node + " is " + ev.Status
+	case fep.ResultsWritten:
+		line += "wrote results to " + ev.Dir
+	case fep.JobProgress:
+		line += ev.Job + " at " + strconv.FormatFloat(100*ev.Progress, 'f', 0, 64) + "%"
+	default:
+		line += strings.TrimPrefix(string(ev.Type), "job_") + " " + ev.Job
+		if ev.Node != "" {
+			line += " on " + ev.Node
+		}
+	}
+	if ev.Error != "" {
+		line += ": " + ansiRed + ev.Error + ansiReset
+	}
+	return line
+}
+
+// Cut line to width visible characters, not counting ANSI escape codes
+func truncateVisible(line string, width int) string {
+	var buf strings.Builder
+	visible := 0
+	inEscape := false
+	for _, r := range line {
+		if r == '\033' {
+			inEscape = true
+		}
+		if inEscape {
+			buf.WriteRune(r)
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				inEscape = false
+			}
+			continue
+		}
+		if visible >= width {
+			continue
+		}
+		buf.WriteRune(r)
+		visible++
+	}
+	return buf.String()
+}
+
+// Get size of the terminal from stty, falling back to 80x24
+func getTerminalSize() (int, int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return 80, 24
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 80, 24
+	}
+	height, err1 := strconv.Atoi(fields[0])
+	width, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
@@ -0,0 +1,309 @@
+package xyz
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Arc: contains a reader that streams the frames of an arc file, along with functions to count, extract, subsample and
+// concatenate frames built on it
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Longest line a Reader reads
+const maxLineLength int = 1024 * 1024
+
+// Reader reads the frames of an xyz or arc file one at a time
+type Reader struct {
+	scanner *bufio.Scanner
+	// line is the number of lines read, frames the number of frames read or skipped
+	line   int
+	frames int
+}
+
+// NewReader returns a Reader reading frames from r
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	return &Reader{scanner: scanner}
+}
+
+// Frames returns the number of frames read or skipped so far
+func (r *Reader) Frames() int {
+	return r.frames
+}
+
+// Next reads the next frame. It returns io.EOF once there are no frames left, and an *Error naming the frame and line
+// if the frame is invalid or cut short, after which the Reader can't read on
+func (r *Reader) Next() (*Frame, error) {
+	frame := &Frame{}
+	err := r.read(func(header string, box string, atomLine string) error {
+		if header != "" {
+			tokens := strings.Fields(header)
+			frame.Title = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(header), tokens[0]))
+			return nil
+		}
+		if box != "" {
+			frame.Box = parseBox(box)
+			return nil
+		}
+		atom, err := parseAtom(atomLine)
+		if err != nil {
+			return err
+		}
+		frame.Atoms = append(frame.Atoms, atom)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Skip moves past the next frame without parsing its atoms, which is much faster than reading it. It returns io.EOF
+// once there are no frames left
+func (r *Reader) Skip() error {
+	return r.read(nil)
+}
+
+// Read the lines of the next frame, passing each to handle if it is not nil: the header line, then the box line if
+// there is one, then each atom line, with the other arguments ""
+func (r *Reader) read(handle func(header string, box string, atomLine string) error) error {
+	// Find header line holding the number of atoms, skipping blank lines between frames
+	header := ""
+	for header == "" {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return r.errorf("%w", err)
+			}
+			return io.EOF
+		}
+		r.line++
+		header = strings.TrimSpace(r.scanner.Text())
+	}
+	numAtoms, err := strconv.Atoi(strings.Fields(header)[0])
+	if err != nil || numAtoms <= 0 {
+		return r.errorf("first line of frame \"%s\" does not start with the number of atoms", header)
+	}
+	if handle != nil {
+		if err = handle(header, "", ""); err != nil {
+			return r.errorf("%w", err)
+		}
+	}
+
+	// Read box line, if any, and atom lines
+	box := false
+	for i := 0; i < numAtoms; i++ {
+		if !r.scanner.Scan() {
+			if err = r.scanner.Err(); err != nil {
+				return r.errorf("%w", err)
+			}
+			return r.errorf("frame is cut short: it has %d of %d atoms", i, numAtoms)
+		}
+		r.line++
+		line := r.scanner.Text()
+		if i == 0 && !box && isBoxLine(line) {
+			box = true
+			i--
+			if handle != nil {
+				if err = handle("", line, ""); err != nil {
+					return r.errorf("%w", err)
+				}
+			}
+			continue
+		}
+		if handle != nil {
+			if err = handle("", "", line); err != nil {
+				return r.errorf("%w", err)
+			}
+		}
+	}
+	r.frames++
+	return nil
+}
+
+// Error is an error reading a frame, along with where in the file it was found
+type Error struct {
+	// Frame is the number of the frame being read and Line the number of the last line read, both counting from 1
+	Frame int
+	Line  int
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return "frame " + strconv.Itoa(e.Frame) + ", line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Return an Error at the frame being read and the last line read
+func (r *Reader) errorf(format string, a ...interface{}) error {
+	return &Error{Frame: r.frames + 1, Line: r.line, Err: fmt.Errorf(format, a...)}
+}
+
+// CountFrames counts the complete frames of the arc file at arcPath. If it finds an invalid or cut short frame, as
+// the last frame of an arc file still being written is, it returns the number of frames before it along with an error
+func CountFrames(arcPath string) (int, error) {
+	file, err := os.Open(arcPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open arc file %s: %w", arcPath, err)
+	}
+	defer file.Close()
+
+	r := NewReader(file)
+	for {
+		err = r.Skip()
+		if err == io.EOF {
+			return r.Frames(), nil
+		}
+		if err != nil {
+			return r.Frames(), fmt.Errorf("failed to read arc file %s: %w", arcPath, err)
+		}
+	}
+}
+
+// ReadFrame reads frame number frameNum, counting from 1, of the arc file at arcPath
+func ReadFrame(arcPath string, frameNum int) (*Frame, error) {
+	if frameNum < 1 {
+		return nil, errors.New("invalid frame " + strconv.Itoa(frameNum) + " of arc file " + arcPath + ": frames count from 1")
+	}
+	file, err := os.Open(arcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open arc file %s: %w", arcPath, err)
+	}
+	defer file.Close()
+
+	r := NewReader(file)
+	for r.Frames() < frameNum-1 {
+		if err = r.Skip(); err != nil {
+			break
+		}
+	}
+	var frame *Frame
+	if err == nil {
+		frame, err = r.Next()
+	}
+	if err == io.EOF {
+		return nil, errors.New("arc file " + arcPath + " has " + strconv.Itoa(r.Frames()) + " frame(s), not " + strconv.Itoa(frameNum))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read arc file %s: %w", arcPath, err)
+	}
+	return frame, nil
+}
+
+// Subsample writes every stride-th frame from frame first to frame last, counting from 1, of the arc file at srcPath
+// to the arc file at dstPath, returning the number of frames written. A last of 0 means the last frame of the file.
+// dstPath may be srcPath, as the frames are written to a temporary file that replaces dstPath once complete
+func Subsample(dstPath string, srcPath string, first int, last int, stride int) (int, error) {
+	if first < 1 || stride < 1 || (last != 0 && last < first) {
+		return 0, errors.New("invalid frames to subsample: from " + strconv.Itoa(first) + " to " + strconv.Itoa(last) + " every " +
+			strconv.Itoa(stride))
+	}
+	return writeArc(dstPath, func(w io.Writer) (int, error) {
+		file, err := os.Open(srcPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open arc file %s: %w", srcPath, err)
+		}
+		defer file.Close()
+
+		r := NewReader(file)
+		written := 0
+		for last == 0 || r.Frames() < last {
+			frameNum := r.Frames() + 1
+			if frameNum < first || (frameNum-first)%stride != 0 {
+				err = r.Skip()
+			} else {
+				var frame *Frame
+				frame, err = r.Next()
+				if err == nil {
+					_, err = frame.WriteTo(w)
+					written++
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, fmt.Errorf("failed to subsample arc file %s: %w", srcPath, err)
+			}
+		}
+		if r.Frames() < first || r.Frames() < last {
+			return 0, errors.New("arc file " + srcPath + " has only " + strconv.Itoa(r.Frames()) + " frame(s)")
+		}
+		return written, nil
+	})
+}
+
+// Concatenate writes the frames of the arc files at srcPaths, in order, to the arc file at dstPath, returning the
+// number of frames written. Every frame must have the same number of atoms. dstPath may be one of srcPaths
+func Concatenate(dstPath string, srcPaths ...string) (int, error) {
+	return writeArc(dstPath, func(w io.Writer) (int, error) {
+		written := 0
+		numAtoms := 0
+		for _, srcPath := range srcPaths {
+			file, err := os.Open(srcPath)
+			if err != nil {
+				return 0, fmt.Errorf("failed to open arc file %s: %w", srcPath, err)
+			}
+			r := NewReader(file)
+			for {
+				var frame *Frame
+				frame, err = r.Next()
+				if err != nil {
+					break
+				}
+				if numAtoms == 0 {
+					numAtoms = len(frame.Atoms)
+				} else if len(frame.Atoms) != numAtoms {
+					err = errors.New("frame " + strconv.Itoa(r.Frames()) + " has " + strconv.Itoa(len(frame.Atoms)) + " atoms, not " +
+						strconv.Itoa(numAtoms) + " like the frames before it")
+					break
+				}
+				if _, err = frame.WriteTo(w); err != nil {
+					break
+				}
+				written++
+			}
+			file.Close()
+			if err != io.EOF {
+				return 0, fmt.Errorf("failed to concatenate arc file %s: %w", srcPath, err)
+			}
+		}
+		return written, nil
+	})
+}
+
+// Write an arc file at path with write, through a temporary file in the same folder that replaces path only if write
+// succeeds
+func writeArc(path string, write func(w io.Writer) (int, error)) (int, error) {
+	file, err := os.Create(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create arc file %s: %w", path, err)
+	}
+	bw := bufio.NewWriter(file)
+	written, err := write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write arc file %s: %w", path, closeErr)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return 0, err
+	}
+	return written, nil
+}
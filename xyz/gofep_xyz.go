@@ -0,0 +1,191 @@
+// Package xyz reads and writes Tinker xyz files and the multi-frame arc files Tinker writes trajectories to.
+//
+// A Frame holds one structure: a title, an optional periodic box and its atoms, each with its name, coordinates,
+// atom type and the atoms it is bonded to. ReadFile and Frame.WriteTo handle single xyz files. Arc files are just
+// frames one after the other, so a Reader streams them frame by frame without holding the trajectory in memory, and
+// CountFrames, ReadFrame, Subsample and Concatenate build on it to count, extract, thin out and join trajectories.
+//
+// Frames are written in the fixed-column layout Tinker writes, with coordinates to six decimals.
+package xyz
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// XYZ: contains the model of a frame of a Tinker xyz or arc file, along with functions to parse and write one
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Frame is one structure of an xyz or arc file
+type Frame struct {
+	// Title is the rest of the first line of the frame after the number of atoms
+	Title string
+	// Box is the periodic box of the frame, nil if the frame has no box line
+	Box   *Box
+	Atoms []Atom
+}
+
+// Box is a periodic box: the lengths of its edges in Angstroms and the angles between them in degrees
+type Box struct {
+	A, B, C            float64
+	Alpha, Beta, Gamma float64
+}
+
+// Atom is one atom line of a frame
+type Atom struct {
+	// Number is the atom number as written, which bonds refer to. Tinker numbers atoms from 1 in order
+	Number int
+	Name   string
+	Coords [3]float64
+	// Type is the atom type, which the prm file gives the parameters of
+	Type  int
+	Bonds []int
+}
+
+// Read the xyz file at path. Anything after its first frame is ignored
+func ReadFile(path string) (*Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xyz file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	frame, err := NewReader(file).Next()
+	if err == io.EOF {
+		err = errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read xyz file %s: %w", path, err)
+	}
+	return frame, nil
+}
+
+// Write the frame to the file at path, replacing it if it exists
+func WriteFile(path string, frame *Frame) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create xyz file %s: %w", path, err)
+	}
+	_, err = frame.WriteTo(file)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write xyz file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Check whether a line of a frame is a box line: six numbers, where an atom line has a name among its first six fields
+func isBoxLine(line string) bool {
+	tokens := strings.Fields(line)
+	if len(tokens) != 6 {
+		return false
+	}
+	for _, token := range tokens {
+		if _, err := strconv.ParseFloat(token, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse the box line of a frame
+func parseBox(line string) *Box {
+	tokens := strings.Fields(line)
+	var values [6]float64
+	for i, token := range tokens {
+		values[i], _ = strconv.ParseFloat(token, 64)
+	}
+	return &Box{A: values[0], B: values[1], C: values[2], Alpha: values[3], Beta: values[4], Gamma: values[5]}
+}
+
+// Parse an atom line of a frame: number, name, three coordinates, atom type and the numbers of the atoms it is bonded to
+func parseAtom(line string) (Atom, error) {
+	tokens := strings.Fields(line)
+	if len(tokens) < 6 {
+		return Atom{}, errors.New("atom line \"" + strings.TrimSpace(line) + "\" has fewer than 6 fields (number, name, x, y, z, type)")
+	}
+	var atom Atom
+	var err error
+	atom.Number, err = strconv.Atoi(tokens[0])
+	if err != nil {
+		return Atom{}, errors.New("atom line \"" + strings.TrimSpace(line) + "\" has invalid atom number " + tokens[0])
+	}
+	atom.Name = tokens[1]
+	for i := 0; i < 3; i++ {
+		atom.Coords[i], err = strconv.ParseFloat(tokens[2+i], 64)
+		if err != nil {
+			return Atom{}, errors.New("atom line \"" + strings.TrimSpace(line) + "\" has invalid coordinate " + tokens[2+i])
+		}
+	}
+	atom.Type, err = strconv.Atoi(tokens[5])
+	if err != nil {
+		return Atom{}, errors.New("atom line \"" + strings.TrimSpace(line) + "\" has invalid atom type " + tokens[5])
+	}
+	for _, token := range tokens[6:] {
+		bond, err := strconv.Atoi(token)
+		if err != nil {
+			return Atom{}, errors.New("atom line \"" + strings.TrimSpace(line) + "\" has invalid bonded atom " + token)
+		}
+		atom.Bonds = append(atom.Bonds, bond)
+	}
+	return atom, nil
+}
+
+// WriteTo writes the frame to w in the layout Tinker writes xyz and arc files in. Fields are always separated by
+// whitespace, however large their values
+func (f *Frame) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	write := func(s string) {
+		written, _ := bw.WriteString(s)
+		n += int64(written)
+	}
+
+	write(fmt.Sprintf("%6d", len(f.Atoms)))
+	if f.Title != "" {
+		write("  " + f.Title)
+	}
+	write("\n")
+	if f.Box != nil {
+		write(fmt.Sprintf("  %11.6f %11.6f %11.6f %11.6f %11.6f %11.6f\n", f.Box.A, f.Box.B, f.Box.C, f.Box.Alpha, f.Box.Beta, f.Box.Gamma))
+	}
+	for _, atom := range f.Atoms {
+		write(fmt.Sprintf("%6d  %-3s %11.6f %11.6f %11.6f %5d", atom.Number, atom.Name, atom.Coords[0], atom.Coords[1], atom.Coords[2], atom.Type))
+		for _, bond := range atom.Bonds {
+			write(fmt.Sprintf(" %5d", bond))
+		}
+		write("\n")
+	}
+	return n, bw.Flush()
+}
+
+// String returns the frame as the contents of an xyz file
+func (f *Frame) String() string {
+	var sb strings.Builder
+	f.WriteTo(&sb)
+	return sb.String()
+}
+
+// Copy returns a copy of the frame that shares nothing with it, so its atoms can be moved without changing the frame
+func (f *Frame) Copy() *Frame {
+	c := &Frame{Title: f.Title, Atoms: make([]Atom, len(f.Atoms))}
+	if f.Box != nil {
+		box := *f.Box
+		c.Box = &box
+	}
+	for i, atom := range f.Atoms {
+		c.Atoms[i] = atom
+		c.Atoms[i].Bonds = append([]int(nil), atom.Bonds...)
+	}
+	return c
+}
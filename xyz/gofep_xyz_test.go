@@ -0,0 +1,315 @@
+package xyz
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Get a frame of water numbered num, with its title and coordinates set from num so frames can be told apart
+func testFrame(num int, box bool) *Frame {
+	shift := float64(num)
+	frame := &Frame{Title: "water " + strconv.Itoa(num), Atoms: []Atom{
+		{Number: 1, Name: "O", Coords: [3]float64{shift, 0, 0}, Type: 1, Bonds: []int{2, 3}},
+		{Number: 2, Name: "H", Coords: [3]float64{shift + 0.9572, 0, 0}, Type: 2, Bonds: []int{1}},
+		{Number: 3, Name: "H", Coords: [3]float64{shift - 0.239988, 0.926627, 0}, Type: 2, Bonds: []int{1}},
+	}}
+	if box {
+		frame.Box = &Box{A: 18.643, B: 18.643, C: 18.643, Alpha: 90, Beta: 90, Gamma: 90}
+	}
+	return frame
+}
+
+// Write the frames numbered 1 to numFrames to an arc file named name in dir, followed by extra, and return its path
+func writeTestArc(t *testing.T, dir string, name string, numFrames int, extra string) string {
+	var sb strings.Builder
+	for i := 1; i <= numFrames; i++ {
+		sb.WriteString(testFrame(i, true).String())
+	}
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(sb.String()+extra), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Create a temporary folder, returning it along with a function removing it
+func testDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gofep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// Read the titles of the frames of the arc file at path
+func readTitles(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var titles []string
+	r := NewReader(file)
+	for {
+		frame, err := r.Next()
+		if err == io.EOF {
+			return titles
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		titles = append(titles, frame.Title)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	dir, remove := testDir(t)
+	defer remove()
+
+	for _, box := range []bool{true, false} {
+		frame := testFrame(1, box)
+		frame.Atoms[0].Coords[1] = -123456.5
+		frame.Atoms = append(frame.Atoms, Atom{Number: 4, Name: "Na+", Coords: [3]float64{1, 2, 3}, Type: 100000})
+		path := filepath.Join(dir, "water.xyz")
+		err := WriteFile(path, frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, frame) {
+			t.Errorf("with box %v, read frame\n%s\nwant\n%s", box, read, frame)
+		}
+		if (read.Box != nil) != box {
+			t.Errorf("with box %v, read box %v", box, read.Box)
+		}
+		if read.String() != frame.String() {
+			t.Errorf("with box %v, frame is not written the same once read", box)
+		}
+	}
+}
+
+func TestFrameLayout(t *testing.T) {
+	want := "     3  water 1\n" +
+		"    18.643000   18.643000   18.643000   90.000000   90.000000   90.000000\n" +
+		"     1  O      1.000000    0.000000    0.000000     1     2     3\n" +
+		"     2  H      1.957200    0.000000    0.000000     2     1\n" +
+		"     3  H      0.760012    0.926627    0.000000     2     1\n"
+	if got := testFrame(1, true).String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestIsBoxLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"    18.643000   18.643000   18.643000   90.000000   90.000000   90.000000", true},
+		{"30 30 30 90 90 90", true},
+		{"     1  O      1.000000    0.000000    0.000000     1", false},
+		{"     1  O      1.000000    0.000000    0.000000     1     2     3", false},
+		{"30 30 30 90 90", false},
+		{"30 30 30 90 90 90 90", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := isBoxLine(test.line); got != test.want {
+			t.Errorf("isBoxLine(%q) = %v, want %v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// line and message of the error
+		line    int
+		message string
+	}{
+		{"no atom count", "water\n", 1, "does not start with the number of atoms"},
+		{"cut short", "     2  water\n     1  O 0.0 0.0 0.0 1\n", 2, "frame is cut short: it has 1 of 2 atoms"},
+		{"bad coordinate", "     1  water\n     1  O 0.0 x 0.0 1\n", 2, "invalid coordinate x"},
+		{"too few fields", "     1  water\n     1  O 0.0 0.0 0.0\n", 2, "fewer than 6 fields"},
+	}
+	for _, test := range tests {
+		_, err := NewReader(strings.NewReader(test.text)).Next()
+		var xyzErr *Error
+		if !errors.As(err, &xyzErr) {
+			t.Errorf("%s: got error %v, want an *Error", test.name, err)
+			continue
+		}
+		if xyzErr.Frame != 1 || xyzErr.Line != test.line || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: got error %q at frame %d line %d, want %q at frame 1 line %d", test.name, err, xyzErr.Frame,
+				xyzErr.Line, test.message, test.line)
+		}
+	}
+}
+
+func TestCountFrames(t *testing.T) {
+	dir, remove := testDir(t)
+	defer remove()
+
+	tests := []struct {
+		name      string
+		numFrames int
+		extra     string
+		want      int
+		// whether the last frame is cut short
+		truncated bool
+	}{
+		{name: "complete", numFrames: 5, want: 5},
+		{name: "blank lines between frames", numFrames: 3, extra: "\n\n", want: 3},
+		{name: "empty", numFrames: 0, want: 0},
+		{name: "last frame cut short", numFrames: 4, extra: "     3  water 5\n     1  O 0.0 0.0 0.0 1 2 3\n", want: 4, truncated: true},
+	}
+	for _, test := range tests {
+		path := writeTestArc(t, dir, "water.arc", test.numFrames, test.extra)
+		got, err := CountFrames(path)
+		if got != test.want {
+			t.Errorf("%s: counted %d frames, want %d", test.name, got, test.want)
+		}
+		var xyzErr *Error
+		if test.truncated && (!errors.As(err, &xyzErr) || xyzErr.Frame != test.want+1) {
+			t.Errorf("%s: got error %v, want one in frame %d", test.name, err, test.want+1)
+		} else if !test.truncated && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+	if _, err := CountFrames(filepath.Join(dir, "missing.arc")); err == nil {
+		t.Errorf("counted frames of a missing arc file")
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	dir, remove := testDir(t)
+	defer remove()
+	path := writeTestArc(t, dir, "water.arc", 4, "     3  water 5\n")
+
+	for _, frameNum := range []int{1, 3, 4} {
+		frame, err := ReadFrame(path, frameNum)
+		if err != nil {
+			t.Errorf("frame %d: unexpected error: %v", frameNum, err)
+			continue
+		}
+		// Coordinates shifted by the frame number need not round trip exactly, so frames are compared as written
+		if want := testFrame(frameNum, true); frame.String() != want.String() {
+			t.Errorf("frame %d: read\n%s\nwant\n%s", frameNum, frame, want)
+		}
+	}
+	for _, frameNum := range []int{0, -1, 5, 6} {
+		if frame, err := ReadFrame(path, frameNum); err == nil {
+			t.Errorf("frame %d: read %q, want an error", frameNum, frame.Title)
+		}
+	}
+
+	empty := writeTestArc(t, dir, "empty.arc", 0, "")
+	_, err := ReadFrame(empty, 1)
+	if err == nil || !strings.Contains(err.Error(), "has 0 frame(s)") {
+		t.Errorf("got error %v reading empty arc file", err)
+	}
+}
+
+func TestSubsample(t *testing.T) {
+	dir, remove := testDir(t)
+	defer remove()
+	srcPath := writeTestArc(t, dir, "water.arc", 6, "")
+	dstPath := filepath.Join(dir, "sub.arc")
+
+	tests := []struct {
+		first, last, stride int
+		want                []string
+	}{
+		{1, 0, 1, []string{"water 1", "water 2", "water 3", "water 4", "water 5", "water 6"}},
+		{2, 5, 2, []string{"water 2", "water 4"}},
+		{3, 0, 2, []string{"water 3", "water 5"}},
+		{6, 6, 1, []string{"water 6"}},
+	}
+	for _, test := range tests {
+		written, err := Subsample(dstPath, srcPath, test.first, test.last, test.stride)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test, err)
+			continue
+		}
+		got := readTitles(t, dstPath)
+		if written != len(test.want) || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("from %d to %d every %d: wrote %d frames %q, want %q", test.first, test.last, test.stride, written, got,
+				test.want)
+		}
+	}
+
+	// Invalid ranges and frames past the end are refused, leaving the destination as it was
+	for _, args := range [][3]int{{0, 0, 1}, {1, 0, 0}, {4, 2, 1}, {2, 7, 1}, {7, 0, 1}} {
+		if _, err := Subsample(dstPath, srcPath, args[0], args[1], args[2]); err == nil {
+			t.Errorf("subsampled from %d to %d every %d, want an error", args[0], args[1], args[2])
+		}
+	}
+	if got := readTitles(t, dstPath); !reflect.DeepEqual(got, []string{"water 6"}) {
+		t.Errorf("failed subsample changed destination to %q", got)
+	}
+
+	// Subsampling in place replaces the file
+	written, err := Subsample(srcPath, srcPath, 1, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTitles(t, srcPath); written != 2 || !reflect.DeepEqual(got, []string{"water 1", "water 4"}) {
+		t.Errorf("subsampled in place to %q", got)
+	}
+}
+
+func TestConcatenate(t *testing.T) {
+	dir, remove := testDir(t)
+	defer remove()
+	first := writeTestArc(t, dir, "first.arc", 2, "")
+	second := writeTestArc(t, dir, "second.arc", 3, "")
+	empty := writeTestArc(t, dir, "empty.arc", 0, "")
+	dstPath := filepath.Join(dir, "all.arc")
+
+	written, err := Concatenate(dstPath, first, empty, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"water 1", "water 2", "water 1", "water 2", "water 3"}
+	if got := readTitles(t, dstPath); written != 5 || !reflect.DeepEqual(got, want) {
+		t.Errorf("wrote %d frames %q, want %q", written, got, want)
+	}
+
+	// The destination may be one of the sources
+	written, err = Concatenate(first, first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTitles(t, first); written != 5 || !reflect.DeepEqual(got, want) {
+		t.Errorf("concatenated in place to %q, want %q", got, want)
+	}
+
+	// Frames with other numbers of atoms and cut short frames are refused without writing the destination
+	other := filepath.Join(dir, "other.arc")
+	frame := testFrame(1, true)
+	frame.Atoms = frame.Atoms[:1]
+	err = WriteFile(other, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := writeTestArc(t, dir, "truncated.arc", 1, "     3  water 2\n")
+	for _, src := range []string{other, truncated} {
+		if _, err := Concatenate(filepath.Join(dir, "bad.arc"), second, src); err == nil {
+			t.Errorf("concatenated %s, want an error", filepath.Base(src))
+		}
+		if _, err := os.Stat(filepath.Join(dir, "bad.arc")); !os.IsNotExist(err) {
+			t.Errorf("failed concatenation of %s wrote its destination", filepath.Base(src))
+		}
+	}
+}